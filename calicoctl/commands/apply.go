@@ -22,6 +22,7 @@ import (
 	"github.com/projectcalico/calico-go/lib/api"
 	"github.com/projectcalico/calico-go/lib/api/unversioned"
 	"github.com/projectcalico/calico-go/lib/client"
+	"github.com/projectcalico/calico-go/lib/common"
 )
 
 func Apply(args []string) error {
@@ -105,6 +106,10 @@ func (a apply) execute(client *client.Client, resource unversioned.Resource) (un
 		_, err = client.Profiles().Apply(&r)
 	case api.Tier:
 		_, err = client.Tiers().Apply(&r)
+	case api.FelixConfiguration:
+		_, err = client.FelixConfigurations().Apply(&r)
+	case api.NodeStatus:
+		err = common.ErrorOperationNotSupported{Operation: "apply", Kind: r.Kind}
 	default:
 		panic(fmt.Errorf("Unhandled resource type: %v", resource))
 	}
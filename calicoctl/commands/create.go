@@ -107,6 +107,10 @@ func (c create) execute(client *client.Client, resource unversioned.Resource) (u
 		_, err = client.Profiles().Create(&r)
 	case api.Tier:
 		_, err = client.Tiers().Create(&r)
+	case api.FelixConfiguration:
+		_, err = client.FelixConfigurations().Create(&r)
+	case api.NodeStatus:
+		err = common.ErrorOperationNotSupported{Operation: "create", Kind: r.Kind}
 	default:
 		panic(fmt.Errorf("Unhandled resource type: %v", resource))
 	}
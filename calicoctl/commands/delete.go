@@ -115,6 +115,10 @@ func (d delete) execute(client *client.Client, resource unversioned.Resource) (u
 		err = client.Profiles().Delete(r.Metadata)
 	case api.Tier:
 		err = client.Tiers().Delete(r.Metadata)
+	case api.FelixConfiguration:
+		err = client.FelixConfigurations().Delete(r.Metadata)
+	case api.NodeStatus:
+		err = common.ErrorOperationNotSupported{Operation: "delete", Kind: r.Kind}
 	default:
 		panic(fmt.Errorf("Unhandled resource type: %v", resource))
 	}
@@ -29,7 +29,8 @@ import (
 func Get(args []string) error {
 	doc := EtcdIntro + `Display one or many resources identified by file, stdin or resource type and name.
 
-Possible resource types include: policy
+Possible resource types include: policy, profile, tier, hostEndpoint, felixConfiguration,
+nodeStatus
 
 By specifying the output as 'template' and providing a Go template as the value
 of the --template flag, you can filter the attributes of the fetched resource(s).
@@ -44,6 +45,12 @@ Examples:
   # List a specific policy in YAML format
   calicoctl get -o yaml policy my-policy-1
 
+  # List the Felix configuration for host "host1"
+  calicoctl get felixConfiguration --hostname=host1
+
+  # Show which hosts have a live Felix and whether each one is in sync
+  calicoctl get nodeStatus
+
 Options:
   -f --filename=<FILENAME>     Filename to use to get the resource.  If set to "-" loads from stdin.
   -o --output=<OUTPUT FORMAT>  Output format.  One of: yaml, json.  [Default: yaml]
@@ -98,6 +105,10 @@ func (g get) execute(client *client.Client, resource unversioned.Resource) (unve
 		resource, err = client.Profiles().List(r.Metadata)
 	case api.Tier:
 		resource, err = client.Tiers().List(r.Metadata)
+	case api.FelixConfiguration:
+		resource, err = client.FelixConfigurations().List(r.Metadata)
+	case api.NodeStatus:
+		resource, err = client.NodeStatuses().List(r.Metadata)
 	default:
 		panic(fmt.Errorf("Unhandled resource type: %v", resource))
 	}
@@ -23,6 +23,7 @@ import (
 	"github.com/projectcalico/calico-go/lib/api"
 	"github.com/projectcalico/calico-go/lib/api/unversioned"
 	"github.com/projectcalico/calico-go/lib/client"
+	"github.com/projectcalico/calico-go/lib/common"
 )
 
 func Replace(args []string) error {
@@ -107,6 +108,10 @@ func (c replace) execute(client *client.Client, resource unversioned.Resource) (
 		_, err = client.Profiles().Update(&r)
 	case api.Tier:
 		_, err = client.Tiers().Update(&r)
+	case api.FelixConfiguration:
+		_, err = client.FelixConfigurations().Update(&r)
+	case api.NodeStatus:
+		err = common.ErrorOperationNotSupported{Operation: "replace", Kind: r.Kind}
 	default:
 		panic(fmt.Errorf("Unhandled resource type: %v", resource))
 	}
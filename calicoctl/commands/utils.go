@@ -130,6 +130,15 @@ func getResourceFromArguments(args map[string]interface{}) (unversioned.Resource
 		p.Metadata.Name = name
 		p.Metadata.Tier = tier
 		return *p, nil
+	case "felixConfiguration":
+		c := api.NewFelixConfiguration()
+		c.Metadata.Name = name
+		c.Metadata.Hostname = hostname
+		return *c, nil
+	case "nodeStatus":
+		s := api.NewNodeStatus()
+		s.Metadata.Hostname = hostname
+		return *s, nil
 	default:
 		return nil, fmt.Errorf("Resource type '%s' is not unsupported", kind)
 	}
@@ -23,12 +23,23 @@ var log = logging.MustGetLogger("hwm")
 
 // HighWatermarkTracker: map that tracks the highest value seen for each key.
 // Supports temporary tracking of deletions in order to resolve concurrent updates.
+// Optionally, also tracks a hash of each key's value so that updates that
+// don't change the value can be suppressed.
 type HighWatermarkTracker struct {
 	hwms         *patricia.Trie
 	deletionHwms *patricia.Trie
 	deletionHwm  uint64
 }
 
+// entry is the item stored in the hwms trie for each key.
+type entry struct {
+	hwm uint64
+	// valueHash is the hash of the key's value, valid if hashKnown is
+	// true.
+	valueHash uint64
+	hashKnown bool
+}
+
 func NewHighWatermarkTracker() *HighWatermarkTracker {
 	trie := new(HighWatermarkTracker)
 	trie.hwms = patricia.NewTrie()
@@ -62,20 +73,33 @@ func (trie *HighWatermarkTracker) StoreUpdate(key string, newModIdx uint64) uint
 	}
 
 	// Get the old value
-	oldHwmOrNil := trie.hwms.Get(prefix)
-	if oldHwmOrNil != nil {
-		oldHwm := oldHwmOrNil.(uint64)
+	oldEntryOrNil := trie.hwms.Get(prefix)
+	if oldEntryOrNil != nil {
+		oldEntry := oldEntryOrNil.(*entry)
+		oldHwm := oldEntry.hwm
 		if oldHwm < newModIdx {
-			trie.hwms.Set(prefix, newModIdx)
+			oldEntry.hwm = newModIdx
 		}
-	} else {
-		trie.hwms.Set(prefix, newModIdx)
+		return oldHwm
 	}
-	if oldHwmOrNil != nil {
-		return oldHwmOrNil.(uint64)
-	} else {
-		return 0
+	trie.hwms.Set(prefix, &entry{hwm: newModIdx})
+	return 0
+}
+
+// StoreValueHash records the hash of the value that was last passed on for
+// the given key, which must have been stored with StoreUpdate.  Returns false
+// if the hash matches the one previously stored, indicating that the update
+// doesn't change the value and can be suppressed.
+func (trie *HighWatermarkTracker) StoreValueHash(key string, valueHash uint64) (changed bool) {
+	entryOrNil := trie.hwms.Get(keyToPrefix(key))
+	if entryOrNil == nil {
+		return true
 	}
+	e := entryOrNil.(*entry)
+	changed = !e.hashKnown || e.valueHash != valueHash
+	e.valueHash = valueHash
+	e.hashKnown = true
+	return
 }
 
 func (trie *HighWatermarkTracker) StoreDeletion(key string, newModIdx uint64) []string {
@@ -92,6 +116,9 @@ func (trie *HighWatermarkTracker) StoreDeletion(key string, newModIdx uint64) []
 		deletedKeys = append(deletedKeys, childKey)
 		return nil
 	})
+	// Forget the deleted keys so that a later DeleteOldKeys doesn't
+	// report them again and so that a re-creation is treated as new.
+	trie.hwms.DeleteSubtree(prefix)
 	return deletedKeys
 }
 
@@ -104,8 +131,12 @@ func (trie *HighWatermarkTracker) DeleteOldKeys(hwmLimit uint64) []string {
 		if prefix == nil {
 			panic("nil prefix passed to visitor")
 		}
-		if item.(uint64) < hwmLimit {
-			deletedPrefixes = append(deletedPrefixes, prefix)
+		if item.(*entry).hwm < hwmLimit {
+			// The trie reuses the prefix buffer as it visits,
+			// take a copy.
+			prefixCopy := make(patricia.Prefix, len(prefix))
+			copy(prefixCopy, prefix)
+			deletedPrefixes = append(deletedPrefixes, prefixCopy)
 		}
 		return nil
 	})
@@ -119,6 +150,15 @@ func (trie *HighWatermarkTracker) DeleteOldKeys(hwmLimit uint64) []string {
 	return deletedKeys
 }
 
+// VisitKeys calls the given function for each key that the tracker holds,
+// along with its high watermark.  The function must not modify the tracker.
+func (trie *HighWatermarkTracker) VisitKeys(f func(key string, hwm uint64)) {
+	trie.hwms.Visit(func(prefix patricia.Prefix, item patricia.Item) error {
+		f(prefixToKey(prefix), item.(*entry).hwm)
+		return nil
+	})
+}
+
 func findLongestPrefix(trie *patricia.Trie, prefix patricia.Prefix) (patricia.Prefix, patricia.Item) {
 	var longestPrefix patricia.Prefix
 	var longestItem patricia.Item
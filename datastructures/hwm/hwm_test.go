@@ -0,0 +1,110 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hwm_test
+
+import (
+	. "github.com/projectcalico/calico-go/datastructures/hwm"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HighWatermarkTracker", func() {
+	var hwms *HighWatermarkTracker
+
+	BeforeEach(func() {
+		hwms = NewHighWatermarkTracker()
+	})
+
+	It("should return the previous high watermark", func() {
+		Expect(hwms.StoreUpdate("/a/b", 10)).To(BeEquivalentTo(0))
+		Expect(hwms.StoreUpdate("/a/b", 12)).To(BeEquivalentTo(10))
+		Expect(hwms.StoreUpdate("/a/b", 11)).To(BeEquivalentTo(12))
+		Expect(hwms.StoreUpdate("/a/b", 13)).To(BeEquivalentTo(12))
+	})
+
+	Describe("StoreDeletion", func() {
+		BeforeEach(func() {
+			hwms.StoreUpdate("/a/b", 10)
+			hwms.StoreUpdate("/a/c", 11)
+			hwms.StoreUpdate("/ab", 12)
+		})
+
+		It("should delete the whole subtree", func() {
+			Expect(hwms.StoreDeletion("/a", 13)).To(ConsistOf("/a/b", "/a/c"))
+		})
+		It("should forget the deleted keys", func() {
+			hwms.StoreDeletion("/a", 13)
+			Expect(hwms.StoreDeletion("/a", 14)).To(BeEmpty())
+			Expect(hwms.DeleteOldKeys(20)).To(ConsistOf("/ab"))
+		})
+		It("should block older updates while tracking deletions", func() {
+			hwms.StartTrackingDeletions()
+			hwms.StoreDeletion("/a", 13)
+			Expect(hwms.StoreUpdate("/a/b", 12)).To(BeEquivalentTo(13))
+			Expect(hwms.StoreUpdate("/a/d", 14)).To(BeEquivalentTo(0))
+			hwms.StopTrackingDeletions()
+			Expect(hwms.DeleteOldKeys(14)).To(ConsistOf("/ab"))
+		})
+	})
+
+	Describe("StoreValueHash", func() {
+		BeforeEach(func() {
+			hwms.StoreUpdate("/a/b", 10)
+		})
+
+		It("should report a change for a new key", func() {
+			Expect(hwms.StoreValueHash("/a/b", 1234)).To(BeTrue())
+		})
+		It("should report no change for the same hash", func() {
+			hwms.StoreValueHash("/a/b", 1234)
+			hwms.StoreUpdate("/a/b", 11)
+			Expect(hwms.StoreValueHash("/a/b", 1234)).To(BeFalse())
+		})
+		It("should report a change for a different hash", func() {
+			hwms.StoreValueHash("/a/b", 1234)
+			Expect(hwms.StoreValueHash("/a/b", 5678)).To(BeTrue())
+		})
+		It("should forget the hash when the key is deleted", func() {
+			hwms.StoreValueHash("/a/b", 1234)
+			hwms.StoreDeletion("/a", 11)
+			hwms.StoreUpdate("/a/b", 12)
+			Expect(hwms.StoreValueHash("/a/b", 1234)).To(BeTrue())
+		})
+		It("should keep the high watermark", func() {
+			hwms.StoreValueHash("/a/b", 1234)
+			Expect(hwms.StoreUpdate("/a/b", 11)).To(BeEquivalentTo(10))
+		})
+	})
+
+	It("should visit every key", func() {
+		hwms.StoreUpdate("/a/b", 10)
+		hwms.StoreUpdate("/a/c", 11)
+		hwms.StoreUpdate("/a/c", 12)
+		visited := make(map[string]uint64)
+		hwms.VisitKeys(func(key string, hwm uint64) {
+			visited[key] = hwm
+		})
+		Expect(visited).To(Equal(map[string]uint64{"/a/b": 10, "/a/c": 12}))
+	})
+
+	It("should delete only keys older than the limit", func() {
+		hwms.StoreUpdate("/a", 10)
+		hwms.StoreUpdate("/b", 20)
+		hwms.StoreUpdate("/c", 5)
+		Expect(hwms.DeleteOldKeys(15)).To(ConsistOf("/a", "/c"))
+		Expect(hwms.DeleteOldKeys(25)).To(ConsistOf("/b"))
+	})
+})
@@ -0,0 +1,417 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/projectcalico/calico-go/etcd-driver/felix"
+	"github.com/projectcalico/calico-go/etcd-driver/health"
+	"github.com/projectcalico/calico-go/etcd-driver/policy"
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+	"github.com/projectcalico/calico-go/lib/backend"
+)
+
+// felixCallbacks receives updates from the datastore driver and the IP set
+// resolver and converts them to messages for Felix.  It also keeps a copy of
+// the state that it has sent so that it can bring a newly-connected Felix up
+// to date.
+type felixCallbacks struct {
+	toFelix    *felix.UpdateQueue
+	dispatcher *store.Dispatcher
+	// hostname is our hostname, used to filter out per-host keys that
+	// belong to other hosts.
+	hostname string
+	// health tracks the driver status for the health endpoints.
+	health *health.Monitor
+	// prune is true if we only send Felix the policies and profiles that
+	// its endpoints use.
+	prune bool
+
+	// lock protects the cached state below and ensures that messages are
+	// queued in the same order that they're applied to the cache.
+	lock         sync.Mutex
+	configLoaded bool
+	globalConfig map[string]string
+	hostConfig   map[string]string
+	status       store.DriverStatus
+	statusKnown  bool
+	values       map[string]string
+	ipsBySelID   map[string]map[string]int
+	tiersByEP    map[store.EndpointID][]policy.TierPolicies
+	// replaying is true while a replay to a newly-connected Felix is being
+	// queued; replayDone is signalled when it finishes.
+	replaying  bool
+	replayDone *sync.Cond
+
+	// When pruning, activeResources holds the policies and profiles that
+	// are in use on this host and resourceValues holds the keys and
+	// values of every policy and profile, whether or not they've been
+	// sent to Felix.
+	activeResources map[backend.KeyInterface]bool
+	resourceValues  map[backend.KeyInterface]map[string]string
+}
+
+func newFelixCallbacks(toFelix *felix.UpdateQueue, dispatcher *store.Dispatcher, hostname string, monitor *health.Monitor, prune bool) *felixCallbacks {
+	cbs := &felixCallbacks{
+		toFelix:    toFelix,
+		dispatcher: dispatcher,
+		hostname:   hostname,
+		health:     monitor,
+		prune:      prune,
+		values:     make(map[string]string),
+		ipsBySelID: make(map[string]map[string]int),
+		tiersByEP:  make(map[store.EndpointID][]policy.TierPolicies),
+
+		activeResources: make(map[backend.KeyInterface]bool),
+		resourceValues:  make(map[backend.KeyInterface]map[string]string),
+	}
+	cbs.replayDone = sync.NewCond(&cbs.lock)
+	return cbs
+}
+
+// felixReplay holds a copy of the cached state, to be sent to a newly-connected
+// Felix.
+type felixReplay struct {
+	head []felix.Message
+	kvs  []felix.KV
+	tail []felix.Message
+}
+
+// onFelixConnected starts sending to Felix and takes a copy of the cached
+// state to replay to it; Felix is assumed to have no state of its own.  The
+// replay should be passed to replayToFelix once there is a thread writing to
+// Felix.  Until then, the other callbacks wait so that their messages can't
+// overtake the replay.
+func (cbs *felixCallbacks) onFelixConnected() *felixReplay {
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+
+	cbs.toFelix.SetDiscarding(false)
+	cbs.health.OnFelixConnectionChanged(true)
+	if !cbs.configLoaded {
+		// Nothing sent yet, the driver will send everything once it
+		// has loaded the config.
+		return nil
+	}
+	log.Infof("Resyncing Felix: %v keys, %v selectors, %v endpoints",
+		len(cbs.values), len(cbs.ipsBySelID), len(cbs.tiersByEP))
+	replay := &felixReplay{}
+	replay.head = append(replay.head, &felix.ConfigLoadedMsg{
+		Global: cbs.globalConfig,
+		Host:   cbs.hostConfig,
+	})
+	if cbs.statusKnown {
+		replay.head = append(replay.head,
+			&felix.StatusMsg{Status: store.ResyncInProgress})
+		replay.kvs = make([]felix.KV, 0, len(cbs.values))
+		for _, key := range sortedKeys(cbs.values) {
+			value := cbs.values[key]
+			replay.kvs = append(replay.kvs, felix.KV{Key: key, ValueOrNil: &value})
+		}
+		for selID, ips := range cbs.ipsBySelID {
+			replay.tail = append(replay.tail,
+				&felix.SelectorAddedMsg{SelectorID: selID})
+			for ip, ipVersion := range ips {
+				replay.tail = append(replay.tail, &felix.IPAddedMsg{
+					SelectorID: selID,
+					IPVersion:  ipVersion,
+					IP:         ip,
+				})
+			}
+		}
+		for id, tiers := range cbs.tiersByEP {
+			replay.tail = append(replay.tail,
+				&felix.EndpointPolicyMsg{ID: id, Tiers: tiers})
+		}
+		replay.tail = append(replay.tail, &felix.StatusMsg{Status: cbs.status})
+	}
+	cbs.replaying = true
+	return replay
+}
+
+// replayToFelix queues a replay from onFelixConnected.  It doesn't hold the
+// lock while it queues: the replay may be bigger than the queue, in which case
+// it blocks until Felix catches up, or until Felix disconnects and the queue
+// starts discarding.
+func (cbs *felixCallbacks) replayToFelix(replay *felixReplay) {
+	if replay == nil {
+		return
+	}
+	for _, msg := range replay.head {
+		cbs.toFelix.QueueMessage(msg)
+	}
+	for _, kv := range replay.kvs {
+		cbs.toFelix.QueueKV(kv.Key, kv.ValueOrNil)
+	}
+	for _, msg := range replay.tail {
+		cbs.toFelix.QueueMessage(msg)
+	}
+
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+	cbs.replaying = false
+	cbs.replayDone.Broadcast()
+}
+
+// lockForQueueing takes the lock, waiting for any replay to finish first.
+func (cbs *felixCallbacks) lockForQueueing() {
+	cbs.lock.Lock()
+	for cbs.replaying {
+		cbs.replayDone.Wait()
+	}
+}
+
+// onFelixDisconnected discards any queued messages.  They'll be resent, along
+// with everything else, when Felix reconnects.
+func (cbs *felixCallbacks) onFelixDisconnected() {
+	cbs.toFelix.SetDiscarding(true)
+	cbs.health.OnFelixConnectionChanged(false)
+}
+
+// The IP set callbacks are only called by the resolver while it is handling a
+// dispatched update so they run inside OnKeysUpdated, which holds the lock.
+
+func (cbs *felixCallbacks) onSelectorAdded(selID string) {
+	cbs.ipsBySelID[selID] = make(map[string]int)
+	cbs.toFelix.QueueMessage(&felix.SelectorAddedMsg{SelectorID: selID})
+}
+
+func (cbs *felixCallbacks) onSelectorRemoved(selID string) {
+	delete(cbs.ipsBySelID, selID)
+	cbs.toFelix.QueueMessage(&felix.SelectorRemovedMsg{SelectorID: selID})
+}
+
+func (cbs *felixCallbacks) onIPAddedToSelector(selID string, ipVersion int, ip string) {
+	if ips, ok := cbs.ipsBySelID[selID]; ok {
+		ips[ip] = ipVersion
+	}
+	cbs.toFelix.QueueMessage(&felix.IPAddedMsg{
+		SelectorID: selID,
+		IPVersion:  ipVersion,
+		IP:         ip,
+	})
+}
+
+func (cbs *felixCallbacks) onIPRemovedFromSelector(selID string, ipVersion int, ip string) {
+	if ips, ok := cbs.ipsBySelID[selID]; ok {
+		delete(ips, ip)
+	}
+	cbs.toFelix.QueueMessage(&felix.IPRemovedMsg{
+		SelectorID: selID,
+		IPVersion:  ipVersion,
+		IP:         ip,
+	})
+}
+
+// onEndpointTiersUpdate is called by the policy resolver, also from inside
+// OnKeysUpdated.
+func (cbs *felixCallbacks) onEndpointTiersUpdate(key backend.KeyInterface, tiers []policy.TierPolicies) {
+	var id store.EndpointID
+	switch key := key.(type) {
+	case backend.WorkloadEndpointKey:
+		id = store.EndpointID{
+			OrchestratorID: key.OrchestratorID,
+			WorkloadID:     key.WorkloadID,
+			EndpointID:     key.EndpointID,
+		}
+	case backend.HostEndpointKey:
+		id = store.EndpointID{EndpointID: key.EndpointID}
+	}
+	if tiers == nil {
+		delete(cbs.tiersByEP, id)
+	} else {
+		cbs.tiersByEP[id] = tiers
+	}
+	cbs.toFelix.QueueMessage(&felix.EndpointPolicyMsg{ID: id, Tiers: tiers})
+}
+
+func (cbs *felixCallbacks) OnConfigLoaded(globalConfig map[string]string, hostConfig map[string]string) {
+	cbs.lockForQueueing()
+	defer cbs.lock.Unlock()
+	cbs.configLoaded = true
+	cbs.globalConfig, cbs.hostConfig = globalConfig, hostConfig
+	cbs.toFelix.QueueMessage(&felix.ConfigLoadedMsg{
+		Global: globalConfig,
+		Host:   hostConfig,
+	})
+}
+
+// OnConfigChanged tells Felix that its config has changed since it was loaded.
+// Felix applies config at start of day so it needs to restart.
+func (cbs *felixCallbacks) OnConfigChanged(globalConfig map[string]string, hostConfig map[string]string) {
+	cbs.lockForQueueing()
+	defer cbs.lock.Unlock()
+	// A restarted Felix should get the new config.
+	cbs.globalConfig, cbs.hostConfig = globalConfig, hostConfig
+	cbs.toFelix.QueueMessage(&felix.ConfigChangedMsg{
+		Global: globalConfig,
+		Host:   hostConfig,
+	})
+}
+
+func (cbs *felixCallbacks) OnStatusUpdated(status store.DriverStatus) {
+	cbs.lockForQueueing()
+	defer cbs.lock.Unlock()
+	cbs.status, cbs.statusKnown = status, true
+	log.Infof("Datastore status updated to %v", status)
+	cbs.health.OnStatusUpdated(status)
+	cbs.toFelix.QueueMessage(&felix.StatusMsg{Status: status})
+}
+
+func (cbs *felixCallbacks) OnKeysUpdated(updates []store.Update) {
+	cbs.lockForQueueing()
+	defer cbs.lock.Unlock()
+	for _, update := range updates {
+		if len(update.Key) == 0 {
+			log.Errorf("Ignoring update with empty key: %#v", update)
+			continue
+		}
+		var resource backend.KeyInterface
+		if cbs.prune {
+			// Record the new value before dispatching the update,
+			// in case the update activates the resource.
+			resource = prunableResource(update.Key)
+			cbs.storeResourceValue(resource, update.Key, update.ValueOrNil)
+		}
+
+		cbs.dispatcher.DispatchUpdate(&update)
+
+		if cbs.isForOtherHost(update.Key) {
+			// The dispatcher needs to see every host's endpoints
+			// in order to calculate IP sets but Felix only cares
+			// about its own.
+			continue
+		}
+		if resource != nil {
+			// The dispatcher may have rewritten the value.
+			cbs.storeResourceValue(resource, update.Key, update.ValueOrNil)
+			if !cbs.activeResources[resource] {
+				// Not used on this host, hold it back.  If this
+				// update deactivated it, we may still need to
+				// remove it from Felix.
+				if _, ok := cbs.values[update.Key]; ok {
+					cbs.sendKV(update.Key, nil)
+				}
+				continue
+			}
+		}
+		cbs.sendKV(update.Key, update.ValueOrNil)
+	}
+}
+
+// sendKV sends a key/value update to Felix and records it for replay.
+func (cbs *felixCallbacks) sendKV(key string, valueOrNil *string) {
+	if valueOrNil == nil {
+		delete(cbs.values, key)
+	} else {
+		cbs.values[key] = *valueOrNil
+	}
+	cbs.toFelix.QueueKV(key, valueOrNil)
+}
+
+// prunableResource returns the policy or profile that a key belongs to, or nil
+// if the key is always sent to Felix.
+func prunableResource(key string) backend.KeyInterface {
+	if !strings.HasPrefix(key, "/calico/v1/policy/") {
+		// Fast path: not a policy or profile.
+		return nil
+	}
+	switch key := backend.ParseKey(key).(type) {
+	case backend.PolicyKey:
+		return key
+	case backend.ProfileRulesKey:
+		return key.ProfileKey
+	case backend.ProfileTagsKey:
+		return key.ProfileKey
+	case backend.ProfileLabelsKey:
+		return key.ProfileKey
+	}
+	return nil
+}
+
+func (cbs *felixCallbacks) storeResourceValue(resource backend.KeyInterface, key string, valueOrNil *string) {
+	if resource == nil {
+		return
+	}
+	values := cbs.resourceValues[resource]
+	if valueOrNil == nil {
+		delete(values, key)
+		if len(values) == 0 {
+			delete(cbs.resourceValues, resource)
+		}
+		return
+	}
+	if values == nil {
+		values = make(map[string]string)
+		cbs.resourceValues[resource] = values
+	}
+	values[key] = *valueOrNil
+}
+
+// The resource activation callbacks are called by the policy resolver, also
+// from inside OnKeysUpdated.  They're only hooked up when pruning.
+
+// onResourceActive sends Felix a policy or profile that is now in use on this
+// host.
+func (cbs *felixCallbacks) onResourceActive(resource backend.KeyInterface) {
+	log.Debugf("%v now in use, sending it to Felix", resource)
+	cbs.activeResources[resource] = true
+	for key, value := range cbs.resourceValues[resource] {
+		value := value
+		cbs.sendKV(key, &value)
+	}
+}
+
+// onResourceInactive removes a policy or profile that is no longer in use on
+// this host from Felix.
+func (cbs *felixCallbacks) onResourceInactive(resource backend.KeyInterface) {
+	log.Debugf("%v no longer in use, removing it from Felix", resource)
+	delete(cbs.activeResources, resource)
+	for key := range cbs.resourceValues[resource] {
+		if _, ok := cbs.values[key]; ok {
+			cbs.sendKV(key, nil)
+		}
+	}
+}
+
+// isForOtherHost returns true if the key is for a workload endpoint, host
+// endpoint or per-host config that belongs to a host other than ours.
+func (cbs *felixCallbacks) isForOtherHost(key string) bool {
+	if !strings.HasPrefix(key, "/calico/v1/host/") {
+		// Fast path: not a per-host key.
+		return false
+	}
+	switch key := backend.ParseKey(key).(type) {
+	case backend.WorkloadEndpointKey:
+		return key.Hostname != cbs.hostname
+	case backend.HostEndpointKey:
+		return key.Hostname != cbs.hostname
+	case backend.HostConfigKey:
+		return key.Hostname != cbs.hostname
+	}
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/projectcalico/calico-go/etcd-driver/felix"
+	"github.com/projectcalico/calico-go/etcd-driver/health"
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+)
+
+const (
+	testMaxQueued = 10
+	numTestKeys   = 100
+)
+
+type mockDatastore struct{}
+
+func (d *mockDatastore) Start()       {}
+func (d *mockDatastore) ForceResync() {}
+
+// fakeFelix is the Felix end of a connection to the driver.  It uses the JSON
+// codec so that it can decode the messages that only the driver sends.
+type fakeFelix struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (f *fakeFelix) send(msg felix.Message) {
+	codec, _ := felix.LookupCodec("json")
+	Expect(codec.NewEncoder(f.conn).Encode(msg)).To(Succeed())
+}
+
+func (f *fakeFelix) receive() map[string]interface{} {
+	line, err := f.reader.ReadBytes('\n')
+	Expect(err).NotTo(HaveOccurred())
+	var msg map[string]interface{}
+	Expect(json.Unmarshal(line, &msg)).To(Succeed())
+	return msg
+}
+
+// receiveUntilInSync reads messages until the driver reports that it's in
+// sync and returns the keys that it received.
+func (f *fakeFelix) receiveUntilInSync() map[string]bool {
+	keys := make(map[string]bool)
+	for {
+		msg := f.receive()
+		switch msg["type"] {
+		case felix.MsgTypeKVs:
+			for _, kv := range msg["kvs"].([]interface{}) {
+				keys[kv.(map[string]interface{})["k"].(string)] = true
+			}
+		case felix.MsgTypeStatus:
+			if msg["status"] == "in-sync" {
+				return keys
+			}
+		}
+	}
+}
+
+var _ = Describe("felixSession", func() {
+	var toFelix *felix.UpdateQueue
+	var cbs *felixCallbacks
+	var session *felixSession
+
+	BeforeEach(func() {
+		toFelix = felix.NewUpdateQueue(5, 1000, time.Millisecond, testMaxQueued)
+		toFelix.SetDiscarding(true)
+		cbs = newFelixCallbacks(toFelix, store.NewDispatcher(), "myhost",
+			health.NewMonitor(), false)
+		codec, _ := felix.LookupCodec("json")
+		session = &felixSession{
+			callbacks: cbs,
+			datastore: &mockDatastore{},
+			toFelix:   toFelix,
+			codec:     codec,
+			shutdown:  make(chan struct{}),
+		}
+	})
+
+	connect := func() (*fakeFelix, <-chan error) {
+		felixConn, driverConn := net.Pipe()
+		done := make(chan error, 1)
+		go func() {
+			done <- session.serve(driverConn)
+		}()
+		f := &fakeFelix{conn: felixConn, reader: bufio.NewReader(felixConn)}
+		f.send(&felix.InitMsg{
+			ProtocolVersion:    felix.ProtocolVersion,
+			MinProtocolVersion: felix.MinProtocolVersion,
+			Features:           []string{felix.FeatureBatching, felix.FeatureIPSets},
+			Codecs:             []string{"json"},
+		})
+		Expect(f.receive()["type"]).To(Equal(felix.MsgTypeHandshake))
+		return f, done
+	}
+
+	It("should replay more state than fits in the queue on reconnect", func() {
+		// First connection: the driver loads the state.
+		f, done := connect()
+		cbs.OnConfigLoaded(map[string]string{}, map[string]string{})
+		cbs.OnStatusUpdated(store.ResyncInProgress)
+		sent := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(sent)
+			for i := 0; i < numTestKeys; i++ {
+				value := "value"
+				cbs.OnKeysUpdated([]store.Update{{
+					Key:        fmt.Sprintf("/calico/v1/test/%d", i),
+					ValueOrNil: &value,
+				}})
+			}
+			cbs.OnStatusUpdated(store.InSync)
+		}()
+		Expect(f.receiveUntilInSync()).To(HaveLen(numTestKeys))
+		Eventually(sent).Should(BeClosed())
+		f.conn.Close()
+		Eventually(done).Should(Receive())
+
+		// Reconnect, the replay is much bigger than the queue.
+		f, done = connect()
+		Expect(f.receive()["type"]).To(Equal(felix.MsgTypeConfigLoaded))
+		Expect(f.receiveUntilInSync()).To(HaveLen(numTestKeys))
+
+		// Live updates still get through after the replay.
+		updated := make(chan struct{})
+		go func() {
+			defer close(updated)
+			cbs.OnStatusUpdated(store.InSync)
+		}()
+		Expect(f.receive()["status"]).To(Equal("in-sync"))
+		Eventually(updated).Should(BeClosed())
+		f.conn.Close()
+		Eventually(done).Should(Receive())
+	})
+
+	It("should abandon the replay if Felix disconnects part way through", func() {
+		f, done := connect()
+		cbs.OnConfigLoaded(map[string]string{}, map[string]string{})
+		cbs.OnStatusUpdated(store.InSync)
+		f.conn.Close()
+		Eventually(done).Should(Receive())
+
+		// Fill the cache while there's no Felix.
+		for i := 0; i < numTestKeys; i++ {
+			value := "value"
+			cbs.OnKeysUpdated([]store.Update{{
+				Key:        fmt.Sprintf("/calico/v1/test/%d", i),
+				ValueOrNil: &value,
+			}})
+		}
+
+		// Reconnect and hang up without reading the replay.
+		f, done = connect()
+		f.conn.Close()
+		Eventually(done).Should(Receive())
+
+		// The driver callbacks must not be stuck.
+		updated := make(chan struct{})
+		go func() {
+			defer close(updated)
+			cbs.OnStatusUpdated(store.InSync)
+		}()
+		Eventually(updated).Should(BeClosed())
+	})
+})
+
+var _ = Describe("felixCallbacks", func() {
+	var toFelix *felix.UpdateQueue
+	var cbs *felixCallbacks
+
+	BeforeEach(func() {
+		toFelix = felix.NewUpdateQueue(100, 100000, time.Millisecond, 1000)
+		cbs = newFelixCallbacks(toFelix, store.NewDispatcher(), "myhost",
+			health.NewMonitor(), false)
+	})
+
+	// sentKeys returns the keys that have been queued for Felix.
+	sentKeys := func() []string {
+		keys := []string{}
+		for toFelix.Len() > 0 {
+			if msg, ok := toFelix.Next(nil).(*felix.KVsMsg); ok {
+				for _, kv := range msg.KVs {
+					keys = append(keys, kv.Key)
+				}
+			}
+		}
+		return keys
+	}
+
+	It("should only send Felix the per-host keys for its own host", func() {
+		value := "{}"
+		updates := []store.Update{}
+		for _, key := range []string{
+			"/calico/v1/host/myhost/workload/k8s/pod1/endpoint/eth0",
+			"/calico/v1/host/otherhost/workload/k8s/pod2/endpoint/eth0",
+			"/calico/v1/host/myhost/endpoint/eth1",
+			"/calico/v1/host/otherhost/endpoint/eth1",
+			"/calico/v1/host/myhost/config/LogSeverityScreen",
+			"/calico/v1/host/otherhost/config/LogSeverityScreen",
+			"/calico/v1/config/LogSeverityScreen",
+			"/calico/v1/policy/tier/default/policy/p1",
+			"/calico/v1/policy/profile/prof1/rules",
+		} {
+			updates = append(updates, store.Update{Key: key, ValueOrNil: &value})
+		}
+		cbs.OnKeysUpdated(updates)
+		Expect(sentKeys()).To(Equal([]string{
+			"/calico/v1/host/myhost/workload/k8s/pod1/endpoint/eth0",
+			"/calico/v1/host/myhost/endpoint/eth1",
+			"/calico/v1/host/myhost/config/LogSeverityScreen",
+			"/calico/v1/config/LogSeverityScreen",
+			"/calico/v1/policy/tier/default/policy/p1",
+			"/calico/v1/policy/profile/prof1/rules",
+		}))
+	})
+})
@@ -15,199 +15,503 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
 	"github.com/docopt/docopt-go"
 	"github.com/op/go-logging"
-	"github.com/projectcalico/calico-go/etcd-driver/etcd"
+	_ "github.com/projectcalico/calico-go/etcd-driver/etcd"
+	"github.com/projectcalico/calico-go/etcd-driver/felix"
+	_ "github.com/projectcalico/calico-go/etcd-driver/file"
+	"github.com/projectcalico/calico-go/etcd-driver/health"
 	"github.com/projectcalico/calico-go/etcd-driver/ipsets"
+	"github.com/projectcalico/calico-go/etcd-driver/policy"
+	"github.com/projectcalico/calico-go/etcd-driver/recording"
 	"github.com/projectcalico/calico-go/etcd-driver/store"
-	"gopkg.in/vmihailenco/msgpack.v2"
-	"net"
-	"strings"
+	"github.com/projectcalico/calico-go/lib/backend"
+	"github.com/projectcalico/calico-go/lib/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+const version = "0.1"
+
 const usage = `etcd driver.
 
 Usage:
-  etcd-driver <felix-socket>`
+  etcd-driver [options] <felix-socket>
+
+Options:
+  --codec=<CODEC>           The encoding of messages to and from Felix,
+                            "msgpack", "protobuf" or "json".  Felix can ask to
+                            switch to a different one during the handshake.
+                            [default: msgpack]
+  --config=<CONFIG>         Filename containing etcd connection configuration
+                            in YAML or JSON format.  Values from the file
+                            override the ETCD_* environment variables.
+  --datastore-type=<TYPE>   The datastore driver to use, "etcd", "file" or
+                            "replay".  [default: etcd]
+  --file-driver-root=<DIR>  The directory that the "file" datastore driver
+                            loads keys from.
+  --health-listen=<ADDR>    Serve the /liveness, /readiness and /status
+                            health endpoints over HTTP on the given address,
+                            for example ":9099".  A POST to /resync forces a
+                            resync, as does SIGHUP.
+  --hostname=<HOSTNAME>     The hostname of this Felix.  Only workload
+                            endpoints, host endpoints and config for this host
+                            are sent to Felix.  Defaults to the value of the
+                            FELIX_FELIXHOSTNAME environment variable, or the
+                            system hostname if that is not set.
+  --metrics-listen=<ADDR>   Serve Prometheus metrics over HTTP on the given
+                            address, under /metrics.
+  --prune                   Only send Felix the policies that apply to its
+                            endpoints and the profiles that its endpoints
+                            use, rather than every policy and profile.
+  --record=<FILE>           Record every update and status change from the
+                            datastore driver to the given file.
+  --replay-file=<FILE>      The recording that the "replay" datastore driver
+                            replays, in place of a real datastore.
+  --snapshot-page-size=<N>  The number of hosts that the "etcd" datastore
+                            driver loads in parallel when reading a snapshot,
+                            using one goroutine and one etcd request per
+                            host.  It doesn't limit the number of keys per
+                            request; each host's keys are read in one go.
+                            Larger pages load faster but use more memory.
+                            [default: 100]
+  --state-file=<FILE>       Periodically save the "etcd" datastore driver's
+                            state to the given file.  After a restart, the
+                            driver loads the file and resumes watching etcd
+                            from where it left off instead of reading a full
+                            snapshot.
+  --status-interval=<SECS>  How often the "etcd" datastore driver writes this
+                            host's status (uptime, version and sync state) to
+                            /calico/felix/v1/host/<hostname>/status.  0 to
+                            disable.  [default: 30]
+  --status-ttl=<SECS>       The TTL of the status key.  If the driver stops
+                            reporting, the status key expires after this
+                            long.  [default: 90]
+  --endpoint-status-rate=<N>
+                            The maximum number of endpoint status updates
+                            from Felix that the "etcd" datastore driver writes
+                            to etcd per second.  0 to disable endpoint status
+                            reporting.  [default: 100]`
 
 var log = logging.MustGetLogger("etcd-driver")
 
+var felixMessagesSentCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "etcd_driver_felix_messages_sent_total",
+	Help: "Number of messages sent to Felix, by message type.",
+}, []string{"type"})
+
+func init() {
+	prometheus.MustRegister(felixMessagesSentCounter)
+}
+
+const (
+	// Limits on the size of the batches of key/value updates that we
+	// send to Felix.
+	maxBatchKeys  = 1000
+	maxBatchBytes = 1024 * 1024
+	// maxBatchLatency is the longest that we hold back a partial batch,
+	// waiting for more updates.
+	maxBatchLatency = 10 * time.Millisecond
+	// maxQueuedMessages bounds the number of messages and distinct keys
+	// that we queue up while Felix is busy.
+	maxQueuedMessages = 100000
+)
+
 func main() {
 	// Parse command-line args.
-	arguments, err := docopt.Parse(usage, nil, true, "etcd-driver 0.1", false)
+	arguments, err := docopt.Parse(usage, nil, true, "etcd-driver "+version, false)
 	if err != nil {
-		panic(usage)
+		log.Fatalf("Failed to parse command line: %v", err)
 	}
 	felixSckAddr := arguments["<felix-socket>"].(string)
-
-	logging.SetFormatter(logging.GlogFormatter)
-	logging.SetLevel(logging.INFO, "")
-
-	// Connect to Felix.
-	felixConn, err := net.Dial("unix", felixSckAddr)
+	hostname, err := loadHostname(arguments)
+	if err != nil {
+		log.Fatalf("Failed to determine hostname: %v", err)
+	}
+	var configFile *string
+	if cf, ok := arguments["--config"].(string); ok {
+		configFile = &cf
+	}
+	clientConfig, err := client.LoadClientConfig(configFile)
+	if err != nil {
+		log.Fatalf("Failed to load etcd configuration: %v", err)
+	}
+	datastoreType := arguments["--datastore-type"].(string)
+	newDriver, err := store.Lookup(datastoreType)
+	if err != nil {
+		log.Fatalf("Failed to load datastore driver: %v", err)
+	}
+	codec, err := felix.LookupCodec(arguments["--codec"].(string))
 	if err != nil {
-		panic("Failed to connect to felix")
+		log.Fatalf("Invalid --codec: %v", err)
+	}
+	fileDriverRoot, _ := arguments["--file-driver-root"].(string)
+	healthListenAddr, _ := arguments["--health-listen"].(string)
+	metricsListenAddr, _ := arguments["--metrics-listen"].(string)
+	recordFile, _ := arguments["--record"].(string)
+	replayFile, _ := arguments["--replay-file"].(string)
+	stateFile, _ := arguments["--state-file"].(string)
+	statusInterval, err := strconv.Atoi(arguments["--status-interval"].(string))
+	if err != nil || statusInterval < 0 {
+		log.Fatalf("Invalid --status-interval: %v",
+			arguments["--status-interval"])
+	}
+	endpointStatusRate, err := strconv.Atoi(arguments["--endpoint-status-rate"].(string))
+	if err != nil || endpointStatusRate < 0 {
+		log.Fatalf("Invalid --endpoint-status-rate: %v",
+			arguments["--endpoint-status-rate"])
+	}
+	statusTTL, err := strconv.Atoi(arguments["--status-ttl"].(string))
+	if err != nil || statusTTL <= 0 {
+		log.Fatalf("Invalid --status-ttl: %v", arguments["--status-ttl"])
+	}
+	snapshotPageSize, err := strconv.Atoi(arguments["--snapshot-page-size"].(string))
+	if err != nil || snapshotPageSize <= 0 {
+		log.Fatalf("Invalid --snapshot-page-size: %v",
+			arguments["--snapshot-page-size"])
 	}
-	fmt.Println("Felix connection:", felixConn)
 
-	// Wrap Felix socket in msgpack encoder/decoder.
-	felixDecoder := msgpack.NewDecoder(felixConn)
-	felixEncoder := msgpack.NewEncoder(felixConn)
+	logging.SetFormatter(logging.GlogFormatter)
+	logging.SetLevel(logging.INFO, "")
 
-	// Multiple threads need to write to Felix so we use a channel to send
-	// messages to the single writer thread.
-	toFelix := make(chan map[string]interface{})
+	// Multiple threads need to write to Felix so we use a queue to send
+	// messages to the single writer thread.  The queue batches and
+	// coalesces key/value updates.  Until Felix connects, it discards
+	// everything.
+	toFelix := felix.NewUpdateQueue(maxBatchKeys, maxBatchBytes,
+		maxBatchLatency, maxQueuedMessages)
+	toFelix.SetDiscarding(true)
 
 	ipsetResolver := ipsets.NewResolver()
 
 	dispatcher := store.NewDispatcher()
 
 	ipsetResolver.RegisterWith(dispatcher)
+	policyResolver := policy.NewResolver(hostname)
+	policyResolver.RegisterWith(dispatcher)
+
+	// Get a datastore driver
+	monitor := health.NewMonitor()
+	monitor.AddQueue("felix", toFelix.Len)
+	prune := arguments["--prune"].(bool)
+	felixCbs := newFelixCallbacks(toFelix, dispatcher, hostname, monitor, prune)
+	var driverCbs store.Callbacks = felixCbs
+	if recordFile != "" {
+		f, err := os.Create(recordFile)
+		if err != nil {
+			log.Fatalf("Failed to create recording: %v", err)
+		}
+		defer f.Close()
+		log.Infof("Recording driver updates to %v", recordFile)
+		driverCbs = recording.NewRecorder(f, felixCbs)
+	}
+	datastore, err := newDriver(driverCbs, &store.DriverConfiguration{
+		ClientConfig:     *clientConfig,
+		FelixHostname:    hostname,
+		FileDriverRoot:   fileDriverRoot,
+		ReplayFile:       replayFile,
+		SnapshotPageSize: snapshotPageSize,
+		StateFile:        stateFile,
+
+		StatusReportInterval: time.Duration(statusInterval) * time.Second,
+		StatusTTL:            time.Duration(statusTTL) * time.Second,
+		Version:              version,
 
-	// Get an etcd driver
-	felixCbs := &felixCallbacks{
-		toFelix:    toFelix,
-		dispatcher: dispatcher,
+		EndpointStatusRateLimit: endpointStatusRate,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create %v driver: %v", datastoreType, err)
+	}
+	monitor.SetDriver(datastore)
+	if healthListenAddr != "" {
+		go func() {
+			log.Infof("Serving health endpoints on %v", healthListenAddr)
+			err := http.ListenAndServe(healthListenAddr, monitor.Handler())
+			log.Errorf("Health endpoint server failed: %v", err)
+		}()
+	}
+	if metricsListenAddr != "" {
+		go func() {
+			log.Infof("Serving metrics on %v", metricsListenAddr)
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", promhttp.Handler())
+			err := http.ListenAndServe(metricsListenAddr, mux)
+			log.Errorf("Metrics server failed: %v", err)
+		}()
 	}
-	datastore, err := etcd.New(felixCbs, &store.DriverConfiguration{})
 
 	// TODO callback functions or callback interface?
 	ipsetResolver.OnSelectorAdded = felixCbs.onSelectorAdded
 	ipsetResolver.OnSelectorRemoved = felixCbs.onSelectorRemoved
 	ipsetResolver.OnIPAdded = felixCbs.onIPAddedToSelector
 	ipsetResolver.OnIPRemoved = felixCbs.onIPRemovedFromSelector
+	policyResolver.OnEndpointTiersUpdate = felixCbs.onEndpointTiersUpdate
+	if prune {
+		policyResolver.OnPolicyActive = func(key backend.PolicyKey) {
+			felixCbs.onResourceActive(key)
+		}
+		policyResolver.OnPolicyInactive = func(key backend.PolicyKey) {
+			felixCbs.onResourceInactive(key)
+		}
+		policyResolver.OnProfileActive = func(key backend.ProfileKey) {
+			felixCbs.onResourceActive(key)
+		}
+		policyResolver.OnProfileInactive = func(key backend.ProfileKey) {
+			felixCbs.onResourceInactive(key)
+		}
+	}
 
-	// Start background thread to read messages from Felix.
-	go readMessagesFromFelix(felixDecoder, datastore)
+	// Shut down cleanly on SIGTERM/SIGINT.  Resync on SIGHUP.
+	shutdown := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGHUP {
+				log.Info("Received SIGHUP, forcing a resync")
+				datastore.ForceResync()
+				continue
+			}
+			log.Infof("Received %v, shutting down", sig)
+			close(shutdown)
+			return
+		}
+	}()
 
-	// Use main thread for writing to Felix.
-	sendMessagesToFelix(felixEncoder, toFelix)
+	session := &felixSession{
+		callbacks: felixCbs,
+		datastore: datastore,
+		toFelix:   toFelix,
+		codec:     codec,
+		shutdown:  shutdown,
+	}
+	for {
+		// Connect to Felix.
+		felixConn, err := felix.Dial(felixSckAddr, shutdown)
+		if err != nil {
+			break
+		}
+		err = session.serve(felixConn)
+		if err == nil {
+			// Shutting down.
+			break
+		}
+		if err == io.EOF {
+			log.Info("Felix closed the connection, shutting down")
+			break
+		}
+		if _, ok := err.(felix.ErrorIncompatiblePeer); ok {
+			// Reconnecting won't help.
+			log.Errorf("Can't talk to Felix, shutting down: %v", err)
+			break
+		}
+		log.Warningf("Lost connection to Felix, reconnecting: %v", err)
+	}
+	log.Info("Exiting")
 }
 
-type felixCallbacks struct {
-	toFelix    chan<- map[string]interface{}
-	dispatcher *store.Dispatcher
+// loadHostname determines our hostname from the command line, falling back to
+// the environment and then the system hostname.
+func loadHostname(arguments map[string]interface{}) (string, error) {
+	if hostname, ok := arguments["--hostname"].(string); ok && hostname != "" {
+		return hostname, nil
+	}
+	if hostname := os.Getenv("FELIX_FELIXHOSTNAME"); hostname != "" {
+		return hostname, nil
+	}
+	return os.Hostname()
 }
 
-func (cbs *felixCallbacks) onSelectorAdded(selID string) {
-	msg := map[string]interface{}{
-		"type":   "sel_added",
-		"sel_id": selID,
-	}
-	cbs.toFelix <- msg
+// felixSession manages our connections to Felix.
+type felixSession struct {
+	callbacks *felixCallbacks
+	datastore store.Driver
+	toFelix   *felix.UpdateQueue
+	// codec is the codec that we use for the handshake.
+	codec    felix.Codec
+	shutdown <-chan struct{}
+
+	startDatastore sync.Once
 }
 
-func (cbs *felixCallbacks) onSelectorRemoved(selID string) {
-	msg := map[string]interface{}{
-		"type":   "sel_removed",
-		"sel_id": selID,
+// serve handles a single connection to Felix, until either side closes it.
+// Returns nil if we're shutting down, io.EOF if Felix closed the connection,
+// an ErrorIncompatiblePeer if the handshake failed, or the error that caused
+// the connection to fail.
+func (s *felixSession) serve(felixConn net.Conn) error {
+	// All decoders share one buffered reader so that nothing is lost
+	// when we switch codecs after the handshake.
+	reader := bufio.NewReader(felixConn)
+	handshake, err := s.handshake(s.codec.NewDecoder(reader),
+		s.codec.NewEncoder(felixConn))
+	if err != nil {
+		felixConn.Close()
+		return err
 	}
-	cbs.toFelix <- msg
-}
+	codec, err := felix.LookupCodec(handshake.Codec)
+	if err != nil {
+		// Negotiate only picks codecs that we know.
+		log.Panicf("Negotiated unknown codec: %v", err)
+	}
+	log.Infof("Felix connected, protocol version %v, features %v, codec %v",
+		handshake.ProtocolVersion, handshake.Features, codec.Name())
+	felixDecoder := codec.NewDecoder(reader)
+	felixEncoder := codec.NewEncoder(felixConn)
+	replay := s.callbacks.onFelixConnected()
+
+	stopWriter := make(chan struct{})
+	errs := make(chan error, 2)
+	// Start background thread to read messages from Felix.
+	go func() {
+		errs <- s.readMessagesFromFelix(felixDecoder, handshake)
+	}()
+	// And another to write messages to Felix.
+	go func() {
+		errs <- sendMessagesToFelix(felixEncoder, s.toFelix, stopWriter, handshake)
+	}()
+	// The replay may not fit in the queue so we queue it once the writer
+	// is running, in the background so that we notice if the connection
+	// fails part way through.
+	replayDone := make(chan struct{})
+	go func() {
+		defer close(replayDone)
+		s.callbacks.replayToFelix(replay)
+		// Start the driver on the first connection only, it should
+		// trigger OnConfigLoaded.  Start() may block so we don't call
+		// it from this thread.
+		s.startDatastore.Do(func() {
+			go s.datastore.Start()
+		})
+	}()
 
-func (cbs *felixCallbacks) onIPAddedToSelector(selID string, ip string) {
-	msg := map[string]interface{}{
-		"type":   "ip_added",
-		"sel_id": selID,
-		"ip":     ip,
+	numRunning := 2
+	select {
+	case err = <-errs:
+		numRunning--
+	case <-s.shutdown:
 	}
-	cbs.toFelix <- msg
-}
-func (cbs *felixCallbacks) onIPRemovedFromSelector(selID string, ip string) {
-	msg := map[string]interface{}{
-		"type":   "ip_removed",
-		"sel_id": selID,
-		"ip":     ip,
+
+	// Stop the threads and wait for them to finish so that they can't
+	// interfere with the next connection.  Discarding unblocks the
+	// replay.
+	close(stopWriter)
+	felixConn.Close()
+	s.callbacks.onFelixDisconnected()
+	<-replayDone
+	for ; numRunning > 0; numRunning-- {
+		<-errs
 	}
-	cbs.toFelix <- msg
+	return err
 }
 
-func (cbs *felixCallbacks) OnConfigLoaded(globalConfig map[string]string, hostConfig map[string]string) {
-	msg := map[string]interface{}{
-		"type":   "config_loaded",
-		"global": globalConfig,
-		"host":   hostConfig,
+// handshake waits for Felix's init message and replies with the protocol
+// version and features to use or, if we can't talk to Felix, with the reason
+// why.
+func (s *felixSession) handshake(felixDecoder felix.Decoder,
+	felixEncoder felix.Encoder) (*felix.HandshakeMsg, error) {
+	msg, err := felixDecoder.Decode()
+	if err != nil {
+		return nil, err
+	}
+	init, ok := msg.(*felix.InitMsg)
+	if !ok {
+		err = felix.ErrorIncompatiblePeer{Reason: fmt.Sprintf(
+			"expected %q message, got %q", felix.MsgTypeInit, msg.MessageType())}
+	} else {
+		var handshake *felix.HandshakeMsg
+		handshake, err = felix.Negotiate(init, s.features(), s.codec.Name())
+		if err == nil {
+			return handshake, writeMessage(felixEncoder, handshake)
+		}
 	}
-	cbs.toFelix <- msg
+	// Tell Felix why we're rejecting it.  We're about to close the
+	// connection anyway so there's nothing to do if this fails.
+	writeMessage(felixEncoder, &felix.IncompatibleMsg{
+		Reason:             err.(felix.ErrorIncompatiblePeer).Reason,
+		ProtocolVersion:    felix.ProtocolVersion,
+		MinProtocolVersion: felix.MinProtocolVersion,
+	})
+	return nil, err
 }
 
-func (cbs *felixCallbacks) OnStatusUpdated(status store.DriverStatus) {
-	statusString := "unknown"
-	switch status {
-	case store.WaitForDatastore:
-		statusString = "wait-for-ready"
-	case store.InSync:
-		statusString = "in-sync"
-	case store.ResyncInProgress:
-		statusString = "resync"
-	}
-	log.Infof("Datastore status updated to %v: %v", status, statusString)
-	msg := map[string]interface{}{
-		"type":   "stat",
-		"status": statusString,
-	}
-	cbs.toFelix <- msg
+// features returns the optional protocol features that we support.
+func (s *felixSession) features() []string {
+	features := []string{
+		felix.FeatureBatching,
+		felix.FeatureIPSets,
+		felix.FeatureEndpointPolicy,
+	}
+	if _, ok := s.datastore.(store.EndpointStatusReporter); ok {
+		features = append(features, felix.FeatureEndpointStatus)
+	}
+	return features
 }
 
-func (cbs *felixCallbacks) OnKeysUpdated(updates []store.Update) {
-	for _, update := range updates {
-		cbs.dispatcher.DispatchUpdate(&update)
-		var msg map[string]interface{}
-		if len(update.Key) == 0 {
-			panic("Empty key")
+func (s *felixSession) readMessagesFromFelix(felixDecoder felix.Decoder,
+	handshake *felix.HandshakeMsg) error {
+	for {
+		msg, err := felixDecoder.Decode()
+		if _, ok := err.(felix.ErrorMalformedMessage); ok {
+			log.Errorf("Ignoring message: %v", err)
+			continue
 		}
-
-		if strings.Index(update.Key, "/calico/v1/host/") == 0 {
-			if strings.Contains(update.Key, "/endpoint/") {
-				if !strings.Contains(update.Key, "smc-ubuntu") {
-					continue
-				}
-			}
+		if err != nil {
+			return err
 		}
-
-		if update.ValueOrNil == nil {
-			msg = map[string]interface{}{
-				"type": "u",
-				"k":    update.Key,
-				"v":    nil,
-			}
-		} else {
-			// Deref the value so that we get better diags if the
-			// message is traced out.
-			msg = map[string]interface{}{
-				"type": "u",
-				"k":    update.Key,
-				"v":    *update.ValueOrNil,
+		switch msg := msg.(type) {
+		case *felix.ResyncMsg: // Felix suspects that it's out of sync
+			log.Info("Felix requested a resync")
+			s.datastore.ForceResync()
+		case *felix.EndpointStatusMsg: // Felix has (re)programmed an endpoint
+			if !handshake.HasFeature(felix.FeatureEndpointStatus) {
+				log.Warningf("Ignoring status of %v, endpoint status "+
+					"wasn't negotiated", msg.ID)
+				continue
 			}
+			reporter := s.datastore.(store.EndpointStatusReporter)
+			reporter.ReportEndpointStatus(msg.ID, msg.StatusOrNil)
+		default:
+			log.Warningf("Unexpected message from Felix: %#v", msg)
 		}
-		cbs.toFelix <- msg
 	}
 }
 
-func readMessagesFromFelix(felixDecoder *msgpack.Decoder, datastore store.Driver) {
+// sendMessagesToFelix writes queued messages to Felix until the stop channel is
+// closed (in which case it returns nil) or a write fails.  Messages are adapted
+// to the features negotiated in the handshake.
+func sendMessagesToFelix(felixEncoder felix.Encoder,
+	toFelix *felix.UpdateQueue, stop <-chan struct{},
+	handshake *felix.HandshakeMsg) error {
 	for {
-		msg, err := felixDecoder.DecodeMap()
-		if err != nil {
-			panic("Error reading from felix")
+		msg := toFelix.Next(stop)
+		if msg == nil {
+			return nil
 		}
-		msgType := msg.(map[interface{}]interface{})["type"].(string)
-		switch msgType {
-		case "init": // Hello message from felix
-			datastore.Start() // Should trigger OnConfigLoaded.
-		default:
-			fmt.Println("XXXX Unknown message from felix:", msg)
+		for _, msg := range handshake.Adapt(msg) {
+			if err := writeMessage(felixEncoder, msg); err != nil {
+				return err
+			}
 		}
 	}
 }
 
-func sendMessagesToFelix(felixEncoder *msgpack.Encoder,
-	toFelix <-chan map[string]interface{}) {
-	for {
-		msg := <-toFelix
-		log.Debugf("Writing msg to felix: %#v\n", msg)
-		if err := felixEncoder.Encode(msg); err != nil {
-			panic("Failed to send message to felix")
-		}
+func writeMessage(felixEncoder felix.Encoder, msg felix.Message) error {
+	log.Debugf("Writing msg to felix: %#v\n", msg)
+	if err := felixEncoder.Encode(msg); err != nil {
+		return err
 	}
+	felixMessagesSentCounter.WithLabelValues(msg.MessageType()).Inc()
+	return nil
 }
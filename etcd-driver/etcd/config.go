@@ -0,0 +1,70 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/coreos/etcd/client"
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+	"golang.org/x/net/context"
+)
+
+// loadConfig reads the global and per-host Felix config from etcd, retrying
+// until etcd is available.
+func (driver *etcdDriver) loadConfig() *store.FelixConfig {
+	kapi := driver.snapshotKeysAPI
+	hostname := driver.config.FelixHostname
+	for {
+		global, err := readConfigDir(kapi, "/calico/v1/config")
+		if err != nil {
+			log.Warning("Error loading global config, retrying...", err)
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		host, err := readConfigDir(kapi,
+			fmt.Sprintf("/calico/v1/host/%s/config", hostname))
+		if err != nil {
+			log.Warning("Error loading host config, retrying...", err)
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		log.Infof("Loaded config; global: %v, host %v: %v",
+			global, hostname, host)
+		return store.NewFelixConfig(hostname, global, host)
+	}
+}
+
+// readConfigDir reads the config parameters stored in the given directory.  A
+// missing directory is treated as empty.
+func readConfigDir(kapi client.KeysAPI, dir string) (map[string]string, error) {
+	config := make(map[string]string)
+	resp, err := kapi.Get(context.Background(), dir, &client.GetOptions{})
+	if err != nil {
+		if err, ok := err.(client.Error); ok && err.Code == client.ErrorCodeKeyNotFound {
+			return config, nil
+		}
+		return nil, err
+	}
+	for _, node := range resp.Node.Nodes {
+		if node.Dir {
+			continue
+		}
+		config[path.Base(node.Key)] = node.Value
+	}
+	return config, nil
+}
@@ -0,0 +1,227 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/client"
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+	"github.com/projectcalico/calico-go/lib/backend"
+	"golang.org/x/net/context"
+)
+
+// defaultEndpointStatusCleanupDelay is how long we give Felix to report the
+// status of all its endpoints, after we come into sync, before we delete the
+// statuses that it hasn't reported.
+const defaultEndpointStatusCleanupDelay = 30 * time.Second
+
+// matchEndpointStatus matches the endpoint status keys under a host's status
+// directory, as opposed to the host's own status.
+var matchEndpointStatus = regexp.MustCompile("^/(endpoint/[^/]+|workload/[^/]+/[^/]+/endpoint/[^/]+)$")
+
+// endpointStatusWriter writes the endpoint statuses that Felix reports to
+// etcd, under /calico/felix/v1/host/<hostname>.  Updates are coalesced by key
+// and written at a limited rate so that a burst of status changes, for
+// example when Felix starts, doesn't overload etcd.
+type endpointStatusWriter struct {
+	kapi client.KeysAPI
+	// hostDir is the directory that holds this host's statuses.
+	hostDir string
+	// writeInterval is the minimum time between writes.
+	writeInterval time.Duration
+	cleanupDelay  time.Duration
+
+	lock sync.Mutex
+	// pending maps from etcd key to the value to write, or nil to delete
+	// the key.
+	pending map[string]*string
+	// reported holds the keys that Felix has reported a status for since
+	// we started.  Any other endpoint status keys are stale.
+	reported map[string]bool
+
+	wakeup          chan struct{}
+	cleanupRequests chan struct{}
+}
+
+func newEndpointStatusWriter(kapi client.KeysAPI, config *store.DriverConfiguration) *endpointStatusWriter {
+	cleanupDelay := config.EndpointStatusCleanupDelay
+	if cleanupDelay <= 0 {
+		cleanupDelay = defaultEndpointStatusCleanupDelay
+	}
+	return &endpointStatusWriter{
+		kapi:            kapi,
+		hostDir:         fmt.Sprintf("/calico/felix/v1/host/%s", config.FelixHostname),
+		writeInterval:   time.Second / time.Duration(config.EndpointStatusRateLimit),
+		cleanupDelay:    cleanupDelay,
+		pending:         make(map[string]*string),
+		reported:        make(map[string]bool),
+		wakeup:          make(chan struct{}, 1),
+		cleanupRequests: make(chan struct{}, 1),
+	}
+}
+
+func (w *endpointStatusWriter) keyFor(id store.EndpointID) string {
+	if id.IsHostEndpoint() {
+		return fmt.Sprintf("%s/endpoint/%s", w.hostDir, id.EndpointID)
+	}
+	return fmt.Sprintf("%s/workload/%s/%s/endpoint/%s", w.hostDir,
+		id.OrchestratorID, id.WorkloadID, id.EndpointID)
+}
+
+// report queues a write of the given endpoint status, replacing any write
+// that is already queued for the same endpoint.
+func (w *endpointStatusWriter) report(id store.EndpointID, statusOrNil *string) {
+	key := w.keyFor(id)
+	var valueOrNil *string
+	if statusOrNil != nil {
+		data, err := json.Marshal(backend.EndpointStatus{Status: *statusOrNil})
+		if err != nil {
+			log.Fatalf("Failed to marshal endpoint status: %v", err)
+		}
+		value := string(data)
+		valueOrNil = &value
+	}
+
+	w.lock.Lock()
+	if valueOrNil != nil {
+		w.reported[key] = true
+	} else {
+		delete(w.reported, key)
+	}
+	w.pending[key] = valueOrNil
+	w.lock.Unlock()
+
+	select {
+	case w.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// scheduleCleanup asks the writer to delete any stale statuses after the
+// cleanup delay.
+func (w *endpointStatusWriter) scheduleCleanup() {
+	select {
+	case w.cleanupRequests <- struct{}{}:
+	default:
+	}
+}
+
+func (w *endpointStatusWriter) loop() {
+	var cleanupTimer <-chan time.Time
+	for {
+		select {
+		case <-w.wakeup:
+		case <-w.cleanupRequests:
+			cleanupTimer = time.After(w.cleanupDelay)
+			continue
+		case <-cleanupTimer:
+			cleanupTimer = nil
+			w.queueStaleDeletions()
+		}
+		w.writePending()
+	}
+}
+
+// writePending writes queued updates until there are none left.
+func (w *endpointStatusWriter) writePending() {
+	for {
+		w.lock.Lock()
+		var key string
+		var valueOrNil *string
+		found := false
+		for key, valueOrNil = range w.pending {
+			found = true
+			break
+		}
+		if !found {
+			w.lock.Unlock()
+			return
+		}
+		delete(w.pending, key)
+		w.lock.Unlock()
+
+		var err error
+		if valueOrNil != nil {
+			_, err = w.kapi.Set(context.Background(), key, *valueOrNil, nil)
+		} else {
+			_, err = w.kapi.Delete(context.Background(), key, nil)
+			if etcdErr, ok := err.(client.Error); ok && etcdErr.Code == client.ErrorCodeKeyNotFound {
+				err = nil
+			}
+		}
+		if err != nil {
+			log.Warningf("Failed to write endpoint status %v, retrying: %v",
+				key, err)
+			w.lock.Lock()
+			if _, ok := w.pending[key]; !ok {
+				// Not superseded by a newer update.
+				w.pending[key] = valueOrNil
+			}
+			w.lock.Unlock()
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		endpointStatusWritesCounter.Inc()
+		time.Sleep(w.writeInterval)
+	}
+}
+
+// queueStaleDeletions queues the deletion of any endpoint statuses in etcd
+// that Felix hasn't reported since we started; they must be left over from a
+// previous run.
+func (w *endpointStatusWriter) queueStaleDeletions() {
+	resp, err := w.kapi.Get(context.Background(), w.hostDir,
+		&client.GetOptions{Recursive: true})
+	if err != nil {
+		if etcdErr, ok := err.(client.Error); ok && etcdErr.Code == client.ErrorCodeKeyNotFound {
+			return
+		}
+		log.Warningf("Failed to list endpoint statuses, will retry: %v", err)
+		w.scheduleCleanup()
+		return
+	}
+	var existingKeys []string
+	var findKeys func(node *client.Node)
+	findKeys = func(node *client.Node) {
+		if !node.Dir {
+			existingKeys = append(existingKeys, node.Key)
+		}
+		for _, child := range node.Nodes {
+			findKeys(child)
+		}
+	}
+	findKeys(resp.Node)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	numStale := 0
+	for _, key := range existingKeys {
+		if len(key) <= len(w.hostDir) ||
+			!matchEndpointStatus.MatchString(key[len(w.hostDir):]) {
+			continue
+		}
+		if _, ok := w.pending[key]; ok || w.reported[key] {
+			continue
+		}
+		w.pending[key] = nil
+		numStale++
+	}
+	log.Infof("Deleting %v stale endpoint statuses", numStale)
+}
@@ -15,147 +15,457 @@
 package etcd
 
 import (
+	"hash/fnv"
+	"math"
+	"sync"
+	"sync/atomic"
+
 	"github.com/projectcalico/calico-go/datastructures/hwm"
 	"github.com/projectcalico/calico-go/etcd-driver/store"
+	"github.com/projectcalico/calico-go/lib/backend"
 	"time"
 
 	"github.com/coreos/etcd/client"
 	"github.com/op/go-logging"
+	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/net/context"
 )
 
 var log = logging.MustGetLogger("store.etcd")
 
+var (
+	watcherEventsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "etcd_driver_watcher_events_total",
+		Help: "Number of events received from the etcd watcher, by action.",
+	}, []string{"action"})
+	snapshotReadsCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "etcd_driver_snapshot_reads_total",
+		Help: "Number of snapshots read from etcd.",
+	})
+	resyncsCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "etcd_driver_resyncs_total",
+		Help: "Number of times that the watcher lost sync with etcd.",
+	})
+	deletedOldKeysCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "etcd_driver_snapshot_deleted_keys_total",
+		Help: "Number of keys found to be deleted by comparing a snapshot with our cache.",
+	})
+	forcedResyncsCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "etcd_driver_forced_resyncs_total",
+		Help: "Number of resyncs requested through ForceResync.",
+	})
+	suppressedUpdatesCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "etcd_driver_suppressed_updates_total",
+		Help: "Number of updates not sent because they didn't change the key's value.",
+	})
+	endpointStatusWritesCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "etcd_driver_endpoint_status_writes_total",
+		Help: "Number of endpoint status updates written to etcd.",
+	})
+	etcdEventsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "etcd_driver_etcd_events_queue_depth",
+		Help: "Number of watcher events waiting to be processed.",
+	})
+)
+
 func init() {
 	store.Register("etcd", New)
+	prometheus.MustRegister(
+		watcherEventsCounter,
+		snapshotReadsCounter,
+		resyncsCounter,
+		deletedOldKeysCounter,
+		forcedResyncsCounter,
+		suppressedUpdatesCounter,
+		endpointStatusWritesCounter,
+		etcdEventsGauge,
+	)
 }
 
+const (
+	// maxUpdatesPerBatch bounds the number of updates that the merge
+	// thread accumulates before passing them to the callbacks.
+	maxUpdatesPerBatch = 1000
+
+	snapshotTimeout = 10 * time.Second
+	// Set a short timeout for the watcher so that we fail fast when the
+	// target endpoint is unavailable.
+	watcherTimeout = 1 * time.Second
+
+	// persistInterval is how often we save our state, if it has
+	// changed and a state file is configured.
+	persistInterval = 10 * time.Second
+	// catchUpProbeTimeout is how long the watcher waits for an event
+	// while it's catching up after a restart.  etcd returns the events
+	// that it already has immediately so, if none arrives, there are no
+	// more to catch up on.
+	catchUpProbeTimeout = 1 * time.Second
+
+	// defaultSnapshotPageSize is the number of hosts that we read in
+	// parallel while loading a snapshot, if not configured.
+	defaultSnapshotPageSize = 100
+)
+
 func New(callbacks store.Callbacks, config *store.DriverConfiguration) (store.Driver, error) {
+	// The snapshot and watcher threads each get their own client since
+	// they need different timeouts.
+	snapshotClient, err := backend.NewEtcdClient(&config.ClientConfig, snapshotTimeout)
+	if err != nil {
+		return nil, err
+	}
+	watcherClient, err := backend.NewEtcdClient(&config.ClientConfig, watcherTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithKeysAPIs(callbacks, config,
+		client.NewKeysAPI(snapshotClient),
+		client.NewKeysAPI(watcherClient)), nil
+}
+
+// NewWithKeysAPIs creates a driver that uses the given KeysAPIs for reading
+// snapshots (and config) and for watching etcd respectively.
+func NewWithKeysAPIs(callbacks store.Callbacks, config *store.DriverConfiguration,
+	snapshotKeysAPI, watcherKeysAPI client.KeysAPI) store.Driver {
+	pageSize := config.SnapshotPageSize
+	if pageSize <= 0 {
+		pageSize = defaultSnapshotPageSize
+	}
+	var endpointStatus *endpointStatusWriter
+	if config.EndpointStatusRateLimit > 0 {
+		endpointStatus = newEndpointStatusWriter(snapshotKeysAPI, config)
+	}
 	return &etcdDriver{
-		callbacks: callbacks,
-		config:    config,
-	}, nil
+		endpointStatus:    endpointStatus,
+		callbacks:         callbacks,
+		config:            config,
+		snapshotPageSize:  pageSize,
+		snapshotKeysAPI:   snapshotKeysAPI,
+		watcherKeysAPI:    watcherKeysAPI,
+		etcdEvents:        make(chan event, 20000),
+		snapshotUpdates:   make(chan event),
+		snapshotRequested: make(chan struct{}, 1),
+		forceResync:       make(chan struct{}, 1),
+		statusChanged:     make(chan struct{}, 1),
+	}
 }
 
 type etcdDriver struct {
 	callbacks store.Callbacks
 	config    *store.DriverConfiguration
+
+	// snapshotPageSize is the number of hosts that the snapshot thread
+	// reads in parallel.
+	snapshotPageSize int
+
+	// snapshotKeysAPI is used to load config and read snapshots.
+	snapshotKeysAPI client.KeysAPI
+	// watcherKeysAPI is used by the watcher thread.
+	watcherKeysAPI client.KeysAPI
+
+	// felixConfig is the config that we loaded at start of day.  Owned
+	// by the merge thread once it has started.
+	felixConfig *store.FelixConfig
+
+	// etcdEvents carries events from the watcher thread to the merge
+	// thread, snapshotUpdates carries snapshots from the snapshot thread.
+	etcdEvents      chan event
+	snapshotUpdates chan event
+	// snapshotIndex is the index of the last snapshot that the merge
+	// thread processed.  Accessed atomically.
+	snapshotIndex uint64
+
+	// The merge thread asks the snapshot thread for a snapshot by
+	// raising minSnapshotIndex and then signalling snapshotRequested.
+	snapshotLock      sync.Mutex
+	minSnapshotIndex  uint64
+	snapshotRequested chan struct{}
+
+	// forceResync is signalled to ask the merge thread for a forced
+	// resync.
+	forceResync chan struct{}
+
+	// startTime is when the driver was started, status is the current
+	// store.DriverStatus, accessed atomically.  The merge thread signals
+	// statusChanged when it updates the status.
+	startTime     time.Time
+	status        uint32
+	statusChanged chan struct{}
+
+	// endpointStatus writes Felix's endpoint statuses to etcd, nil if
+	// endpoint status reporting is disabled.
+	endpointStatus *endpointStatusWriter
 }
 
 func (driver *etcdDriver) Start() {
+	driver.startTime = time.Now()
+	if driver.config.StatusReportInterval > 0 {
+		// Report our status to etcd so that it's possible to tell
+		// which hosts are alive.
+		go driver.reportStatus()
+	}
+	if driver.endpointStatus != nil {
+		go driver.endpointStatus.loop()
+	}
+
+	// Load the config before we start the resync so that Felix can
+	// configure itself before it receives any updates.
+	log.Info("Loading config")
+	driver.felixConfig = driver.loadConfig()
+	driver.callbacks.OnConfigLoaded(driver.felixConfig.CopyMaps())
+
+	// If we saved our state before we were restarted, the watcher can
+	// resume from where we left off, skipping the start-of-day snapshot.
+	log.Info("Starting etcd driver")
+	initialSnapshotIndex := make(chan uint64, 1)
+	var restored *persistedState
+	if driver.config.StateFile != "" {
+		var err error
+		restored, err = loadState(driver.config.StateFile)
+		if err != nil {
+			log.Warningf("Failed to load state from %v, will resync: %v",
+				driver.config.StateFile, err)
+			restored = nil
+		} else {
+			log.Infof("Loaded %v keys from %v, resuming from index %v",
+				len(restored.Keys), driver.config.StateFile, restored.Index)
+		}
+	}
+
 	// Start a background thread to read events from etcd.  It will
 	// queue events onto the etcdEvents channel.  If it drops out of sync,
-	// it will signal on the resyncIndex channel.
-	log.Info("Starting etcd driver")
-	etcdEvents := make(chan event, 20000)
-	triggerResync := make(chan uint64, 5)
-	initialSnapshotIndex := make(chan uint64)
-	go driver.watchEtcd(etcdEvents, triggerResync, initialSnapshotIndex)
-
-	// Start a background thread to read snapshots from etcd.  It will
-	// read a start-of-day snapshot and then wait to be signalled on the
-	// resyncIndex channel.
-	snapshotUpdates := make(chan event)
-	go driver.readSnapshotsFromEtcd(snapshotUpdates, triggerResync, initialSnapshotIndex)
-
-	go driver.mergeUpdates(snapshotUpdates, etcdEvents)
-
-	// TODO actually send some config
-	driver.callbacks.OnConfigLoaded(
-		map[string]string{
-			"InterfacePrefix": "cali",
+	// it queues an event to tell the merge thread to start a resync.
+	go driver.watchEtcd(driver.etcdEvents, initialSnapshotIndex, restored != nil)
+	if restored != nil {
+		initialSnapshotIndex <- restored.Index
+		close(initialSnapshotIndex)
+		initialSnapshotIndex = nil
+	}
+
+	// Start a background thread to read snapshots from etcd.  It reads
+	// a snapshot each time that the merge thread requests one.
+	go driver.readSnapshotsFromEtcd(driver.snapshotUpdates, initialSnapshotIndex)
+
+	// The merge thread coordinates resyncs, starting with the
+	// start-of-day snapshot, if needed.
+	go driver.mergeUpdates(driver.snapshotUpdates, driver.etcdEvents, restored)
+}
+
+// ForceResync asks the driver to re-read the snapshot from etcd.  All the keys
+// in the snapshot are resent, unless we've already seen a newer update, and
+// keys that are no longer present are deleted.
+func (driver *etcdDriver) ForceResync() {
+	select {
+	case driver.forceResync <- struct{}{}:
+		log.Info("Forced resync requested")
+	default:
+		log.Info("Forced resync already pending")
+	}
+}
+
+// ReportEndpointStatus implements store.EndpointStatusReporter.
+func (driver *etcdDriver) ReportEndpointStatus(id store.EndpointID, statusOrNil *string) {
+	if driver.endpointStatus == nil {
+		log.Debugf("Endpoint status reporting disabled, ignoring status of %v", id)
+		return
+	}
+	driver.endpointStatus.report(id, statusOrNil)
+}
+
+// Stats implements store.StatsReporter.
+func (driver *etcdDriver) Stats() store.DriverStats {
+	return store.DriverStats{
+		SnapshotIndex: atomic.LoadUint64(&driver.snapshotIndex),
+		QueueDepths: map[string]int{
+			"etcdEvents":      len(driver.etcdEvents),
+			"snapshotUpdates": len(driver.snapshotUpdates),
 		},
-		map[string]string{},
-	)
+	}
 }
 
 const (
 	actionSet uint8 = iota
 	actionDel
 	actionSnapFinished
+	// actionResyncStarting is sent by the watcher when it loses sync
+	// with etcd.  snapshotIndex holds the index that the new watcher
+	// starts from.
+	actionResyncStarting
+	// actionCaughtUp is sent by the watcher, after we resume from saved
+	// state, once it has sent every event up to etcd's index at start of
+	// day.
+	actionCaughtUp
 )
 
 // TODO Split this into different types of struct and use a type-switch to unpack.
 type event struct {
-	action           uint8
-	modifiedIndex    uint64
-	snapshotIndex    uint64
-	key              string
-	valueOrNil       string
-	snapshotStarting bool
-	snapshotFinished bool
+	action        uint8
+	modifiedIndex uint64
+	snapshotIndex uint64
+	key           string
+	valueOrNil    string
 }
 
-func (driver *etcdDriver) readSnapshotsFromEtcd(snapshotUpdates chan<- event, triggerResync <-chan uint64, initialSnapshotIndex chan<- uint64) {
-	cfg := client.Config{
-		Endpoints:               []string{"http://127.0.0.1:2379"},
-		Transport:               client.DefaultTransport,
-		HeaderTimeoutPerRequest: 10 * time.Second,
+// requestSnapshot asks the snapshot thread for a snapshot with an index of at
+// least minIndex.  Doesn't block.
+func (driver *etcdDriver) requestSnapshot(minIndex uint64) {
+	driver.snapshotLock.Lock()
+	if minIndex > driver.minSnapshotIndex {
+		driver.minSnapshotIndex = minIndex
 	}
-	c, err := client.New(cfg)
-	if err != nil {
-		log.Fatal(err)
-	}
-	kapi := client.NewKeysAPI(c)
-	getOpts := client.GetOptions{
-		Recursive: true,
-		Sort:      false,
-		Quorum:    false,
+	driver.snapshotLock.Unlock()
+	select {
+	case driver.snapshotRequested <- struct{}{}:
+	default:
+		// Already signalled, the snapshot thread will pick up the
+		// new index.
 	}
+}
+
+// readSnapshotsFromEtcd reads a snapshot each time that the merge thread asks
+// for one.  It sends the index of the first snapshot to initialSnapshotIndex,
+// if non-nil, so that the watcher can start from there.
+func (driver *etcdDriver) readSnapshotsFromEtcd(snapshotUpdates chan<- event, initialSnapshotIndex chan<- uint64) {
 	var highestSnapshotIndex uint64
-	var minIndex uint64
 
 	for {
-		if highestSnapshotIndex > 0 {
-			// Wait for the watcher thread to tell us what index
-			// it starts from.  We need to load a snapshot with
-			// an equal or later index, otherwise we could miss
-			// some updates.  (Since we may connect to a follower
-			// server, it's possible, if unlikely, for us to read
-			// a stale snapshot.)
-			minIndex = <-triggerResync
-			log.Infof("Asked for snapshot > %v; last snapshot was %v",
-				minIndex, highestSnapshotIndex)
-			if highestSnapshotIndex >= minIndex {
-				// We've already read a newer snapshot, no
-				// need to re-read.
-				log.Info("Snapshot already new enough")
-				continue
-			}
+		<-driver.snapshotRequested
+		// We need to load a snapshot with an equal or later index
+		// than requested, otherwise we could miss some updates.  (Since
+		// we may connect to a follower server, it's possible, if
+		// unlikely, for us to read a stale snapshot.)
+		driver.snapshotLock.Lock()
+		minIndex := driver.minSnapshotIndex
+		driver.snapshotLock.Unlock()
+		log.Infof("Asked for snapshot >= %v; last snapshot was %v",
+			minIndex, highestSnapshotIndex)
+
+		snapshotIndex := driver.readSnapshot(snapshotUpdates, minIndex)
+		snapshotReadsCounter.Inc()
+		snapshotUpdates <- event{
+			action:        actionSnapFinished,
+			snapshotIndex: snapshotIndex,
+		}
+		if initialSnapshotIndex != nil {
+			// First snapshot, the watcher is waiting for it.
+			initialSnapshotIndex <- snapshotIndex
+			close(initialSnapshotIndex)
+			initialSnapshotIndex = nil
+		}
+		if snapshotIndex > highestSnapshotIndex {
+			highestSnapshotIndex = snapshotIndex
 		}
+	}
+}
 
-	readRetryLoop:
-		for {
-			resp, err := kapi.Get(context.Background(),
-				"/calico/v1", &getOpts)
-			if err != nil {
-				log.Warning("Error getting snapshot, retrying...", err)
-				time.Sleep(1 * time.Second)
-				continue readRetryLoop
-			}
+// readSnapshot streams a snapshot of /calico/v1 to the merge thread and
+// returns its index.
+//
+// Reading the whole tree in one request needs a lot of memory (and may time
+// out) in a large deployment so the snapshot is read one subtree at a time:
+// first the config and other global data, then the policies and profiles and
+// finally the hosts, snapshotPageSize hosts at a time.  Each subtree is sent
+// to the merge thread as soon as it has been read.
+//
+// Each read may see a different etcd index.  Every key is sent with the index
+// of the read that loaded it and the snapshot as a whole takes the lowest of
+// those indexes.  The watcher starts from that index so any change that one
+// read saw and another missed also arrives from the watcher, where the merge
+// thread's high-water marks reconcile the two.
+func (driver *etcdDriver) readSnapshot(snapshotUpdates chan<- event, minIndex uint64) uint64 {
+	snapshotIndex := uint64(math.MaxUint64)
+	send := func(resp *client.Response) {
+		if resp.Index < snapshotIndex {
+			snapshotIndex = resp.Index
+		}
+		sendNode(resp.Node, snapshotUpdates, resp)
+	}
 
-			if resp.Index < minIndex {
-				log.Info("Retrieved stale snapshot, rereading...")
-				continue readRetryLoop
+	root := driver.getSnapshotSubtree("/calico/v1", false, minIndex)
+	if root.Index < snapshotIndex {
+		snapshotIndex = root.Index
+	}
+	var subtrees, policySubtrees []string
+	var hostsListed bool
+	for _, child := range root.Node.Nodes {
+		switch {
+		case !child.Dir:
+			send(&client.Response{Index: root.Index, Node: child})
+		case child.Key == "/calico/v1/host":
+			hostsListed = true
+		case child.Key == "/calico/v1/policy":
+			policy := driver.getSnapshotSubtree(child.Key, false, minIndex)
+			for _, policyChild := range policy.Node.Nodes {
+				policySubtrees = append(policySubtrees, policyChild.Key)
 			}
+		default:
+			subtrees = append(subtrees, child.Key)
+		}
+	}
+	for _, key := range append(subtrees, policySubtrees...) {
+		send(driver.getSnapshotSubtree(key, true, minIndex))
+	}
+	if !hostsListed {
+		return snapshotIndex
+	}
 
-			// If we get here, we should have a good
-			// snapshot.  Send it to the merge thread.
-			sendNode(resp.Node, snapshotUpdates, resp)
-			snapshotUpdates <- event{
-				action:        actionSnapFinished,
-				snapshotIndex: resp.Index,
-			}
-			if resp.Index > highestSnapshotIndex {
-				if highestSnapshotIndex == 0 {
-					initialSnapshotIndex <- resp.Index
-					close(initialSnapshotIndex)
-				}
-				highestSnapshotIndex = resp.Index
-			}
-			break readRetryLoop
+	hosts := driver.getSnapshotSubtree("/calico/v1/host", false, minIndex)
+	var hostKeys []string
+	for _, host := range hosts.Node.Nodes {
+		hostKeys = append(hostKeys, host.Key)
+	}
+	for len(hostKeys) > 0 {
+		pageSize := driver.snapshotPageSize
+		if pageSize > len(hostKeys) {
+			pageSize = len(hostKeys)
+		}
+		page := make([]*client.Response, pageSize)
+		var wg sync.WaitGroup
+		for i, key := range hostKeys[:pageSize] {
+			wg.Add(1)
+			go func(i int, key string) {
+				defer wg.Done()
+				page[i] = driver.getSnapshotSubtree(key, true, minIndex)
+			}(i, key)
+		}
+		wg.Wait()
+		for _, resp := range page {
+			send(resp)
+		}
+		hostKeys = hostKeys[pageSize:]
+	}
+	return snapshotIndex
+}
 
+// getSnapshotSubtree reads the given key from etcd, retrying until it gets a
+// response with an index of at least minIndex.  A missing key is returned as
+// an empty directory since it may have been deleted since we listed its
+// parent.
+func (driver *etcdDriver) getSnapshotSubtree(key string, recursive bool, minIndex uint64) *client.Response {
+	getOpts := client.GetOptions{
+		Recursive: recursive,
+		Sort:      !recursive,
+		Quorum:    false,
+	}
+	for {
+		resp, err := driver.snapshotKeysAPI.Get(context.Background(),
+			key, &getOpts)
+		if etcdErr, ok := err.(client.Error); ok && etcdErr.Code == client.ErrorCodeKeyNotFound {
+			resp = &client.Response{
+				Index: etcdErr.Index,
+				Node:  &client.Node{Key: key, Dir: true},
+			}
+		} else if err != nil {
+			log.Warningf("Error reading %v from etcd, retrying: %v",
+				key, err)
+			time.Sleep(1 * time.Second)
+			continue
 		}
+		if resp.Index < minIndex {
+			log.Infof("Read stale copy of %v at index %v, rereading...",
+				key, resp.Index)
+			continue
+		}
+		return resp
 	}
 }
 
@@ -175,42 +485,94 @@ func sendNode(node *client.Node, snapshotUpdates chan<- event, resp *client.Resp
 	}
 }
 
-func (driver *etcdDriver) watchEtcd(etcdEvents chan<- event, triggerResync chan<- uint64, initialSnapshotIndex <-chan uint64) {
-	cfg := client.Config{
-		Endpoints: []string{"http://127.0.0.1:2379"},
-		Transport: client.DefaultTransport,
-		// set timeout per request to fail fast when the target endpoint is unavailable
-		HeaderTimeoutPerRequest: time.Second,
-	}
-	c, err := client.New(cfg)
-	if err != nil {
-		log.Fatal(err)
+// currentEtcdIndex returns etcd's current index.
+func (driver *etcdDriver) currentEtcdIndex() uint64 {
+	for {
+		resp, err := driver.watcherKeysAPI.Get(context.Background(),
+			"/calico", &client.GetOptions{Quorum: true})
+		if etcdErr, ok := err.(client.Error); ok && etcdErr.Code == client.ErrorCodeKeyNotFound {
+			return etcdErr.Index
+		} else if err != nil {
+			log.Warningf("Error reading etcd index, retrying: %v", err)
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		return resp.Index
 	}
-	kapi := client.NewKeysAPI(c)
+}
+
+// watchEtcd watches etcd from the index that it receives on
+// initialSnapshotIndex.  If resuming is true, we're resuming from saved
+// state and the watcher tells the merge thread once it has caught up with
+// etcd's index at start of day.
+func (driver *etcdDriver) watchEtcd(etcdEvents chan<- event, initialSnapshotIndex <-chan uint64, resuming bool) {
+	kapi := driver.watcherKeysAPI
+
+	startIndex := <-initialSnapshotIndex
 
-	start_index := <-initialSnapshotIndex
+	catchingUp := false
+	var catchUpIndex uint64
+	if resuming {
+		catchUpIndex = driver.currentEtcdIndex()
+		log.Infof("Resuming from index %v, catching up to index %v",
+			startIndex, catchUpIndex)
+		catchingUp = true
+	}
+	caughtUp := func() {
+		log.Info("Watcher caught up with etcd")
+		catchingUp = false
+		etcdEvents <- event{action: actionCaughtUp}
+	}
+	if catchingUp && catchUpIndex <= startIndex {
+		caughtUp()
+	}
 
+	// AfterIndex is exclusive so the first event that we see is the one
+	// after the snapshot.
 	watcherOpts := client.WatcherOptions{
-		AfterIndex: start_index + 1,
+		AfterIndex: startIndex,
 		Recursive:  true,
 	}
 	watcher := kapi.Watcher("/calico/v1", &watcherOpts)
-	inSync := true
 	for {
-		resp, err := watcher.Next(context.Background())
+		ctx, cancel := context.Background(), context.CancelFunc(nil)
+		if catchingUp {
+			ctx, cancel = context.WithTimeout(ctx, catchUpProbeTimeout)
+		}
+		resp, err := watcher.Next(ctx)
+		if cancel != nil {
+			cancel()
+		}
+		if catchingUp && err == context.DeadlineExceeded {
+			// No more events, the last change before we
+			// started must have been outside /calico/v1.
+			caughtUp()
+			continue
+		}
 		if err != nil {
 			switch err := err.(type) {
 			case client.Error:
 				errCode := err.Code
 				if errCode == client.ErrorCodeWatcherCleared ||
 					errCode == client.ErrorCodeEventIndexCleared {
-					log.Warning("Lost sync with etcd, restarting watcher")
-					watcherOpts.AfterIndex = 0
+					// etcd no longer has the events that we
+					// need.  The error carries etcd's current
+					// index; restart the watcher from there
+					// and tell the merge thread to resync
+					// from a snapshot that's at least as new.
+					log.Warningf("Lost sync with etcd, resyncing from index %v",
+						err.Index)
+					resyncsCounter.Inc()
+					watcherOpts.AfterIndex = err.Index
 					watcher = kapi.Watcher("/calico/v1",
 						&watcherOpts)
-					inSync = false
-					// FIXME, we'll only trigger a resync after the next event
-					continue
+					// The merge thread's resync takes
+					// over from catching up.
+					catchingUp = false
+					etcdEvents <- event{
+						action:        actionResyncStarting,
+						snapshotIndex: err.Index,
+					}
 				} else {
 					log.Error("Error from etcd", err)
 					time.Sleep(1 * time.Second)
@@ -219,7 +581,8 @@ func (driver *etcdDriver) watchEtcd(etcdEvents chan<- event, triggerResync chan<
 				log.Error("Cluster error from etcd", err)
 				time.Sleep(1 * time.Second)
 			default:
-				panic(err)
+				log.Error("Unexpected error from etcd", err)
+				time.Sleep(1 * time.Second)
 			}
 		} else {
 			var actionType uint8
@@ -229,50 +592,225 @@ func (driver *etcdDriver) watchEtcd(etcdEvents chan<- event, triggerResync chan<
 			case "delete", "compareAndDelete", "expire":
 				actionType = actionDel
 			default:
-				panic("Unknown action type")
+				log.Errorf("Ignoring unknown etcd action %#v for key %v",
+					resp.Action, resp.Node.Key)
+				continue
 			}
 
+			watcherEventsCounter.WithLabelValues(resp.Action).Inc()
 			node := resp.Node
-			if node.Dir && actionType == actionSet {
-				// Creation of a directory, we don't care.
-				continue
-			}
-			if !inSync {
-				// Tell the snapshot thread that we need a
-				// new snapshot.  The snapshot needs to be
-				// from our index or one lower.
-				triggerResync <- node.ModifiedIndex - 1
-				inSync = true
+			if !node.Dir || actionType != actionSet {
+				// Ignore creation of a directory, we don't
+				// care.
+				etcdEvents <- event{
+					action:        actionType,
+					modifiedIndex: node.ModifiedIndex,
+					key:           resp.Node.Key,
+					valueOrNil:    node.Value,
+				}
 			}
-			etcdEvents <- event{
-				action:           actionType,
-				modifiedIndex:    node.ModifiedIndex,
-				key:              resp.Node.Key,
-				valueOrNil:       node.Value,
-				snapshotStarting: !inSync,
+			if catchingUp && node.ModifiedIndex >= catchUpIndex {
+				caughtUp()
 			}
 		}
 	}
 }
 
-func (driver *etcdDriver) mergeUpdates(snapshotUpdates <-chan event, watcherUpdates <-chan event) {
+// mergeUpdates merges the events from the snapshot and watcher threads,
+// using a HighWatermarkTracker to discard updates that are older than ones
+// we've already seen.  It also coordinates resyncs.
+//
+// When a resync starts, it starts tracking deletions, so that a stale snapshot
+// can't resurrect a key that the watcher has seen deleted, and then requests a
+// snapshot from the snapshot thread.  Doing both from this thread guarantees
+// that deletion tracking is in place before we see any of the snapshot.
+//
+// Once it has seen a complete snapshot that is new enough, it stops tracking
+// deletions and deletes any keys that weren't refreshed by the snapshot or the
+// watcher; they must have been deleted while we were out of sync.
+//
+// If restored is non-nil, the merge thread starts from the saved state instead
+// of a snapshot: it sends the saved keys and then relies on the watcher, which
+// resumes from the saved index, for any changes since.  We stay in
+// ResyncInProgress until the watcher has caught up with etcd.  If etcd no
+// longer has the events from the saved index, the watcher loses sync and we
+// fall back to a full resync.
+func (driver *etcdDriver) mergeUpdates(snapshotUpdates <-chan event, watcherUpdates <-chan event, restored *persistedState) {
 	var e event
-	var minSnapshotIndex uint64
 	hwms := hwm.NewHighWatermarkTracker()
 
-	driver.callbacks.OnStatusUpdated(store.WaitForDatastore)
+	// If we're saving our state, we need to keep a copy of each key's
+	// value, which the high-water mark tracker doesn't store.
+	var values map[string]string
+	var persistTicks <-chan time.Time
+	stateDirty := false
+	if driver.config.StateFile != "" {
+		values = make(map[string]string)
+		persistTicks = time.NewTicker(persistInterval).C
+	}
+
+	// Updates are accumulated into batches, which are sent when they
+	// fill up or when we run out of events to process.
+	pendingUpdates := make([]store.Update, 0, maxUpdatesPerBatch)
+	flushUpdates := func() {
+		if len(pendingUpdates) == 0 {
+			return
+		}
+		driver.sendUpdates(pendingUpdates)
+		pendingUpdates = make([]store.Update, 0, maxUpdatesPerBatch)
+	}
+	queueUpdate := func(update store.Update) {
+		if values != nil {
+			if update.ValueOrNil == nil {
+				delete(values, update.Key)
+			} else {
+				values[update.Key] = *update.ValueOrNil
+			}
+		}
+		stateDirty = true
+		pendingUpdates = append(pendingUpdates, update)
+		if len(pendingUpdates) >= maxUpdatesPerBatch {
+			flushUpdates()
+		}
+	}
+
+	status := store.WaitForDatastore
+	setStatus := func(newStatus store.DriverStatus) {
+		flushUpdates()
+		status = newStatus
+		driver.callbacks.OnStatusUpdated(status)
+		atomic.StoreUint32(&driver.status, uint32(status))
+		if status == store.InSync && driver.endpointStatus != nil {
+			// Once Felix has caught up, it will have reported
+			// all its endpoints; clean up any others.
+			driver.endpointStatus.scheduleCleanup()
+		}
+		select {
+		case driver.statusChanged <- struct{}{}:
+		default:
+		}
+	}
+
+	// resyncInProgress is true from the start of a resync until we've
+	// processed a snapshot with index >= minSnapshotIndex.
+	resyncInProgress := false
+	var minSnapshotIndex uint64
+	// forcedResync is true if the current resync should resend every
+	// key in the snapshot.
+	forcedResync := false
+	// lastIndex is the highest modified index that we've seen from the
+	// watcher.
+	var lastIndex uint64
+	// awaitingCatchUp is true if we restored our state and the watcher
+	// hasn't caught up with etcd yet.
+	awaitingCatchUp := restored != nil
+	startResync := func(minIndex uint64, forced bool) {
+		// The snapshot must be at least as new as anything that we've
+		// already seen.
+		if minIndex < lastIndex {
+			minIndex = lastIndex
+		}
+		if snapIdx := atomic.LoadUint64(&driver.snapshotIndex); minIndex < snapIdx {
+			minIndex = snapIdx
+		}
+		if !resyncInProgress {
+			hwms.StartTrackingDeletions()
+		}
+		resyncInProgress = true
+		forcedResync = forcedResync || forced
+		if minIndex > minSnapshotIndex {
+			minSnapshotIndex = minIndex
+		}
+		log.Infof("Starting resync, need snapshot >= %v", minSnapshotIndex)
+		if status != store.WaitForDatastore {
+			setStatus(store.ResyncInProgress)
+		}
+		driver.requestSnapshot(minSnapshotIndex)
+	}
+
+	// persistState saves our state, if it has changed.  We only save
+	// the state when we're in sync, when every event up to the saved
+	// index is reflected in the saved keys.
+	persistState := func() {
+		if values == nil || !stateDirty || status != store.InSync {
+			return
+		}
+		state := &persistedState{
+			Index: lastIndex,
+			Keys:  make([]persistedKey, 0, len(values)),
+		}
+		if snapIdx := atomic.LoadUint64(&driver.snapshotIndex); snapIdx > state.Index {
+			state.Index = snapIdx
+		}
+		hwms.VisitKeys(func(key string, hwm uint64) {
+			state.Keys = append(state.Keys, persistedKey{
+				Key:   key,
+				HWM:   hwm,
+				Value: values[key],
+			})
+		})
+		if err := saveState(driver.config.StateFile, state); err != nil {
+			log.Errorf("Failed to save state to %v: %v",
+				driver.config.StateFile, err)
+			return
+		}
+		log.Debugf("Saved %v keys at index %v", len(state.Keys), state.Index)
+		stateDirty = false
+	}
+
+	setStatus(store.WaitForDatastore)
+	if restored != nil {
+		setStatus(store.ResyncInProgress)
+		for _, kv := range restored.Keys {
+			hwms.StoreUpdate(kv.Key, kv.HWM)
+			hwms.StoreValueHash(kv.Key, hashValue(kv.Value))
+			value := kv.Value
+			queueUpdate(store.Update{Key: kv.Key, ValueOrNil: &value})
+		}
+		lastIndex = restored.Index
+		atomic.StoreUint64(&driver.snapshotIndex, restored.Index)
+		stateDirty = false
+	} else {
+		startResync(0, false)
+	}
 	for {
 		select {
 		case e = <-snapshotUpdates:
-		//log.Debugf("Snapshot update %v @ %v\n", e.key, e.modifiedIndex)
 		case e = <-watcherUpdates:
-			//log.Debugf("Watcher update %v @ %v\n", e.key, e.modifiedIndex)
+			etcdEventsGauge.Set(float64(len(watcherUpdates)))
+		case <-driver.forceResync:
+			log.Info("Forced resync starting")
+			forcedResyncsCounter.Inc()
+			startResync(0, true)
+			continue
+		case <-persistTicks:
+			persistState()
+			continue
+		default:
+			// Nothing waiting; send what we have before blocking
+			// so that updates aren't delayed.
+			flushUpdates()
+			select {
+			case e = <-snapshotUpdates:
+			case e = <-watcherUpdates:
+				etcdEventsGauge.Set(float64(len(watcherUpdates)))
+			case <-driver.forceResync:
+				log.Info("Forced resync starting")
+				forcedResyncsCounter.Inc()
+				startResync(0, true)
+				continue
+			case <-persistTicks:
+				persistState()
+				continue
+			}
+		}
+		if e.snapshotIndex == 0 && e.modifiedIndex > lastIndex {
+			lastIndex = e.modifiedIndex
+			stateDirty = true
 		}
-		if e.snapshotStarting {
-			// Watcher lost sync, need to track deletions until
-			// we get a snapshot from after this index.
-			minSnapshotIndex = e.modifiedIndex
-			driver.callbacks.OnStatusUpdated(store.ResyncInProgress)
+		if status == store.WaitForDatastore && e.snapshotIndex != 0 {
+			// First snapshot event, etcd is up.
+			setStatus(store.ResyncInProgress)
 		}
 		switch e.action {
 		case actionSet:
@@ -290,46 +828,101 @@ func (driver *etcdDriver) mergeUpdates(snapshotUpdates <-chan event, watcherUpda
 			oldIdx := hwms.StoreUpdate(e.key, indexToStore)
 			//log.Debugf("%v update %v -> %v\n",
 			//	e.key, oldIdx, e.modifiedIndex)
-			if oldIdx < e.modifiedIndex {
-				// Event is newer than value for that key.
-				// Send the update to Felix.
-				update := store.Update{
-					Key:        e.key,
-					ValueOrNil: &e.valueOrNil,
+			resend := forcedResync && e.snapshotIndex != 0 &&
+				oldIdx <= e.snapshotIndex
+			if oldIdx < e.modifiedIndex || resend {
+				// Event is newer than value for that key, or
+				// we're resending the snapshot and we haven't
+				// seen a newer update.  Send the update to
+				// Felix unless the value hasn't changed; a
+				// forced resync resends everything.
+				changed := hwms.StoreValueHash(e.key,
+					hashValue(e.valueOrNil))
+				if !changed && !resend {
+					suppressedUpdatesCounter.Inc()
+					continue
 				}
-				driver.callbacks.OnKeysUpdated(
-					[]store.Update{update})
+				// Copy the value since e is reused for the
+				// next event.
+				value := e.valueOrNil
+				queueUpdate(store.Update{
+					Key:        e.key,
+					ValueOrNil: &value,
+				})
 			}
 		case actionDel:
 			deletedKeys := hwms.StoreDeletion(e.key,
 				e.modifiedIndex)
 			log.Debugf("Prefix %v deleted; %v keys",
 				e.key, len(deletedKeys))
-			updates := make([]store.Update, 0, len(deletedKeys))
 			for _, child := range deletedKeys {
-				updates = append(updates, store.Update{
+				queueUpdate(store.Update{
 					Key:        child,
 					ValueOrNil: nil,
 				})
 			}
-			driver.callbacks.OnKeysUpdated(updates)
+		case actionResyncStarting:
+			// A resync supersedes catching up.
+			awaitingCatchUp = false
+			startResync(e.snapshotIndex, false)
+		case actionCaughtUp:
+			if !awaitingCatchUp || resyncInProgress {
+				continue
+			}
+			awaitingCatchUp = false
+			setStatus(store.InSync)
 		case actionSnapFinished:
-			if e.snapshotIndex >= minSnapshotIndex {
-				// Now in sync.
-				hwms.StopTrackingDeletions()
-				keys := hwms.DeleteOldKeys(e.snapshotIndex)
-				log.Infof("Snapshot finished at index %v; "+
-					"%v keys deleted.\n",
-					e.snapshotIndex, len(keys))
-				for _, key := range keys {
-					updates := []store.Update{{
-						Key:        key,
-						ValueOrNil: nil,
-					}}
-					driver.callbacks.OnKeysUpdated(updates)
-				}
+			atomic.StoreUint64(&driver.snapshotIndex, e.snapshotIndex)
+			if !resyncInProgress || e.snapshotIndex < minSnapshotIndex {
+				// Stale snapshot; the snapshot thread will
+				// send another.
+				log.Infof("Ignoring end of stale snapshot %v, need >= %v",
+					e.snapshotIndex, minSnapshotIndex)
+				continue
 			}
-			driver.callbacks.OnStatusUpdated(store.InSync)
+			// Now in sync.
+			resyncInProgress = false
+			forcedResync = false
+			hwms.StopTrackingDeletions()
+			keys := hwms.DeleteOldKeys(e.snapshotIndex)
+			deletedOldKeysCounter.Add(float64(len(keys)))
+			log.Infof("Snapshot finished at index %v; "+
+				"%v keys deleted.\n",
+				e.snapshotIndex, len(keys))
+			for _, key := range keys {
+				queueUpdate(store.Update{
+					Key:        key,
+					ValueOrNil: nil,
+				})
+			}
+			setStatus(store.InSync)
+			stateDirty = true
+			persistState()
+		}
+	}
+}
+
+// hashValue returns the hash of a value that we store in the high-water mark
+// tracker to spot updates that don't change the value.
+func hashValue(value string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(value))
+	return hash.Sum64()
+}
+
+// sendUpdates passes the updates to the callbacks, checking whether any of
+// them changes the Felix config on the way through.
+func (driver *etcdDriver) sendUpdates(updates []store.Update) {
+	configChanged := false
+	for _, update := range updates {
+		if driver.felixConfig.OnUpdate(update) {
+			log.Infof("Config key %v changed", update.Key)
+			configChanged = true
 		}
 	}
+	driver.callbacks.OnKeysUpdated(updates)
+	if configChanged {
+		log.Warning("Felix config changed, Felix needs to restart")
+		driver.callbacks.OnConfigChanged(driver.felixConfig.CopyMaps())
+	}
 }
@@ -0,0 +1,932 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/projectcalico/calico-go/etcd-driver/etcd"
+
+	"github.com/coreos/etcd/client"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+	"github.com/projectcalico/calico-go/lib/backend"
+	"golang.org/x/net/context"
+)
+
+// fakeEtcd is a client.KeysAPI that lets the test control exactly when each
+// snapshot and watcher event is returned.  Methods that the driver doesn't use
+// are left unimplemented and panic.
+type fakeEtcd struct {
+	client.KeysAPI
+
+	// snapshots is unbuffered so a successful send proves that the driver
+	// asked for a snapshot.  The driver asks by listing /calico/v1; it
+	// then reads the subtrees of the snapshot that was sent.
+	snapshots    chan *client.Response
+	watchResults chan watchResult
+	watcherOpts  chan client.WatcherOptions
+
+	lock           sync.Mutex
+	current        *client.Response
+	recursiveReads []string
+
+	sets    chan setRequest
+	deletes chan string
+	// statusTree is returned for reads of Felix's status directory.
+	statusTree *client.Node
+	// etcdIndex is returned as etcd's current index by reads of /calico.
+	etcdIndex uint64
+	// config maps from config key to value, for the driver's reads of
+	// the config directories when it starts.
+	config map[string]string
+	// advanceIndex makes the snapshot behave as if etcd was changing while
+	// the driver reads it: each recursive read sees an etcd index one
+	// higher than the last and only the keys modified at or before that
+	// index.
+	advanceIndex bool
+	readIndex    uint64
+}
+
+type setRequest struct {
+	key   string
+	value string
+	opts  client.SetOptions
+}
+
+type watchResult struct {
+	resp *client.Response
+	err  error
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{
+		snapshots:    make(chan *client.Response),
+		watchResults: make(chan watchResult),
+		watcherOpts:  make(chan client.WatcherOptions, 10),
+		sets:         make(chan setRequest, 100),
+		deletes:      make(chan string, 100),
+	}
+}
+
+func (f *fakeEtcd) Delete(ctx context.Context, key string, opts *client.DeleteOptions) (*client.Response, error) {
+	f.deletes <- key
+	return &client.Response{}, nil
+}
+
+func (f *fakeEtcd) Set(ctx context.Context, key, value string, opts *client.SetOptions) (*client.Response, error) {
+	if opts == nil {
+		opts = &client.SetOptions{}
+	}
+	select {
+	case f.sets <- setRequest{key, value, *opts}:
+	default:
+	}
+	return &client.Response{}, nil
+}
+
+func (f *fakeEtcd) Get(ctx context.Context, key string, opts *client.GetOptions) (*client.Response, error) {
+	if key == "/calico/v1" {
+		if opts.Recursive {
+			panic("Driver read the whole snapshot in one go")
+		}
+		snap := <-f.snapshots
+		f.lock.Lock()
+		f.current = snap
+		f.readIndex = snap.Index
+		f.lock.Unlock()
+		node := shallowCopy(snap.Node)
+		if f.advanceIndex {
+			node = nodeAtIndex(node, snap.Index)
+		}
+		return &client.Response{Index: snap.Index, Node: node}, nil
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if key == "/calico" {
+		return &client.Response{
+			Index: f.etcdIndex,
+			Node:  &client.Node{Key: key, Dir: true},
+		}, nil
+	}
+	if strings.HasPrefix(key, "/calico/felix/") {
+		if f.statusTree == nil || findNode(f.statusTree, key) == nil {
+			return nil, client.Error{Code: client.ErrorCodeKeyNotFound}
+		}
+		return &client.Response{Node: findNode(f.statusTree, key)}, nil
+	}
+	if strings.HasSuffix(key, "/config") {
+		dir := &client.Node{Key: key, Dir: true}
+		for k, v := range f.config {
+			if path.Dir(k) == key {
+				dir.Nodes = append(dir.Nodes, &client.Node{Key: k, Value: v})
+			}
+		}
+		if len(dir.Nodes) == 0 {
+			return nil, client.Error{Code: client.ErrorCodeKeyNotFound}
+		}
+		return &client.Response{Node: dir}, nil
+	}
+	if f.current == nil {
+		return nil, client.Error{Code: client.ErrorCodeKeyNotFound}
+	}
+	index := f.current.Index
+	if opts.Recursive {
+		f.recursiveReads = append(f.recursiveReads, key)
+		if f.advanceIndex {
+			f.readIndex++
+		}
+	}
+	if f.advanceIndex {
+		index = f.readIndex
+	}
+	node := findNode(f.current.Node, key)
+	if node == nil {
+		return nil, client.Error{
+			Code:  client.ErrorCodeKeyNotFound,
+			Index: index,
+		}
+	}
+	if !opts.Recursive {
+		node = shallowCopy(node)
+	}
+	if f.advanceIndex {
+		node = nodeAtIndex(node, index)
+	}
+	return &client.Response{Index: index, Node: node}, nil
+}
+
+// sendSnapshot waits for the driver to ask for a snapshot and then returns the
+// given one.
+func (f *fakeEtcd) sendSnapshot(resp *client.Response) {
+	select {
+	case f.snapshots <- resp:
+	case <-time.After(5 * time.Second):
+		Fail("Driver didn't ask for a snapshot")
+	}
+}
+
+func (f *fakeEtcd) sendWatchResult(result watchResult) {
+	select {
+	case f.watchResults <- result:
+	case <-time.After(5 * time.Second):
+		Fail("Driver isn't watching")
+	}
+}
+
+func (f *fakeEtcd) expectNoSnapshotRequest() {
+	select {
+	case f.snapshots <- snapshot(1):
+		Fail("Unexpected snapshot request")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func (f *fakeEtcd) getRecursiveReads() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]string(nil), f.recursiveReads...)
+}
+
+func findNode(node *client.Node, key string) *client.Node {
+	if node.Key == key {
+		return node
+	}
+	for _, child := range node.Nodes {
+		if strings.HasPrefix(key, child.Key) {
+			if found := findNode(child, key); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// shallowCopy returns a copy of the given node with the grandchildren removed,
+// as returned by a non-recursive read.
+func shallowCopy(node *client.Node) *client.Node {
+	copied := *node
+	copied.Nodes = nil
+	for _, child := range node.Nodes {
+		childCopy := *child
+		childCopy.Nodes = nil
+		copied.Nodes = append(copied.Nodes, &childCopy)
+	}
+	return &copied
+}
+
+// nodeAtIndex returns a copy of the given node without the keys that were
+// modified after the given index.
+func nodeAtIndex(node *client.Node, index uint64) *client.Node {
+	copied := *node
+	copied.Nodes = nil
+	for _, child := range node.Nodes {
+		if !child.Dir && child.ModifiedIndex > index {
+			continue
+		}
+		copied.Nodes = append(copied.Nodes, nodeAtIndex(child, index))
+	}
+	return &copied
+}
+
+func (f *fakeEtcd) Watcher(key string, opts *client.WatcherOptions) client.Watcher {
+	f.watcherOpts <- *opts
+	return &fakeWatcher{f}
+}
+
+type fakeWatcher struct {
+	etcd *fakeEtcd
+}
+
+func (w *fakeWatcher) Next(ctx context.Context) (*client.Response, error) {
+	select {
+	case result := <-w.etcd.watchResults:
+		return result.resp, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type kvAt struct {
+	key   string
+	value string
+	index uint64
+}
+
+func snapshot(index uint64, kvs ...kvAt) *client.Response {
+	root := &client.Node{Key: "/calico/v1", Dir: true}
+	for _, kv := range kvs {
+		parent := root
+		parts := strings.Split(strings.TrimPrefix(kv.key, "/calico/v1/"), "/")
+		for _, part := range parts[:len(parts)-1] {
+			dirKey := parent.Key + "/" + part
+			var dir *client.Node
+			for _, child := range parent.Nodes {
+				if child.Key == dirKey {
+					dir = child
+				}
+			}
+			if dir == nil {
+				dir = &client.Node{Key: dirKey, Dir: true}
+				parent.Nodes = append(parent.Nodes, dir)
+			}
+			parent = dir
+		}
+		parent.Nodes = append(parent.Nodes, &client.Node{
+			Key:           kv.key,
+			Value:         kv.value,
+			ModifiedIndex: kv.index,
+		})
+	}
+	return &client.Response{Index: index, Node: root}
+}
+
+func setEvent(key, value string, index uint64) watchResult {
+	return watchResult{resp: &client.Response{
+		Action: "set",
+		Node:   &client.Node{Key: key, Value: value, ModifiedIndex: index},
+	}}
+}
+
+func deleteEvent(key string, index uint64) watchResult {
+	return watchResult{resp: &client.Response{
+		Action: "delete",
+		Node:   &client.Node{Key: key, ModifiedIndex: index},
+	}}
+}
+
+func indexCleared(index uint64) watchResult {
+	return watchResult{err: client.Error{
+		Code:  client.ErrorCodeEventIndexCleared,
+		Index: index,
+	}}
+}
+
+// recordingCallbacks tracks the state that the driver has reported.
+type recordingCallbacks struct {
+	lock       sync.Mutex
+	values     map[string]string
+	numUpdates map[string]int
+	statuses   []store.DriverStatus
+	// configs records the global and host config passed to each
+	// OnConfigLoaded or OnConfigChanged call.
+	configs [][2]map[string]string
+}
+
+func newRecordingCallbacks() *recordingCallbacks {
+	return &recordingCallbacks{
+		values:     make(map[string]string),
+		numUpdates: make(map[string]int),
+	}
+}
+
+func (cbs *recordingCallbacks) OnConfigLoaded(global, host map[string]string) {
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+	cbs.configs = append(cbs.configs, [2]map[string]string{global, host})
+}
+
+func (cbs *recordingCallbacks) OnConfigChanged(global, host map[string]string) {
+	cbs.OnConfigLoaded(global, host)
+}
+
+func (cbs *recordingCallbacks) getConfigs() [][2]map[string]string {
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+	return append([][2]map[string]string(nil), cbs.configs...)
+}
+
+func (cbs *recordingCallbacks) OnStatusUpdated(status store.DriverStatus) {
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+	cbs.statuses = append(cbs.statuses, status)
+}
+
+func (cbs *recordingCallbacks) OnKeysUpdated(updates []store.Update) {
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+	for _, update := range updates {
+		cbs.numUpdates[update.Key]++
+		if update.ValueOrNil == nil {
+			delete(cbs.values, update.Key)
+		} else {
+			cbs.values[update.Key] = *update.ValueOrNil
+		}
+	}
+}
+
+func (cbs *recordingCallbacks) getValues() map[string]string {
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+	values := make(map[string]string)
+	for k, v := range cbs.values {
+		values[k] = v
+	}
+	return values
+}
+
+func (cbs *recordingCallbacks) getNumUpdates(key string) int {
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+	return cbs.numUpdates[key]
+}
+
+func (cbs *recordingCallbacks) lastStatus() store.DriverStatus {
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+	return cbs.statuses[len(cbs.statuses)-1]
+}
+
+func (cbs *recordingCallbacks) getStatuses() []store.DriverStatus {
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+	return append([]store.DriverStatus(nil), cbs.statuses...)
+}
+
+const (
+	keyA = "/calico/v1/policy/profile/a/rules"
+	keyB = "/calico/v1/policy/profile/b/rules"
+	keyC = "/calico/v1/policy/profile/c/rules"
+
+	keyH1 = "/calico/v1/host/h1/endpoint/e1"
+	keyH2 = "/calico/v1/host/h2/endpoint/e1"
+	keyH3 = "/calico/v1/host/h3/endpoint/e1"
+)
+
+var _ = Describe("etcd driver", func() {
+	var etcd *fakeEtcd
+	var cbs *recordingCallbacks
+	var driver store.Driver
+
+	BeforeEach(func() {
+		etcd = newFakeEtcd()
+		cbs = newRecordingCallbacks()
+		driver = NewWithKeysAPIs(cbs, &store.DriverConfiguration{
+			FelixHostname:    "hostname",
+			SnapshotPageSize: 2,
+		}, etcd, etcd)
+		driver.Start()
+
+		etcd.sendSnapshot(snapshot(10,
+			kvAt{keyA, "a1", 5},
+			kvAt{keyB, "b1", 6},
+		))
+		Eventually(cbs.getStatuses).Should(Equal([]store.DriverStatus{
+			store.WaitForDatastore,
+			store.ResyncInProgress,
+			store.InSync,
+		}))
+		Expect(cbs.getValues()).To(Equal(map[string]string{
+			keyA: "a1",
+			keyB: "b1",
+		}))
+	})
+
+	It("should watch from the event after the snapshot", func() {
+		Eventually(etcd.watcherOpts).Should(Receive(Equal(client.WatcherOptions{
+			AfterIndex: 10,
+			Recursive:  true,
+		})))
+		etcd.sendWatchResult(setEvent(keyC, "c1", 11))
+		Eventually(cbs.getValues).Should(HaveKeyWithValue(keyC, "c1"))
+		etcd.expectNoSnapshotRequest()
+	})
+
+	It("should suppress an update that doesn't change the value", func() {
+		Eventually(etcd.watcherOpts).Should(Receive())
+		etcd.sendWatchResult(setEvent(keyA, "a1", 11))
+		etcd.sendWatchResult(setEvent(keyC, "c1", 12))
+		Eventually(cbs.getValues).Should(HaveKey(keyC))
+		Expect(cbs.getNumUpdates(keyA)).To(Equal(1))
+	})
+
+	Describe("after losing sync", func() {
+		BeforeEach(func() {
+			Eventually(etcd.watcherOpts).Should(Receive())
+			etcd.sendWatchResult(indexCleared(20))
+		})
+
+		It("should resync immediately from the cleared index", func() {
+			Eventually(cbs.lastStatus).Should(Equal(store.ResyncInProgress))
+			Eventually(etcd.watcherOpts).Should(Receive(Equal(client.WatcherOptions{
+				AfterIndex: 20,
+				Recursive:  true,
+			})))
+			etcd.sendSnapshot(snapshot(20, kvAt{keyA, "a1", 5}, kvAt{keyB, "b1", 6}))
+			Eventually(cbs.lastStatus).Should(Equal(store.InSync))
+		})
+		It("should delete keys that vanished while out of sync", func() {
+			etcd.sendSnapshot(snapshot(20, kvAt{keyA, "a1", 5}))
+			Eventually(cbs.lastStatus).Should(Equal(store.InSync))
+			Expect(cbs.getValues()).To(Equal(map[string]string{keyA: "a1"}))
+		})
+		It("should pick up keys that changed while out of sync", func() {
+			etcd.sendSnapshot(snapshot(20, kvAt{keyA, "a2", 15}, kvAt{keyB, "b1", 6}))
+			Eventually(cbs.lastStatus).Should(Equal(store.InSync))
+			Expect(cbs.getValues()).To(Equal(map[string]string{
+				keyA: "a2",
+				keyB: "b1",
+			}))
+		})
+		It("should suppress keys rewritten with the same value while out of sync", func() {
+			etcd.sendSnapshot(snapshot(20, kvAt{keyA, "a1", 15}, kvAt{keyB, "b1", 6}))
+			Eventually(cbs.lastStatus).Should(Equal(store.InSync))
+			Expect(cbs.getNumUpdates(keyA)).To(Equal(1))
+		})
+		It("should not resurrect a key deleted before the snapshot arrives", func() {
+			etcd.sendWatchResult(deleteEvent(keyA, 21))
+			Eventually(cbs.getValues).ShouldNot(HaveKey(keyA))
+			// Snapshot from before the deletion.
+			etcd.sendSnapshot(snapshot(20, kvAt{keyA, "a1", 5}, kvAt{keyB, "b1", 6}))
+			Eventually(cbs.lastStatus).Should(Equal(store.InSync))
+			Expect(cbs.getValues()).To(Equal(map[string]string{keyB: "b1"}))
+			// One add, one delete; no duplicate deletion.
+			Expect(cbs.getNumUpdates(keyA)).To(Equal(2))
+		})
+		It("should not revert a key updated before the snapshot arrives", func() {
+			etcd.sendWatchResult(setEvent(keyB, "b2", 21))
+			Eventually(cbs.getValues).Should(HaveKeyWithValue(keyB, "b2"))
+			etcd.sendSnapshot(snapshot(20, kvAt{keyA, "a1", 5}, kvAt{keyB, "b1", 6}))
+			Eventually(cbs.lastStatus).Should(Equal(store.InSync))
+			Expect(cbs.getValues()).To(Equal(map[string]string{
+				keyA: "a1",
+				keyB: "b2",
+			}))
+		})
+		It("should keep a key created after the snapshot", func() {
+			etcd.sendWatchResult(setEvent(keyC, "c1", 22))
+			Eventually(cbs.getValues).Should(HaveKey(keyC))
+			etcd.sendSnapshot(snapshot(21, kvAt{keyA, "a1", 5}, kvAt{keyB, "b1", 6}))
+			Eventually(cbs.lastStatus).Should(Equal(store.InSync))
+			Expect(cbs.getValues()).To(HaveKeyWithValue(keyC, "c1"))
+		})
+		It("should reread a stale snapshot", func() {
+			etcd.sendSnapshot(snapshot(15))
+			// Nothing deleted by the stale snapshot, still resyncing.
+			etcd.sendSnapshot(snapshot(20, kvAt{keyB, "b1", 6}))
+			Eventually(cbs.lastStatus).Should(Equal(store.InSync))
+			Expect(cbs.getValues()).To(Equal(map[string]string{keyB: "b1"}))
+			Expect(cbs.getNumUpdates(keyA)).To(Equal(2))
+		})
+		It("should handle losing sync again during the resync", func() {
+			etcd.sendWatchResult(indexCleared(30))
+			Eventually(etcd.watcherOpts).Should(Receive())
+			Eventually(etcd.watcherOpts).Should(Receive(Equal(client.WatcherOptions{
+				AfterIndex: 30,
+				Recursive:  true,
+			})))
+			etcd.sendSnapshot(snapshot(30, kvAt{keyA, "a1", 5}))
+			Eventually(cbs.lastStatus).Should(Equal(store.InSync))
+			Expect(cbs.getValues()).To(Equal(map[string]string{keyA: "a1"}))
+		})
+	})
+
+	It("should resend everything on a forced resync", func() {
+		driver.ForceResync()
+		etcd.sendSnapshot(snapshot(12, kvAt{keyA, "a1", 5}))
+		Eventually(cbs.getStatuses).Should(HaveLen(5))
+		Expect(cbs.lastStatus()).To(Equal(store.InSync))
+		Expect(cbs.getValues()).To(Equal(map[string]string{keyA: "a1"}))
+		Expect(cbs.getNumUpdates(keyA)).To(Equal(2))
+		Expect(cbs.getNumUpdates(keyB)).To(Equal(2))
+	})
+
+	It("should read the snapshot a subtree at a time", func() {
+		driver.ForceResync()
+		etcd.sendSnapshot(snapshot(12,
+			kvAt{keyA, "a1", 5},
+			kvAt{keyH1, "h1", 11},
+			kvAt{keyH2, "h2", 11},
+			kvAt{keyH3, "h3", 12},
+			kvAt{"/calico/v1/Ready", "true", 1},
+		))
+		Eventually(cbs.getStatuses).Should(HaveLen(5))
+		Expect(cbs.lastStatus()).To(Equal(store.InSync))
+		Expect(cbs.getValues()).To(Equal(map[string]string{
+			keyA:               "a1",
+			keyH1:              "h1",
+			keyH2:              "h2",
+			keyH3:              "h3",
+			"/calico/v1/Ready": "true",
+		}))
+		Expect(etcd.getRecursiveReads()).To(ConsistOf(
+			// From the initial snapshot.
+			"/calico/v1/policy/profile",
+			// From the forced resync.
+			"/calico/v1/policy/profile",
+			"/calico/v1/host/h1",
+			"/calico/v1/host/h2",
+			"/calico/v1/host/h3",
+		))
+	})
+})
+
+var _ = Describe("etcd driver with Felix config", func() {
+	var etcd *fakeEtcd
+	var cbs *recordingCallbacks
+
+	BeforeEach(func() {
+		etcd = newFakeEtcd()
+		etcd.config = map[string]string{
+			"/calico/v1/config/LogSeverityScreen":              "info",
+			"/calico/v1/host/hostname/config/InterfacePrefix":  "tap",
+			"/calico/v1/host/otherhost/config/InterfacePrefix": "cali",
+		}
+		cbs = newRecordingCallbacks()
+		driver := NewWithKeysAPIs(cbs, &store.DriverConfiguration{
+			FelixHostname: "hostname",
+		}, etcd, etcd)
+		driver.Start()
+		etcd.sendSnapshot(snapshot(10,
+			kvAt{"/calico/v1/config/LogSeverityScreen", "info", 3},
+			kvAt{"/calico/v1/host/hostname/config/InterfacePrefix", "tap", 4},
+			kvAt{"/calico/v1/host/otherhost/config/InterfacePrefix", "cali", 5},
+		))
+		Eventually(etcd.watcherOpts).Should(Receive())
+	})
+
+	It("should load the global config and the config for our host", func() {
+		Expect(cbs.getConfigs()).To(Equal([][2]map[string]string{{
+			{"LogSeverityScreen": "info"},
+			{"InterfacePrefix": "tap"},
+		}}))
+	})
+	It("should report a change to the config for our host", func() {
+		etcd.sendWatchResult(setEvent("/calico/v1/host/hostname/config/InterfacePrefix", "cali", 11))
+		Eventually(cbs.getConfigs).Should(HaveLen(2))
+		Expect(cbs.getConfigs()[1]).To(Equal([2]map[string]string{
+			{"LogSeverityScreen": "info"},
+			{"InterfacePrefix": "cali"},
+		}))
+	})
+	It("should report a deleted global parameter", func() {
+		etcd.sendWatchResult(deleteEvent("/calico/v1/config/LogSeverityScreen", 11))
+		Eventually(cbs.getConfigs).Should(HaveLen(2))
+		Expect(cbs.getConfigs()[1]).To(Equal([2]map[string]string{
+			{},
+			{"InterfacePrefix": "tap"},
+		}))
+	})
+	It("should ignore another host's config and unchanged values", func() {
+		etcd.sendWatchResult(setEvent("/calico/v1/host/otherhost/config/InterfacePrefix", "tap", 11))
+		etcd.sendWatchResult(setEvent("/calico/v1/config/LogSeverityScreen", "info", 12))
+		etcd.sendWatchResult(setEvent(keyA, "a1", 13))
+		Eventually(cbs.getValues).Should(HaveKey(keyA))
+		Expect(cbs.getConfigs()).To(HaveLen(1))
+	})
+})
+
+var _ = Describe("etcd driver reading a snapshot while etcd changes", func() {
+	It("should watch from the lowest index of the snapshot's reads", func() {
+		etcd := newFakeEtcd()
+		etcd.advanceIndex = true
+		cbs := newRecordingCallbacks()
+		driver := NewWithKeysAPIs(cbs, &store.DriverConfiguration{
+			FelixHostname:    "hostname",
+			SnapshotPageSize: 2,
+		}, etcd, etcd)
+		driver.Start()
+
+		// The listing of /calico/v1 is at index 10, the profiles are
+		// read at 11 and the hosts at 12 and 13.  Each read misses the
+		// keys created after it.
+		etcd.sendSnapshot(snapshot(10,
+			kvAt{keyA, "a1", 5},
+			kvAt{keyH1, "h1", 6},
+			kvAt{"/calico/v1/Ready", "true", 11},
+			kvAt{keyB, "b1", 11},
+			kvAt{keyH2, "h2", 12},
+		))
+		Eventually(etcd.watcherOpts).Should(Receive(Equal(client.WatcherOptions{
+			AfterIndex: 10,
+			Recursive:  true,
+		})))
+		Expect(etcd.getRecursiveReads()).To(ConsistOf(
+			"/calico/v1/policy/profile",
+			"/calico/v1/host/h1",
+			"/calico/v1/host/h2",
+		))
+		Eventually(cbs.getValues).Should(Equal(map[string]string{
+			keyA:  "a1",
+			keyB:  "b1",
+			keyH1: "h1",
+			keyH2: "h2",
+		}))
+
+		// The watcher replays the changes since index 10, including the
+		// one that the listing at index 10 missed.
+		etcd.sendWatchResult(setEvent("/calico/v1/Ready", "true", 11))
+		etcd.sendWatchResult(setEvent(keyB, "b1", 11))
+		etcd.sendWatchResult(setEvent(keyH2, "h2", 12))
+		etcd.sendWatchResult(setEvent(keyC, "c1", 14))
+		Eventually(cbs.getValues).Should(Equal(map[string]string{
+			keyA:               "a1",
+			keyB:               "b1",
+			keyC:               "c1",
+			keyH1:              "h1",
+			keyH2:              "h2",
+			"/calico/v1/Ready": "true",
+		}))
+		// Keys that both a read and the watcher saw are only sent once.
+		Expect(cbs.getNumUpdates(keyB)).To(Equal(1))
+		Expect(cbs.getNumUpdates(keyH2)).To(Equal(1))
+		Eventually(cbs.lastStatus).Should(Equal(store.InSync))
+	})
+})
+
+var _ = Describe("etcd driver with a state file", func() {
+	var tmpDir, stateFile string
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "etcd-driver")
+		Expect(err).NotTo(HaveOccurred())
+		stateFile = filepath.Join(tmpDir, "state")
+	})
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	// startDriver starts a driver, with etcd at the given index.
+	startDriver := func(etcdIndex uint64) (*fakeEtcd, *recordingCallbacks) {
+		etcd := newFakeEtcd()
+		etcd.etcdIndex = etcdIndex
+		cbs := newRecordingCallbacks()
+		NewWithKeysAPIs(cbs, &store.DriverConfiguration{
+			FelixHostname: "hostname",
+			StateFile:     stateFile,
+		}, etcd, etcd).Start()
+		return etcd, cbs
+	}
+
+	It("should resync if there's no state file", func() {
+		etcd, cbs := startDriver(10)
+		etcd.sendSnapshot(snapshot(10, kvAt{keyA, "a1", 5}))
+		Eventually(cbs.lastStatus).Should(Equal(store.InSync))
+		Eventually(stateFile).Should(BeAnExistingFile())
+	})
+	It("should resync if the state file is corrupt", func() {
+		Expect(ioutil.WriteFile(stateFile, []byte("{"), 0644)).To(Succeed())
+		etcd, cbs := startDriver(10)
+		etcd.sendSnapshot(snapshot(10, kvAt{keyA, "a1", 5}))
+		Eventually(cbs.lastStatus).Should(Equal(store.InSync))
+	})
+
+	Describe("after a restart", func() {
+		var etcd *fakeEtcd
+		var cbs *recordingCallbacks
+
+		saveState := func() {
+			etcd, cbs = startDriver(10)
+			etcd.sendSnapshot(snapshot(10,
+				kvAt{keyA, "a1", 5},
+				kvAt{keyB, "b1", 6},
+			))
+			Eventually(stateFile).Should(BeAnExistingFile())
+		}
+
+		Describe("with no changes in etcd", func() {
+			BeforeEach(func() {
+				saveState()
+				etcd, cbs = startDriver(10)
+				Eventually(cbs.getStatuses).Should(Equal([]store.DriverStatus{
+					store.WaitForDatastore,
+					store.ResyncInProgress,
+					store.InSync,
+				}))
+			})
+
+			It("should send the saved keys and resume watching", func() {
+				Expect(cbs.getValues()).To(Equal(map[string]string{
+					keyA: "a1",
+					keyB: "b1",
+				}))
+				Eventually(etcd.watcherOpts).Should(Receive(Equal(client.WatcherOptions{
+					AfterIndex: 10,
+					Recursive:  true,
+				})))
+				etcd.expectNoSnapshotRequest()
+			})
+			It("should send only changes from the watcher", func() {
+				etcd.sendWatchResult(setEvent(keyA, "a1", 11))
+				etcd.sendWatchResult(deleteEvent(keyB, 12))
+				Eventually(cbs.getValues).Should(Equal(map[string]string{
+					keyA: "a1",
+				}))
+				Expect(cbs.getNumUpdates(keyA)).To(Equal(1))
+			})
+			It("should fall back to a full resync if etcd has compacted the index", func() {
+				etcd.sendWatchResult(indexCleared(50))
+				etcd.sendSnapshot(snapshot(50, kvAt{keyB, "b1", 6}))
+				Eventually(cbs.lastStatus).Should(Equal(store.InSync))
+				Expect(cbs.getValues()).To(Equal(map[string]string{keyB: "b1"}))
+			})
+
+		})
+
+		Describe("with changes in etcd since the state was saved", func() {
+			BeforeEach(func() {
+				saveState()
+				etcd, cbs = startDriver(12)
+				Eventually(cbs.getValues).Should(Equal(map[string]string{
+					keyA: "a1",
+					keyB: "b1",
+				}))
+			})
+
+			It("should stay out of sync until the watcher catches up", func() {
+				Consistently(cbs.lastStatus, "200ms").Should(Equal(store.ResyncInProgress))
+				etcd.sendWatchResult(setEvent(keyA, "a2", 11))
+				Consistently(cbs.lastStatus, "200ms").Should(Equal(store.ResyncInProgress))
+				etcd.sendWatchResult(deleteEvent(keyB, 12))
+				Eventually(cbs.lastStatus).Should(Equal(store.InSync))
+				Expect(cbs.getValues()).To(Equal(map[string]string{keyA: "a2"}))
+			})
+			It("should catch up if the last changes were outside /calico/v1", func() {
+				etcd.sendWatchResult(setEvent(keyA, "a2", 11))
+				Eventually(cbs.lastStatus, "5s").Should(Equal(store.InSync))
+				Expect(cbs.getValues()).To(Equal(map[string]string{
+					keyA: "a2",
+					keyB: "b1",
+				}))
+			})
+			It("should fall back to a full resync if etcd has compacted the index while catching up", func() {
+				etcd.sendWatchResult(indexCleared(50))
+				etcd.sendSnapshot(snapshot(50, kvAt{keyB, "b1", 6}))
+				Eventually(cbs.lastStatus).Should(Equal(store.InSync))
+				Expect(cbs.getValues()).To(Equal(map[string]string{keyB: "b1"}))
+			})
+		})
+	})
+})
+
+var _ = Describe("etcd driver status reporting", func() {
+	var etcd *fakeEtcd
+	var cbs *recordingCallbacks
+
+	BeforeEach(func() {
+		etcd = newFakeEtcd()
+		cbs = newRecordingCallbacks()
+		NewWithKeysAPIs(cbs, &store.DriverConfiguration{
+			FelixHostname:        "hostname",
+			StatusReportInterval: 10 * time.Second,
+			StatusTTL:            30 * time.Second,
+			Version:              "1.2.3",
+		}, etcd, etcd).Start()
+	})
+
+	nextStatus := func() (setRequest, backend.HostStatus) {
+		var req setRequest
+		Eventually(etcd.sets).Should(Receive(&req))
+		var status backend.HostStatus
+		Expect(json.Unmarshal([]byte(req.value), &status)).To(Succeed())
+		return req, status
+	}
+
+	It("should report its status with a TTL", func() {
+		req, status := nextStatus()
+		Expect(req.key).To(Equal("/calico/felix/v1/host/hostname/status"))
+		Expect(req.opts.TTL).To(Equal(30 * time.Second))
+		Expect(status.Version).To(Equal("1.2.3"))
+		Expect(status.SyncStatus).To(Equal("wait-for-ready"))
+	})
+	It("should report promptly when it's in sync", func() {
+		etcd.sendSnapshot(snapshot(10, kvAt{keyA, "a1", 5}))
+		Eventually(func() string {
+			_, status := nextStatus()
+			return status.SyncStatus
+		}).Should(Equal("in-sync"))
+	})
+})
+
+var _ = Describe("etcd driver endpoint status reporting", func() {
+	var etcd *fakeEtcd
+	var driver store.Driver
+
+	const hostDir = "/calico/felix/v1/host/hostname"
+
+	BeforeEach(func() {
+		etcd = newFakeEtcd()
+		etcd.statusTree = &client.Node{Key: hostDir, Dir: true, Nodes: []*client.Node{
+			{Key: hostDir + "/status", Value: "{}"},
+			{Key: hostDir + "/endpoint", Dir: true, Nodes: []*client.Node{
+				{Key: hostDir + "/endpoint/eth0", Value: `{"status":"up"}`},
+				{Key: hostDir + "/endpoint/eth1", Value: `{"status":"up"}`},
+			}},
+		}}
+		driver = NewWithKeysAPIs(newRecordingCallbacks(), &store.DriverConfiguration{
+			FelixHostname:              "hostname",
+			EndpointStatusRateLimit:    5,
+			EndpointStatusCleanupDelay: 10 * time.Millisecond,
+		}, etcd, etcd)
+		driver.Start()
+	})
+
+	report := func(id store.EndpointID, statusOrNil *string) {
+		driver.(store.EndpointStatusReporter).ReportEndpointStatus(id, statusOrNil)
+	}
+	up := "up"
+	down := "down"
+
+	It("should write a workload endpoint's status", func() {
+		report(store.EndpointID{
+			OrchestratorID: "k8s",
+			WorkloadID:     "pod1",
+			EndpointID:     "eth0",
+		}, &up)
+		var req setRequest
+		Eventually(etcd.sets).Should(Receive(&req))
+		Expect(req.key).To(Equal(hostDir + "/workload/k8s/pod1/endpoint/eth0"))
+		Expect(req.value).To(MatchJSON(`{"status":"up"}`))
+	})
+	It("should write a host endpoint's status", func() {
+		report(store.EndpointID{EndpointID: "eth0"}, &up)
+		var req setRequest
+		Eventually(etcd.sets).Should(Receive(&req))
+		Expect(req.key).To(Equal(hostDir + "/endpoint/eth0"))
+	})
+	It("should delete the status of a removed endpoint", func() {
+		report(store.EndpointID{EndpointID: "eth0"}, nil)
+		Eventually(etcd.deletes).Should(Receive(Equal(hostDir + "/endpoint/eth0")))
+	})
+	It("should coalesce updates while rate limited", func() {
+		id := store.EndpointID{EndpointID: "eth0"}
+		report(id, &up)
+		Eventually(etcd.sets).Should(Receive())
+		// The writer is now waiting before its next write.
+		report(id, &down)
+		report(id, &up)
+		var req setRequest
+		Eventually(etcd.sets).Should(Receive(&req))
+		Expect(req.value).To(MatchJSON(`{"status":"up"}`))
+		Consistently(etcd.sets, "300ms").ShouldNot(Receive())
+	})
+	It("should delete stale statuses once in sync", func() {
+		report(store.EndpointID{EndpointID: "eth0"}, &up)
+		Eventually(etcd.sets).Should(Receive())
+		etcd.sendSnapshot(snapshot(10))
+		Eventually(etcd.deletes).Should(Receive(Equal(hostDir + "/endpoint/eth1")))
+		Consistently(etcd.deletes, "300ms").ShouldNot(Receive())
+	})
+})
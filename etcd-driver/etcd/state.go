@@ -0,0 +1,88 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// stateFormatVersion is bumped whenever the format of the state file changes
+// incompatibly.  A state file with a different version is ignored.
+const stateFormatVersion = 1
+
+// persistedState is the driver state that we save to disk so that a restarted
+// driver can resume watching etcd from where it left off instead of reading a
+// full snapshot.
+type persistedState struct {
+	Version int `json:"version"`
+	// Index is the etcd index up to which all events are reflected in
+	// Keys.  The watcher resumes from here.
+	Index uint64         `json:"index"`
+	Keys  []persistedKey `json:"keys"`
+}
+
+// persistedKey holds the high-water mark and value of a single key.
+type persistedKey struct {
+	Key   string `json:"k"`
+	HWM   uint64 `json:"hwm"`
+	Value string `json:"v"`
+}
+
+// loadState reads the state file at the given path.
+func loadState(path string) (*persistedState, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &persistedState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	if state.Version != stateFormatVersion {
+		return nil, fmt.Errorf("unsupported state file version %v",
+			state.Version)
+	}
+	return state, nil
+}
+
+// saveState writes the state file at the given path.  It writes to a
+// temporary file and then renames it into place so that a crash can't leave a
+// truncated state file behind.
+func saveState(path string, state *persistedState) error {
+	state.Version = stateFormatVersion
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/coreos/etcd/client"
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+	"github.com/projectcalico/calico-go/lib/backend"
+	"golang.org/x/net/context"
+)
+
+// reportStatus periodically writes our status to etcd, and also whenever our
+// sync status changes.  The status key has a TTL so that it disappears if we
+// stop reporting, allowing "calicoctl get nodeStatus" to show which hosts
+// are alive.
+func (driver *etcdDriver) reportStatus() {
+	key := fmt.Sprintf("/calico/felix/v1/host/%s/status",
+		driver.config.FelixHostname)
+	ticker := time.NewTicker(driver.config.StatusReportInterval)
+	for {
+		driver.writeStatus(key)
+		select {
+		case <-ticker.C:
+		case <-driver.statusChanged:
+		}
+	}
+}
+
+func (driver *etcdDriver) writeStatus(key string) {
+	status := backend.HostStatus{
+		Time:       time.Now().UTC().Format(time.RFC3339),
+		Uptime:     time.Since(driver.startTime).Seconds(),
+		Version:    driver.config.Version,
+		SyncStatus: store.DriverStatus(atomic.LoadUint32(&driver.status)).String(),
+	}
+	value, err := json.Marshal(status)
+	if err != nil {
+		log.Fatalf("Failed to marshal status %#v: %v", status, err)
+	}
+	_, err = driver.snapshotKeysAPI.Set(context.Background(), key,
+		string(value), &client.SetOptions{TTL: driver.config.StatusTTL})
+	if err != nil {
+		log.Warningf("Failed to report status to etcd: %v", err)
+		return
+	}
+	log.Debugf("Reported status: %s", value)
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package felix
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+// Codec converts messages to and from bytes on the Felix socket.  The codec
+// used for the handshake is configured on both sides; Felix can then ask to
+// switch to a different one by listing the codecs that it supports, in order
+// of preference, in its init message.
+type Codec interface {
+	Name() string
+	NewEncoder(w io.Writer) Encoder
+	// NewDecoder returns a decoder that reads from r.  Decoders may read
+	// ahead so all decoders for a connection must share the same reader.
+	NewDecoder(r *bufio.Reader) Decoder
+}
+
+type Encoder interface {
+	Encode(msg Message) error
+}
+
+type Decoder interface {
+	// Decode reads the next message.  Returns an ErrorMalformedMessage
+	// if the message couldn't be parsed, after which it is safe to carry
+	// on reading, or any other error if reading failed.
+	Decode() (Message, error)
+}
+
+// Error indicating that a codec name isn't known.
+type ErrorUnknownCodec struct {
+	Name string
+}
+
+func (e ErrorUnknownCodec) Error() string {
+	return fmt.Sprintf("unknown codec %q", e.Name)
+}
+
+var codecs = map[string]Codec{}
+
+func registerCodec(codec Codec) {
+	codecs[codec.Name()] = codec
+}
+
+func init() {
+	registerCodec(msgpackCodec{})
+	registerCodec(jsonCodec{})
+}
+
+// LookupCodec returns the codec with the given name.
+func LookupCodec(name string) (Codec, error) {
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, ErrorUnknownCodec{Name: name}
+	}
+	return codec, nil
+}
+
+// CodecNames returns the names of the supported codecs, sorted.
+func CodecNames() []string {
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// msgpackCodec encodes each message as a msgpack map.  It is the default.
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+
+func (msgpackCodec) NewEncoder(w io.Writer) Encoder {
+	return msgpackEncoder{msgpack.NewEncoder(w)}
+}
+
+func (msgpackCodec) NewDecoder(r *bufio.Reader) Decoder {
+	return msgpackDecoder{msgpack.NewDecoder(r)}
+}
+
+type msgpackEncoder struct {
+	enc *msgpack.Encoder
+}
+
+func (e msgpackEncoder) Encode(msg Message) error {
+	return e.enc.Encode(ToWire(msg))
+}
+
+type msgpackDecoder struct {
+	dec *msgpack.Decoder
+}
+
+func (d msgpackDecoder) Decode() (Message, error) {
+	raw, err := d.dec.DecodeInterface()
+	if err != nil {
+		return nil, err
+	}
+	return ParseMessage(raw)
+}
+
+// jsonCodec encodes each message as a JSON object on its own line, which makes
+// it easy to watch the stream with socat.
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) NewEncoder(w io.Writer) Encoder {
+	return jsonEncoder{w}
+}
+
+func (jsonCodec) NewDecoder(r *bufio.Reader) Decoder {
+	return jsonDecoder{r}
+}
+
+type jsonEncoder struct {
+	w io.Writer
+}
+
+func (e jsonEncoder) Encode(msg Message) error {
+	line, err := json.Marshal(ToWire(msg))
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(append(line, '\n'))
+	return err
+}
+
+type jsonDecoder struct {
+	r *bufio.Reader
+}
+
+func (d jsonDecoder) Decode() (Message, error) {
+	line, err := d.r.ReadBytes('\n')
+	if err != nil {
+		if err == io.EOF && len(line) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(line, &m); err != nil {
+		return nil, ErrorMalformedMessage{Msg: string(line), Reason: err.Error()}
+	}
+	// ParseMessage expects maps as decoded by msgpack.
+	raw := make(map[interface{}]interface{}, len(m))
+	for k, v := range m {
+		raw[k] = v
+	}
+	return ParseMessage(raw)
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package felix_test
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	. "github.com/projectcalico/calico-go/etcd-driver/felix"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/projectcalico/calico-go/etcd-driver/policy"
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+)
+
+var _ = Describe("Codecs", func() {
+	It("should know the codec names", func() {
+		Expect(CodecNames()).To(Equal([]string{"json", "msgpack", "protobuf"}))
+		_, err := LookupCodec("xml")
+		Expect(err).To(Equal(ErrorUnknownCodec{Name: "xml"}))
+	})
+
+	// Messages that Felix sends to the driver, which the driver decodes.
+	fromFelix := []Message{
+		&InitMsg{
+			ProtocolVersion:    1,
+			MinProtocolVersion: 1,
+			Features:           []string{"batching"},
+			Codecs:             []string{"protobuf"},
+		},
+		&ResyncMsg{},
+		&EndpointStatusMsg{
+			ID: store.EndpointID{
+				OrchestratorID: "k8s",
+				WorkloadID:     "pod1",
+				EndpointID:     "eth0",
+			},
+			StatusOrNil: strPtr("up"),
+		},
+		&EndpointStatusMsg{ID: store.EndpointID{EndpointID: "eth0"}},
+	}
+
+	for _, name := range []string{"msgpack", "json", "protobuf"} {
+		name := name
+		Describe(name, func() {
+			var codec Codec
+			var buf *bytes.Buffer
+			var dec Decoder
+
+			BeforeEach(func() {
+				var err error
+				codec, err = LookupCodec(name)
+				Expect(err).NotTo(HaveOccurred())
+				buf = &bytes.Buffer{}
+				dec = codec.NewDecoder(bufio.NewReader(buf))
+			})
+
+			It("should round-trip messages from Felix", func() {
+				enc := codec.NewEncoder(buf)
+				for _, msg := range fromFelix {
+					Expect(enc.Encode(msg)).To(Succeed())
+				}
+				for _, msg := range fromFelix {
+					Expect(dec.Decode()).To(Equal(msg))
+				}
+				_, err := dec.Decode()
+				Expect(err).To(Equal(io.EOF))
+			})
+			It("should encode messages to Felix", func() {
+				enc := codec.NewEncoder(buf)
+				Expect(enc.Encode(&KVsMsg{KVs: []KV{kv("/a", "1"), kv("/b", nil)}})).To(Succeed())
+				Expect(enc.Encode(&ConfigLoadedMsg{
+					Global: map[string]string{"a": "b"},
+					Host:   map[string]string{},
+				})).To(Succeed())
+				Expect(enc.Encode(&StatusMsg{Status: store.InSync})).To(Succeed())
+				Expect(buf.Len()).NotTo(BeZero())
+			})
+			It("should carry on after a malformed message", func() {
+				enc := codec.NewEncoder(buf)
+				Expect(enc.Encode(&EndpointStatusMsg{
+					ID: store.EndpointID{EndpointID: "eth0/1"},
+				})).To(Succeed())
+				Expect(enc.Encode(&ResyncMsg{})).To(Succeed())
+				_, err := dec.Decode()
+				Expect(err).To(BeAssignableToTypeOf(ErrorMalformedMessage{}))
+				Expect(dec.Decode()).To(Equal(&ResyncMsg{}))
+			})
+		})
+	}
+
+	It("should write JSON one message per line", func() {
+		codec, _ := LookupCodec("json")
+		buf := &bytes.Buffer{}
+		enc := codec.NewEncoder(buf)
+		Expect(enc.Encode(&StatusMsg{Status: store.InSync})).To(Succeed())
+		Expect(enc.Encode(&ResyncMsg{})).To(Succeed())
+		Expect(buf.String()).To(Equal(
+			`{"status":"in-sync","type":"stat"}` + "\n" + `{"type":"resync"}` + "\n"))
+	})
+	It("should round-trip messages to Felix through protobuf", func() {
+		codec, _ := LookupCodec("protobuf")
+		buf := &bytes.Buffer{}
+		enc := codec.NewEncoder(buf)
+		dec := codec.NewDecoder(bufio.NewReader(buf))
+		msgs := []Message{
+			&HandshakeMsg{ProtocolVersion: 1, Features: []string{"ipsets"}, Codec: "protobuf"},
+			&KVsMsg{KVs: []KV{kv("/a", "1"), kv("/b", nil)}},
+			&UpdateMsg{KV: kv("/c", "2")},
+			&ConfigChangedMsg{Global: map[string]string{"a": "b"}},
+			&StatusMsg{Status: store.ResyncInProgress},
+			&SelectorAddedMsg{SelectorID: "s1"},
+			&IPAddedMsg{SelectorID: "s1", IPVersion: 6, IP: "fd00::1"},
+			&IPRemovedMsg{SelectorID: "s1", IPVersion: 4, IP: "10.0.0.1"},
+			&EndpointPolicyMsg{
+				ID: store.EndpointID{
+					OrchestratorID: "k8s",
+					WorkloadID:     "pod1",
+					EndpointID:     "eth0",
+				},
+				Tiers: []policy.TierPolicies{
+					{Name: "t1", Policies: []string{"p1", "p2"}},
+					{Name: "t2", Policies: []string{"p3"}},
+				},
+			},
+			&EndpointPolicyMsg{
+				ID:    store.EndpointID{EndpointID: "eth1"},
+				Tiers: []policy.TierPolicies{},
+			},
+			&EndpointPolicyMsg{ID: store.EndpointID{EndpointID: "eth1"}},
+		}
+		for _, msg := range msgs {
+			Expect(enc.Encode(msg)).To(Succeed())
+		}
+		for _, msg := range msgs {
+			Expect(dec.Decode()).To(Equal(msg))
+		}
+	})
+})
@@ -0,0 +1,136 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package felix
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+)
+
+const (
+	initialDialBackoff = 100 * time.Millisecond
+	maxDialBackoff     = 10 * time.Second
+)
+
+// Error indicating that we were asked to stop before we connected to Felix.
+type ErrorStopped struct{}
+
+func (e ErrorStopped) Error() string {
+	return "stopped before connecting to Felix"
+}
+
+// Error indicating that Felix sent us a message that we couldn't understand.
+type ErrorMalformedMessage struct {
+	Msg    interface{}
+	Reason string
+}
+
+func (e ErrorMalformedMessage) Error() string {
+	return fmt.Sprintf("malformed message from Felix (%s): %#v", e.Reason, e.Msg)
+}
+
+// Dial connects to Felix's unix socket, retrying with exponential backoff until
+// it succeeds or the stop channel is closed.
+func Dial(socketPath string, stop <-chan struct{}) (net.Conn, error) {
+	backoff := initialDialBackoff
+	for {
+		conn, err := net.Dial("unix", socketPath)
+		if err == nil {
+			log.Infof("Connected to Felix at %v", socketPath)
+			return conn, nil
+		}
+		log.Warningf("Failed to connect to Felix at %v, retrying in %v: %v",
+			socketPath, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-stop:
+			return nil, ErrorStopped{}
+		}
+		backoff *= 2
+		if backoff > maxDialBackoff {
+			backoff = maxDialBackoff
+		}
+	}
+}
+
+// MessageType extracts the type of a decoded message from Felix.
+func MessageType(msg interface{}) (string, error) {
+	m, ok := msg.(map[interface{}]interface{})
+	if !ok {
+		return "", ErrorMalformedMessage{Msg: msg, Reason: "not a map"}
+	}
+	msgType, ok := m["type"].(string)
+	if !ok {
+		return "", ErrorMalformedMessage{Msg: msg, Reason: "missing type"}
+	}
+	return msgType, nil
+}
+
+// EndpointStatusFromMessage extracts the endpoint ID and status from an
+// "endpoint_status" message from Felix.  The message has "orchestrator",
+// "workload_id" and "endpoint_id" fields identifying the endpoint (the first
+// two are omitted for a host endpoint) and a "status" field, such as "up".  A
+// nil status means that the endpoint has gone away.
+func EndpointStatusFromMessage(msg interface{}) (store.EndpointID, *string, error) {
+	var id store.EndpointID
+	m, ok := msg.(map[interface{}]interface{})
+	if !ok {
+		return id, nil, ErrorMalformedMessage{Msg: msg, Reason: "not a map"}
+	}
+	getString := func(field string) (string, error) {
+		value, ok := m[field]
+		if !ok || value == nil {
+			return "", nil
+		}
+		s, ok := value.(string)
+		if !ok {
+			return "", ErrorMalformedMessage{
+				Msg:    msg,
+				Reason: fmt.Sprintf("%v is not a string", field),
+			}
+		}
+		return s, nil
+	}
+	var err error
+	if id.OrchestratorID, err = getString("orchestrator"); err != nil {
+		return id, nil, err
+	}
+	if id.WorkloadID, err = getString("workload_id"); err != nil {
+		return id, nil, err
+	}
+	if id.EndpointID, err = getString("endpoint_id"); err != nil {
+		return id, nil, err
+	}
+	if id.EndpointID == "" || (id.OrchestratorID == "") != (id.WorkloadID == "") {
+		return id, nil, ErrorMalformedMessage{Msg: msg, Reason: "bad endpoint ID"}
+	}
+	for _, part := range []string{id.OrchestratorID, id.WorkloadID, id.EndpointID} {
+		if strings.Contains(part, "/") {
+			return id, nil, ErrorMalformedMessage{Msg: msg, Reason: "bad endpoint ID"}
+		}
+	}
+	if m["status"] == nil {
+		return id, nil, nil
+	}
+	status, err := getString("status")
+	if err != nil {
+		return id, nil, err
+	}
+	return id, &status, nil
+}
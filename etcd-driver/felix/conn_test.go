@@ -0,0 +1,96 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package felix_test
+
+import (
+	. "github.com/projectcalico/calico-go/etcd-driver/felix"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+)
+
+var _ = Describe("MessageType", func() {
+	It("should return the type", func() {
+		Expect(MessageType(map[interface{}]interface{}{"type": "init"})).To(Equal("init"))
+	})
+	It("should reject a message that isn't a map", func() {
+		_, err := MessageType("junk")
+		Expect(err).To(BeAssignableToTypeOf(ErrorMalformedMessage{}))
+	})
+	It("should reject a message without a type", func() {
+		_, err := MessageType(map[interface{}]interface{}{"foo": "bar"})
+		Expect(err).To(BeAssignableToTypeOf(ErrorMalformedMessage{}))
+	})
+})
+
+var _ = Describe("EndpointStatusFromMessage", func() {
+	It("should parse a workload endpoint status", func() {
+		id, status, err := EndpointStatusFromMessage(map[interface{}]interface{}{
+			"type":         "endpoint_status",
+			"orchestrator": "k8s",
+			"workload_id":  "pod1",
+			"endpoint_id":  "eth0",
+			"status":       "up",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal(store.EndpointID{
+			OrchestratorID: "k8s",
+			WorkloadID:     "pod1",
+			EndpointID:     "eth0",
+		}))
+		Expect(id.IsHostEndpoint()).To(BeFalse())
+		Expect(status).To(Equal(strPtr("up")))
+	})
+	It("should parse a host endpoint status", func() {
+		id, status, err := EndpointStatusFromMessage(map[interface{}]interface{}{
+			"type":        "endpoint_status",
+			"endpoint_id": "eth0",
+			"status":      "down",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal(store.EndpointID{EndpointID: "eth0"}))
+		Expect(id.IsHostEndpoint()).To(BeTrue())
+		Expect(status).To(Equal(strPtr("down")))
+	})
+	It("should parse a nil status as a deletion", func() {
+		_, status, err := EndpointStatusFromMessage(map[interface{}]interface{}{
+			"type":        "endpoint_status",
+			"endpoint_id": "eth0",
+			"status":      nil,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(BeNil())
+	})
+	expectMalformed := func(msg interface{}) {
+		_, _, err := EndpointStatusFromMessage(msg)
+		Expect(err).To(BeAssignableToTypeOf(ErrorMalformedMessage{}))
+	}
+	It("should reject a message that isn't a map", func() {
+		expectMalformed("junk")
+	})
+	It("should reject a message without an endpoint ID", func() {
+		expectMalformed(map[interface{}]interface{}{"status": "up"})
+	})
+	It("should reject a workload without an orchestrator", func() {
+		expectMalformed(map[interface{}]interface{}{"workload_id": "pod1", "endpoint_id": "eth0"})
+	})
+	It("should reject an ID containing a slash", func() {
+		expectMalformed(map[interface{}]interface{}{"endpoint_id": "eth0/1"})
+	})
+	It("should reject a status that isn't a string", func() {
+		expectMalformed(map[interface{}]interface{}{"endpoint_id": "eth0", "status": 1})
+	})
+})
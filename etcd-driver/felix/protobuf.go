@@ -0,0 +1,281 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package felix
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/projectcalico/calico-go/etcd-driver/felix/pb"
+	"github.com/projectcalico/calico-go/etcd-driver/policy"
+)
+
+// maxProtobufFrame bounds the length prefix that we'll accept, to avoid
+// allocating a silly amount of memory if the stream gets out of step.
+const maxProtobufFrame = 64 * 1024 * 1024
+
+func init() {
+	registerCodec(protobufCodec{})
+}
+
+// protobufCodec encodes each message as a pb.Envelope, preceded by its length
+// as a 4-byte, big-endian integer.  The schema is in pb/felix.proto.
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string { return "protobuf" }
+
+func (protobufCodec) NewEncoder(w io.Writer) Encoder {
+	return protobufEncoder{w}
+}
+
+func (protobufCodec) NewDecoder(r *bufio.Reader) Decoder {
+	return protobufDecoder{r}
+}
+
+type protobufEncoder struct {
+	w io.Writer
+}
+
+func (e protobufEncoder) Encode(msg Message) error {
+	env, err := toEnvelope(msg)
+	if err != nil {
+		return err
+	}
+	data, err := proto.Marshal(env)
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	_, err = e.w.Write(frame)
+	return err
+}
+
+type protobufDecoder struct {
+	r *bufio.Reader
+}
+
+func (d protobufDecoder) Decode() (Message, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(d.r, header[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:])
+	if length > maxProtobufFrame {
+		// We can't skip a frame this big, the stream is probably
+		// corrupt.
+		return nil, fmt.Errorf("protobuf frame too long: %d bytes", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(d.r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	env := &pb.Envelope{}
+	if err := proto.Unmarshal(data, env); err != nil {
+		return nil, ErrorMalformedMessage{Msg: data, Reason: err.Error()}
+	}
+	return fromEnvelope(env)
+}
+
+// toEnvelope converts a message to its protobuf form.
+func toEnvelope(msg Message) (*pb.Envelope, error) {
+	env := &pb.Envelope{}
+	switch msg := msg.(type) {
+	case *InitMsg:
+		env.Init = &pb.Init{
+			ProtocolVersion:    proto.Int32(int32(msg.ProtocolVersion)),
+			MinProtocolVersion: proto.Int32(int32(msg.MinProtocolVersion)),
+			Features:           msg.Features,
+			Codecs:             msg.Codecs,
+		}
+	case *HandshakeMsg:
+		env.Handshake = &pb.Handshake{
+			ProtocolVersion: proto.Int32(int32(msg.ProtocolVersion)),
+			Features:        msg.Features,
+			Codec:           proto.String(msg.Codec),
+		}
+	case *IncompatibleMsg:
+		env.Incompatible = &pb.Incompatible{
+			Reason:             proto.String(msg.Reason),
+			ProtocolVersion:    proto.Int32(int32(msg.ProtocolVersion)),
+			MinProtocolVersion: proto.Int32(int32(msg.MinProtocolVersion)),
+		}
+	case *ResyncMsg:
+		env.Resync = &pb.Resync{}
+	case *EndpointStatusMsg:
+		env.EndpointStatus = &pb.EndpointStatus{
+			EndpointId: proto.String(msg.ID.EndpointID),
+			Status:     msg.StatusOrNil,
+		}
+		if !msg.ID.IsHostEndpoint() {
+			env.EndpointStatus.Orchestrator = proto.String(msg.ID.OrchestratorID)
+			env.EndpointStatus.WorkloadId = proto.String(msg.ID.WorkloadID)
+		}
+	case *ConfigLoadedMsg:
+		env.ConfigLoaded = &pb.Config{Global: msg.Global, Host: msg.Host}
+	case *ConfigChangedMsg:
+		env.ConfigChanged = &pb.Config{Global: msg.Global, Host: msg.Host}
+	case *StatusMsg:
+		env.Status = &pb.Status{Status: proto.String(msg.wireStatus())}
+	case *KVsMsg:
+		env.Kvs = &pb.KVs{Kvs: make([]*pb.KV, len(msg.KVs))}
+		for i, kv := range msg.KVs {
+			env.Kvs.Kvs[i] = &pb.KV{Key: proto.String(kv.Key), Value: kv.ValueOrNil}
+		}
+	case *UpdateMsg:
+		env.Update = &pb.KV{Key: proto.String(msg.Key), Value: msg.ValueOrNil}
+	case *SelectorAddedMsg:
+		env.SelectorAdded = &pb.Selector{SelId: proto.String(msg.SelectorID)}
+	case *SelectorRemovedMsg:
+		env.SelectorRemoved = &pb.Selector{SelId: proto.String(msg.SelectorID)}
+	case *IPAddedMsg:
+		env.IpAdded = &pb.IP{
+			SelId:     proto.String(msg.SelectorID),
+			IpVersion: proto.Int32(int32(msg.IPVersion)),
+			Ip:        proto.String(msg.IP),
+		}
+	case *IPRemovedMsg:
+		env.IpRemoved = &pb.IP{
+			SelId:     proto.String(msg.SelectorID),
+			IpVersion: proto.Int32(int32(msg.IPVersion)),
+			Ip:        proto.String(msg.IP),
+		}
+	case *EndpointPolicyMsg:
+		env.EndpointPolicy = &pb.EndpointPolicy{
+			EndpointId: proto.String(msg.ID.EndpointID),
+			Tiers:      make([]*pb.TierPolicies, len(msg.Tiers)),
+		}
+		if !msg.ID.IsHostEndpoint() {
+			env.EndpointPolicy.Orchestrator = proto.String(msg.ID.OrchestratorID)
+			env.EndpointPolicy.WorkloadId = proto.String(msg.ID.WorkloadID)
+		}
+		for i, tier := range msg.Tiers {
+			env.EndpointPolicy.Tiers[i] = &pb.TierPolicies{
+				Name:     proto.String(tier.Name),
+				Policies: tier.Policies,
+			}
+		}
+		if msg.Tiers == nil {
+			env.EndpointPolicy.Removed = proto.Bool(true)
+		}
+	default:
+		return nil, fmt.Errorf("no protobuf encoding for %q message", msg.MessageType())
+	}
+	return env, nil
+}
+
+// fromEnvelope converts a message from its protobuf form.
+func fromEnvelope(env *pb.Envelope) (Message, error) {
+	switch {
+	case env.Init != nil:
+		return &InitMsg{
+			ProtocolVersion:    int(env.Init.GetProtocolVersion()),
+			MinProtocolVersion: int(env.Init.GetMinProtocolVersion()),
+			Features:           env.Init.Features,
+			Codecs:             env.Init.Codecs,
+		}, nil
+	case env.Handshake != nil:
+		return &HandshakeMsg{
+			ProtocolVersion: int(env.Handshake.GetProtocolVersion()),
+			Features:        env.Handshake.Features,
+			Codec:           env.Handshake.GetCodec(),
+		}, nil
+	case env.Incompatible != nil:
+		return &IncompatibleMsg{
+			Reason:             env.Incompatible.GetReason(),
+			ProtocolVersion:    int(env.Incompatible.GetProtocolVersion()),
+			MinProtocolVersion: int(env.Incompatible.GetMinProtocolVersion()),
+		}, nil
+	case env.Resync != nil:
+		return &ResyncMsg{}, nil
+	case env.EndpointStatus != nil:
+		// Reuse the validation of the map form.
+		w := map[interface{}]interface{}{
+			"type":        MsgTypeEndpointStatus,
+			"endpoint_id": env.EndpointStatus.GetEndpointId(),
+			"status":      nil,
+		}
+		if env.EndpointStatus.Orchestrator != nil {
+			w["orchestrator"] = *env.EndpointStatus.Orchestrator
+		}
+		if env.EndpointStatus.WorkloadId != nil {
+			w["workload_id"] = *env.EndpointStatus.WorkloadId
+		}
+		if env.EndpointStatus.Status != nil {
+			w["status"] = *env.EndpointStatus.Status
+		}
+		return ParseMessage(w)
+	case env.ConfigLoaded != nil:
+		return &ConfigLoadedMsg{Global: env.ConfigLoaded.Global, Host: env.ConfigLoaded.Host}, nil
+	case env.ConfigChanged != nil:
+		return &ConfigChangedMsg{Global: env.ConfigChanged.Global, Host: env.ConfigChanged.Host}, nil
+	case env.Status != nil:
+		status, ok := statusesByWireName[env.Status.GetStatus()]
+		if !ok {
+			return nil, ErrorMalformedMessage{Msg: env, Reason: "unknown status"}
+		}
+		return &StatusMsg{Status: status}, nil
+	case env.Kvs != nil:
+		msg := &KVsMsg{KVs: make([]KV, len(env.Kvs.Kvs))}
+		for i, kv := range env.Kvs.Kvs {
+			msg.KVs[i] = KV{Key: kv.GetKey(), ValueOrNil: kv.Value}
+		}
+		return msg, nil
+	case env.Update != nil:
+		return &UpdateMsg{KV: KV{Key: env.Update.GetKey(), ValueOrNil: env.Update.Value}}, nil
+	case env.SelectorAdded != nil:
+		return &SelectorAddedMsg{SelectorID: env.SelectorAdded.GetSelId()}, nil
+	case env.SelectorRemoved != nil:
+		return &SelectorRemovedMsg{SelectorID: env.SelectorRemoved.GetSelId()}, nil
+	case env.IpAdded != nil:
+		return &IPAddedMsg{
+			SelectorID: env.IpAdded.GetSelId(),
+			IPVersion:  int(env.IpAdded.GetIpVersion()),
+			IP:         env.IpAdded.GetIp(),
+		}, nil
+	case env.IpRemoved != nil:
+		return &IPRemovedMsg{
+			SelectorID: env.IpRemoved.GetSelId(),
+			IPVersion:  int(env.IpRemoved.GetIpVersion()),
+			IP:         env.IpRemoved.GetIp(),
+		}, nil
+	case env.EndpointPolicy != nil:
+		ep := env.EndpointPolicy
+		msg := &EndpointPolicyMsg{}
+		msg.ID.EndpointID = ep.GetEndpointId()
+		if ep.Orchestrator != nil {
+			msg.ID.OrchestratorID = *ep.Orchestrator
+		}
+		if ep.WorkloadId != nil {
+			msg.ID.WorkloadID = *ep.WorkloadId
+		}
+		if ep.Removed == nil || !*ep.Removed {
+			msg.Tiers = make([]policy.TierPolicies, len(ep.Tiers))
+			for i, tier := range ep.Tiers {
+				msg.Tiers[i] = policy.TierPolicies{Name: tier.GetName(), Policies: tier.Policies}
+			}
+		}
+		return msg, nil
+	}
+	// Probably a message type from a newer protocol version.
+	return nil, ErrorMalformedMessage{Msg: env, Reason: "empty or unknown message"}
+}
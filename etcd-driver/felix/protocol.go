@@ -0,0 +1,558 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package felix
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/projectcalico/calico-go/etcd-driver/policy"
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+)
+
+// The protocol between Felix and the driver is a stream of messages, each with
+// a type, encoded by one of the codecs in codec.go.  Felix opens the
+// conversation with an "init" message giving the range of protocol versions,
+// the optional features and the codecs that it supports.  The driver replies
+// with a "handshake" message giving the protocol version, features and codec
+// that both sides will use or, if it can't talk to Felix, with an
+// "incompatible" message explaining why, after which it closes the connection.
+// Felix must not send anything else until it has received the handshake and
+// the driver sends nothing else before it.  Both sides switch to the chosen
+// codec straight after the handshake.
+const (
+	// ProtocolVersion is the newest version of the protocol that we speak.
+	ProtocolVersion = 1
+	// MinProtocolVersion is the oldest version of the protocol that we
+	// speak.  Felixes from before the protocol was versioned don't send
+	// a version and are treated as version 0.
+	MinProtocolVersion = 1
+)
+
+// Protocol features.  A feature is only used if both sides list it.  Felix
+// must support the RequiredFeatures.
+const (
+	// FeatureBatching: key/value updates are sent in multi-key "kvs"
+	// messages.  Without it, each update is sent in its own "u" message.
+	FeatureBatching = "batching"
+	// FeatureIPSets: the driver sends the members of the IP sets for
+	// policy selectors and tags.  Rule selectors and tags are rewritten
+	// to the IDs of their IP sets so Felix can't resolve them itself;
+	// this feature is required.
+	FeatureIPSets = "ipsets"
+	// FeatureEndpointStatus: Felix sends "endpoint_status" messages and
+	// the driver writes them to the datastore.  The driver only offers
+	// this if its datastore can store endpoint statuses.
+	FeatureEndpointStatus = "endpoint_status"
+	// FeatureEndpointPolicy: the driver sends "endpoint_policy" messages
+	// listing the policies that apply to each local endpoint.  Without
+	// it, they are dropped.
+	FeatureEndpointPolicy = "endpoint_policy"
+)
+
+// RequiredFeatures lists the features that Felix must support.
+var RequiredFeatures = []string{FeatureIPSets}
+
+// Message types.
+const (
+	MsgTypeInit            = "init"
+	MsgTypeHandshake       = "handshake"
+	MsgTypeIncompatible    = "incompatible"
+	MsgTypeResync          = "resync"
+	MsgTypeEndpointStatus  = "endpoint_status"
+	MsgTypeConfigLoaded    = "config_loaded"
+	MsgTypeConfigChanged   = "config_changed"
+	MsgTypeStatus          = "stat"
+	MsgTypeKVs             = "kvs"
+	MsgTypeUpdate          = "u"
+	MsgTypeSelectorAdded   = "sel_added"
+	MsgTypeSelectorRemoved = "sel_removed"
+	MsgTypeIPAdded         = "ip_added"
+	MsgTypeIPRemoved       = "ip_removed"
+	MsgTypeEndpointPolicy  = "endpoint_policy"
+)
+
+// Error indicating that Felix and the driver can't talk to each other.
+// Reconnecting won't help.
+type ErrorIncompatiblePeer struct {
+	Reason string
+}
+
+func (e ErrorIncompatiblePeer) Error() string {
+	return "incompatible Felix: " + e.Reason
+}
+
+// Message is a message sent between Felix and the driver.
+type Message interface {
+	MessageType() string
+	// toWire converts the message to the map that goes on the wire.
+	toWire() map[string]interface{}
+}
+
+// ToWire converts a message to the map that is encoded on the wire, including
+// its "type" field.
+func ToWire(msg Message) map[string]interface{} {
+	m := msg.toWire()
+	m["type"] = msg.MessageType()
+	return m
+}
+
+// InitMsg is sent by Felix when it connects.
+type InitMsg struct {
+	ProtocolVersion    int
+	MinProtocolVersion int
+	Features           []string
+	// Codecs lists the codecs that Felix would like to switch to, in
+	// order of preference.  Empty to stick with the current codec.
+	Codecs []string
+}
+
+func (m *InitMsg) MessageType() string { return MsgTypeInit }
+
+func (m *InitMsg) toWire() map[string]interface{} {
+	return map[string]interface{}{
+		"protocol_version":     m.ProtocolVersion,
+		"min_protocol_version": m.MinProtocolVersion,
+		"features":             m.Features,
+		"codecs":               m.Codecs,
+	}
+}
+
+// HandshakeMsg is the driver's reply to a compatible InitMsg.
+type HandshakeMsg struct {
+	ProtocolVersion int
+	Features        []string
+	// Codec is the name of the codec to use after the handshake.
+	Codec string
+}
+
+func (m *HandshakeMsg) MessageType() string { return MsgTypeHandshake }
+
+func (m *HandshakeMsg) toWire() map[string]interface{} {
+	return map[string]interface{}{
+		"protocol_version": m.ProtocolVersion,
+		"features":         m.Features,
+		"codec":            m.Codec,
+	}
+}
+
+// HasFeature returns true if the feature was negotiated.
+func (m *HandshakeMsg) HasFeature(feature string) bool {
+	for _, f := range m.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// Adapt converts a message for sending to a Felix that negotiated this
+// handshake, splitting batches for a Felix that doesn't support them and
+// dropping messages for optional features that it doesn't support.
+func (m *HandshakeMsg) Adapt(msg Message) []Message {
+	switch msg := msg.(type) {
+	case *KVsMsg:
+		if m.HasFeature(FeatureBatching) {
+			break
+		}
+		updates := make([]Message, len(msg.KVs))
+		for i, kv := range msg.KVs {
+			updates[i] = &UpdateMsg{KV: kv}
+		}
+		return updates
+	case *EndpointPolicyMsg:
+		if !m.HasFeature(FeatureEndpointPolicy) {
+			return nil
+		}
+	}
+	return []Message{msg}
+}
+
+// IncompatibleMsg is the driver's reply to an InitMsg from a Felix that it
+// can't talk to.
+type IncompatibleMsg struct {
+	Reason             string
+	ProtocolVersion    int
+	MinProtocolVersion int
+}
+
+func (m *IncompatibleMsg) MessageType() string { return MsgTypeIncompatible }
+
+func (m *IncompatibleMsg) toWire() map[string]interface{} {
+	return map[string]interface{}{
+		"reason":               m.Reason,
+		"protocol_version":     m.ProtocolVersion,
+		"min_protocol_version": m.MinProtocolVersion,
+	}
+}
+
+// Negotiate checks that we can talk to the Felix that sent init and returns
+// the handshake to reply with.  features lists the optional features that the
+// driver supports and codec is the name of the codec that the init message
+// arrived on, which we keep unless Felix asks for one that we support.
+// Returns an ErrorIncompatiblePeer if there's no protocol version that both
+// sides speak or if Felix doesn't support one of the RequiredFeatures.
+func Negotiate(init *InitMsg, features []string, codec string) (*HandshakeMsg, error) {
+	if init.ProtocolVersion == 0 {
+		return nil, ErrorIncompatiblePeer{Reason: fmt.Sprintf(
+			"Felix didn't send a protocol version, it is too old for "+
+				"this driver, which speaks versions %d-%d",
+			MinProtocolVersion, ProtocolVersion)}
+	}
+	felixMin := init.MinProtocolVersion
+	if felixMin == 0 {
+		felixMin = init.ProtocolVersion
+	}
+	version := init.ProtocolVersion
+	if version > ProtocolVersion {
+		version = ProtocolVersion
+	}
+	if version < MinProtocolVersion || version < felixMin {
+		return nil, ErrorIncompatiblePeer{Reason: fmt.Sprintf(
+			"Felix speaks protocol versions %d-%d but the driver speaks %d-%d",
+			felixMin, init.ProtocolVersion, MinProtocolVersion, ProtocolVersion)}
+	}
+	felixFeatures := make(map[string]bool, len(init.Features))
+	for _, f := range init.Features {
+		felixFeatures[f] = true
+	}
+	for _, f := range RequiredFeatures {
+		if !felixFeatures[f] {
+			return nil, ErrorIncompatiblePeer{Reason: fmt.Sprintf(
+				"Felix doesn't support the %q feature, which this "+
+					"driver requires", f)}
+		}
+	}
+	common := []string{}
+	for _, f := range features {
+		if felixFeatures[f] {
+			common = append(common, f)
+		}
+	}
+	sort.Strings(common)
+	for _, name := range init.Codecs {
+		if _, err := LookupCodec(name); err == nil {
+			codec = name
+			break
+		}
+	}
+	return &HandshakeMsg{
+		ProtocolVersion: version,
+		Features:        common,
+		Codec:           codec,
+	}, nil
+}
+
+// ResyncMsg is sent by Felix when it suspects that it's out of sync.
+type ResyncMsg struct{}
+
+func (m *ResyncMsg) MessageType() string { return MsgTypeResync }
+
+func (m *ResyncMsg) toWire() map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+// EndpointStatusMsg is sent by Felix when it has (re)programmed an endpoint or
+// removed it.  StatusOrNil is nil for a removal.
+type EndpointStatusMsg struct {
+	ID          store.EndpointID
+	StatusOrNil *string
+}
+
+func (m *EndpointStatusMsg) MessageType() string { return MsgTypeEndpointStatus }
+
+func (m *EndpointStatusMsg) toWire() map[string]interface{} {
+	w := map[string]interface{}{
+		"endpoint_id": m.ID.EndpointID,
+		"status":      nil,
+	}
+	if !m.ID.IsHostEndpoint() {
+		w["orchestrator"] = m.ID.OrchestratorID
+		w["workload_id"] = m.ID.WorkloadID
+	}
+	if m.StatusOrNil != nil {
+		w["status"] = *m.StatusOrNil
+	}
+	return w
+}
+
+// ConfigLoadedMsg gives Felix its config, once the driver has loaded it.
+type ConfigLoadedMsg struct {
+	Global map[string]string
+	Host   map[string]string
+}
+
+func (m *ConfigLoadedMsg) MessageType() string { return MsgTypeConfigLoaded }
+
+func (m *ConfigLoadedMsg) toWire() map[string]interface{} {
+	return map[string]interface{}{"global": m.Global, "host": m.Host}
+}
+
+// ConfigChangedMsg tells Felix that its config has changed since it was
+// loaded.
+type ConfigChangedMsg struct {
+	Global map[string]string
+	Host   map[string]string
+}
+
+func (m *ConfigChangedMsg) MessageType() string { return MsgTypeConfigChanged }
+
+func (m *ConfigChangedMsg) toWire() map[string]interface{} {
+	return map[string]interface{}{"global": m.Global, "host": m.Host}
+}
+
+// StatusMsg reports the status of the datastore driver.
+type StatusMsg struct {
+	Status store.DriverStatus
+}
+
+func (m *StatusMsg) MessageType() string { return MsgTypeStatus }
+
+func (m *StatusMsg) toWire() map[string]interface{} {
+	return map[string]interface{}{"status": m.wireStatus()}
+}
+
+func (m *StatusMsg) wireStatus() string {
+	return m.Status.String()
+}
+
+var statusesByWireName = map[string]store.DriverStatus{}
+
+func init() {
+	for _, status := range []store.DriverStatus{
+		store.WaitForDatastore,
+		store.ResyncInProgress,
+		store.InSync,
+	} {
+		statusesByWireName[status.String()] = status
+	}
+}
+
+// KV is an update to a single key; ValueOrNil is nil for a deletion.
+type KV struct {
+	Key        string
+	ValueOrNil *string
+}
+
+func (kv KV) toWire() map[string]interface{} {
+	w := map[string]interface{}{"k": kv.Key, "v": nil}
+	if kv.ValueOrNil != nil {
+		w["v"] = *kv.ValueOrNil
+	}
+	return w
+}
+
+// KVsMsg is a batch of key/value updates.
+type KVsMsg struct {
+	KVs []KV
+}
+
+func (m *KVsMsg) MessageType() string { return MsgTypeKVs }
+
+func (m *KVsMsg) toWire() map[string]interface{} {
+	kvs := make([]map[string]interface{}, len(m.KVs))
+	for i, kv := range m.KVs {
+		kvs[i] = kv.toWire()
+	}
+	return map[string]interface{}{"kvs": kvs}
+}
+
+// UpdateMsg is a single key/value update, for a Felix that doesn't support
+// batching.
+type UpdateMsg struct {
+	KV
+}
+
+func (m *UpdateMsg) MessageType() string { return MsgTypeUpdate }
+
+// SelectorAddedMsg tells Felix about a new selector IP set.
+type SelectorAddedMsg struct {
+	SelectorID string
+}
+
+func (m *SelectorAddedMsg) MessageType() string { return MsgTypeSelectorAdded }
+
+func (m *SelectorAddedMsg) toWire() map[string]interface{} {
+	return map[string]interface{}{"sel_id": m.SelectorID}
+}
+
+// SelectorRemovedMsg tells Felix that a selector IP set is no longer needed.
+type SelectorRemovedMsg struct {
+	SelectorID string
+}
+
+func (m *SelectorRemovedMsg) MessageType() string { return MsgTypeSelectorRemoved }
+
+func (m *SelectorRemovedMsg) toWire() map[string]interface{} {
+	return map[string]interface{}{"sel_id": m.SelectorID}
+}
+
+// IPAddedMsg tells Felix about a new member of a selector IP set.  IPVersion
+// is 4 or 6; Felix keeps a separate set for each IP version.
+type IPAddedMsg struct {
+	SelectorID string
+	IPVersion  int
+	IP         string
+}
+
+func (m *IPAddedMsg) MessageType() string { return MsgTypeIPAdded }
+
+func (m *IPAddedMsg) toWire() map[string]interface{} {
+	return map[string]interface{}{
+		"sel_id":     m.SelectorID,
+		"ip_version": m.IPVersion,
+		"ip":         m.IP,
+	}
+}
+
+// IPRemovedMsg tells Felix that an IP is no longer in a selector IP set.
+type IPRemovedMsg struct {
+	SelectorID string
+	IPVersion  int
+	IP         string
+}
+
+func (m *IPRemovedMsg) MessageType() string { return MsgTypeIPRemoved }
+
+func (m *IPRemovedMsg) toWire() map[string]interface{} {
+	return map[string]interface{}{
+		"sel_id":     m.SelectorID,
+		"ip_version": m.IPVersion,
+		"ip":         m.IP,
+	}
+}
+
+// EndpointPolicyMsg tells Felix which policies apply to one of its endpoints,
+// tier by tier in the order that the tiers should be applied.  Tiers is nil
+// once the endpoint has been deleted.
+type EndpointPolicyMsg struct {
+	ID    store.EndpointID
+	Tiers []policy.TierPolicies
+}
+
+func (m *EndpointPolicyMsg) MessageType() string { return MsgTypeEndpointPolicy }
+
+func (m *EndpointPolicyMsg) toWire() map[string]interface{} {
+	w := map[string]interface{}{
+		"endpoint_id": m.ID.EndpointID,
+		"tiers":       nil,
+	}
+	if !m.ID.IsHostEndpoint() {
+		w["orchestrator"] = m.ID.OrchestratorID
+		w["workload_id"] = m.ID.WorkloadID
+	}
+	if m.Tiers != nil {
+		tiers := make([]map[string]interface{}, len(m.Tiers))
+		for i, tier := range m.Tiers {
+			tiers[i] = map[string]interface{}{
+				"name":     tier.Name,
+				"policies": tier.Policies,
+			}
+		}
+		w["tiers"] = tiers
+	}
+	return w
+}
+
+// ParseMessage converts a decoded message from Felix into one of the message
+// structs.  Returns an ErrorMalformedMessage if the message isn't valid or
+// isn't one that Felix sends.
+func ParseMessage(msg interface{}) (Message, error) {
+	msgType, err := MessageType(msg)
+	if err != nil {
+		return nil, err
+	}
+	m := msg.(map[interface{}]interface{})
+	switch msgType {
+	case MsgTypeInit:
+		init := &InitMsg{}
+		if init.ProtocolVersion, err = getInt(m, "protocol_version"); err != nil {
+			return nil, ErrorMalformedMessage{Msg: msg, Reason: err.Error()}
+		}
+		if init.MinProtocolVersion, err = getInt(m, "min_protocol_version"); err != nil {
+			return nil, ErrorMalformedMessage{Msg: msg, Reason: err.Error()}
+		}
+		if init.Features, err = getStrings(m, "features"); err != nil {
+			return nil, ErrorMalformedMessage{Msg: msg, Reason: err.Error()}
+		}
+		if init.Codecs, err = getStrings(m, "codecs"); err != nil {
+			return nil, ErrorMalformedMessage{Msg: msg, Reason: err.Error()}
+		}
+		return init, nil
+	case MsgTypeResync:
+		return &ResyncMsg{}, nil
+	case MsgTypeEndpointStatus:
+		id, statusOrNil, err := EndpointStatusFromMessage(msg)
+		if err != nil {
+			return nil, err
+		}
+		return &EndpointStatusMsg{ID: id, StatusOrNil: statusOrNil}, nil
+	}
+	return nil, ErrorMalformedMessage{Msg: msg, Reason: "unknown type"}
+}
+
+// getStrings returns the value of the given list-of-strings field, or nil if it
+// is missing.
+func getStrings(m map[interface{}]interface{}, field string) ([]string, error) {
+	if m[field] == nil {
+		return nil, nil
+	}
+	list, ok := m[field].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v is not a list", field)
+	}
+	strs := make([]string, len(list))
+	for i, item := range list {
+		if strs[i], ok = item.(string); !ok {
+			return nil, fmt.Errorf("%v contains a non-string", field)
+		}
+	}
+	return strs, nil
+}
+
+// getInt returns the integer value of the given field, or 0 if it is missing.
+// msgpack decodes integers to various types depending on their size and JSON
+// decodes them to float64.
+func getInt(m map[interface{}]interface{}, field string) (int, error) {
+	switch v := m[field].(type) {
+	case nil:
+		return 0, nil
+	case int8:
+		return int(v), nil
+	case int16:
+		return int(v), nil
+	case int32:
+		return int(v), nil
+	case int64:
+		return int(v), nil
+	case uint8:
+		return int(v), nil
+	case uint16:
+		return int(v), nil
+	case uint32:
+		return int(v), nil
+	case uint64:
+		return int(v), nil
+	case int:
+		return int(v), nil
+	case float64:
+		// From JSON.
+		if v == math.Trunc(v) {
+			return int(v), nil
+		}
+	}
+	return 0, fmt.Errorf("%v is not an integer", field)
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package felix_test
+
+import (
+	. "github.com/projectcalico/calico-go/etcd-driver/felix"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/projectcalico/calico-go/etcd-driver/policy"
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+)
+
+var _ = Describe("ParseMessage", func() {
+	It("should parse an init message", func() {
+		msg, err := ParseMessage(map[interface{}]interface{}{
+			"type":                 "init",
+			"protocol_version":     int8(2),
+			"min_protocol_version": uint64(1),
+			"features":             []interface{}{"batching", "ipsets"},
+			"codecs":               []interface{}{"json"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg).To(Equal(&InitMsg{
+			ProtocolVersion:    2,
+			MinProtocolVersion: 1,
+			Features:           []string{"batching", "ipsets"},
+			Codecs:             []string{"json"},
+		}))
+	})
+	It("should parse an unversioned init message as version 0", func() {
+		msg, err := ParseMessage(map[interface{}]interface{}{"type": "init"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg).To(Equal(&InitMsg{}))
+	})
+	It("should parse a resync message", func() {
+		msg, err := ParseMessage(map[interface{}]interface{}{"type": "resync"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg).To(Equal(&ResyncMsg{}))
+	})
+	It("should parse an endpoint status message", func() {
+		msg, err := ParseMessage(map[interface{}]interface{}{
+			"type":        "endpoint_status",
+			"endpoint_id": "eth0",
+			"status":      "up",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg).To(Equal(&EndpointStatusMsg{
+			ID:          store.EndpointID{EndpointID: "eth0"},
+			StatusOrNil: strPtr("up"),
+		}))
+	})
+	expectMalformed := func(msg interface{}) {
+		_, err := ParseMessage(msg)
+		Expect(err).To(BeAssignableToTypeOf(ErrorMalformedMessage{}))
+	}
+	It("should reject an unknown message type", func() {
+		expectMalformed(map[interface{}]interface{}{"type": "kvs"})
+	})
+	It("should reject a non-integer version", func() {
+		expectMalformed(map[interface{}]interface{}{"type": "init", "protocol_version": "1"})
+	})
+	It("should reject a bad feature list", func() {
+		expectMalformed(map[interface{}]interface{}{"type": "init", "features": "batching"})
+		expectMalformed(map[interface{}]interface{}{"type": "init", "features": []interface{}{1}})
+	})
+})
+
+var _ = Describe("Negotiate", func() {
+	ourFeatures := []string{FeatureIPSets, FeatureBatching}
+
+	It("should agree on the common features", func() {
+		hs, err := Negotiate(&InitMsg{
+			ProtocolVersion: ProtocolVersion,
+			Features:        []string{FeatureIPSets, FeatureEndpointStatus, "future"},
+		}, ourFeatures, "msgpack")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hs).To(Equal(&HandshakeMsg{
+			ProtocolVersion: ProtocolVersion,
+			Features:        []string{FeatureIPSets},
+			Codec:           "msgpack",
+		}))
+		Expect(hs.HasFeature(FeatureIPSets)).To(BeTrue())
+		Expect(hs.HasFeature(FeatureBatching)).To(BeFalse())
+	})
+	It("should reject a Felix that doesn't support IP sets", func() {
+		_, err := Negotiate(&InitMsg{
+			ProtocolVersion: ProtocolVersion,
+			Features:        []string{FeatureBatching},
+		}, ourFeatures, "msgpack")
+		Expect(err).To(BeAssignableToTypeOf(ErrorIncompatiblePeer{}))
+		Expect(err.Error()).To(ContainSubstring(FeatureIPSets))
+	})
+	It("should use our version with a newer Felix that speaks it", func() {
+		hs, err := Negotiate(&InitMsg{
+			ProtocolVersion:    ProtocolVersion + 1,
+			MinProtocolVersion: ProtocolVersion,
+			Features:           []string{FeatureIPSets},
+		}, ourFeatures, "msgpack")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hs.ProtocolVersion).To(Equal(ProtocolVersion))
+		Expect(hs.Features).To(Equal([]string{FeatureIPSets}))
+	})
+	It("should reject a Felix that only speaks newer versions", func() {
+		_, err := Negotiate(&InitMsg{ProtocolVersion: ProtocolVersion + 1}, ourFeatures, "msgpack")
+		Expect(err).To(BeAssignableToTypeOf(ErrorIncompatiblePeer{}))
+		Expect(err.Error()).To(ContainSubstring("protocol versions"))
+	})
+	It("should switch to the first codec that we support", func() {
+		hs, err := Negotiate(&InitMsg{
+			ProtocolVersion: ProtocolVersion,
+			Features:        []string{FeatureIPSets},
+			Codecs:          []string{"carrier-pigeon", "protobuf", "json"},
+		}, ourFeatures, "msgpack")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hs.Codec).To(Equal("protobuf"))
+	})
+	It("should reject an unversioned Felix", func() {
+		_, err := Negotiate(&InitMsg{}, ourFeatures, "msgpack")
+		Expect(err).To(BeAssignableToTypeOf(ErrorIncompatiblePeer{}))
+		Expect(err.Error()).To(ContainSubstring("didn't send a protocol version"))
+	})
+})
+
+var _ = Describe("HandshakeMsg.Adapt", func() {
+	batch := &KVsMsg{KVs: []KV{kv("/a", "1"), kv("/b", nil)}}
+	ipAdded := &IPAddedMsg{SelectorID: "s1", IPVersion: 4, IP: "10.0.0.1"}
+
+	It("should pass messages through when all features were negotiated", func() {
+		hs := &HandshakeMsg{Features: []string{FeatureBatching, FeatureIPSets}}
+		Expect(hs.Adapt(batch)).To(Equal([]Message{batch}))
+		Expect(hs.Adapt(ipAdded)).To(Equal([]Message{ipAdded}))
+	})
+	It("should split batches and drop endpoint policies otherwise", func() {
+		hs := &HandshakeMsg{Features: []string{FeatureIPSets}}
+		Expect(hs.Adapt(batch)).To(Equal([]Message{
+			&UpdateMsg{KV: kv("/a", "1")},
+			&UpdateMsg{KV: kv("/b", nil)},
+		}))
+		Expect(hs.Adapt(&EndpointPolicyMsg{})).To(BeEmpty())
+		status := &StatusMsg{Status: store.InSync}
+		Expect(hs.Adapt(status)).To(Equal([]Message{status}))
+	})
+})
+
+var _ = Describe("ToWire", func() {
+	It("should encode a batch", func() {
+		Expect(ToWire(&KVsMsg{KVs: []KV{kv("/a", "1"), kv("/b", nil)}})).To(Equal(
+			map[string]interface{}{
+				"type": "kvs",
+				"kvs": []map[string]interface{}{
+					{"k": "/a", "v": "1"},
+					{"k": "/b", "v": nil},
+				},
+			}))
+	})
+	It("should encode a single update", func() {
+		Expect(ToWire(&UpdateMsg{KV: kv("/a", "1")})).To(Equal(
+			map[string]interface{}{"type": "u", "k": "/a", "v": "1"}))
+	})
+	It("should encode a status", func() {
+		Expect(ToWire(&StatusMsg{Status: store.InSync})).To(Equal(
+			map[string]interface{}{"type": "stat", "status": "in-sync"}))
+	})
+	It("should use the driver's own status names on the wire", func() {
+		for _, status := range []store.DriverStatus{
+			store.WaitForDatastore,
+			store.ResyncInProgress,
+			store.InSync,
+		} {
+			Expect(ToWire(&StatusMsg{Status: status})["status"]).To(
+				Equal(status.String()))
+		}
+		Expect(store.WaitForDatastore.String()).To(Equal("wait-for-ready"))
+		Expect(store.ResyncInProgress.String()).To(Equal("resync"))
+	})
+	It("should encode endpoint policy", func() {
+		Expect(ToWire(&EndpointPolicyMsg{
+			ID: store.EndpointID{EndpointID: "eth1"},
+			Tiers: []policy.TierPolicies{
+				{Name: "t1", Policies: []string{"p1", "p2"}},
+			},
+		})).To(Equal(map[string]interface{}{
+			"type":        "endpoint_policy",
+			"endpoint_id": "eth1",
+			"tiers": []map[string]interface{}{
+				{"name": "t1", "policies": []string{"p1", "p2"}},
+			},
+		}))
+		Expect(ToWire(&EndpointPolicyMsg{
+			ID: store.EndpointID{OrchestratorID: "k8s", WorkloadID: "pod1", EndpointID: "eth0"},
+		})).To(Equal(map[string]interface{}{
+			"type":         "endpoint_policy",
+			"orchestrator": "k8s",
+			"workload_id":  "pod1",
+			"endpoint_id":  "eth0",
+			"tiers":        nil,
+		}))
+	})
+	It("should encode a handshake", func() {
+		Expect(ToWire(&HandshakeMsg{
+			ProtocolVersion: 1,
+			Features:        []string{"ipsets"},
+			Codec:           "json",
+		})).To(Equal(map[string]interface{}{
+			"type":             "handshake",
+			"protocol_version": 1,
+			"features":         []string{"ipsets"},
+			"codec":            "json",
+		}))
+	})
+})
@@ -0,0 +1,298 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package felix contains the plumbing for sending messages to Felix.
+package felix
+
+import (
+	"sync"
+	"time"
+
+	"github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("felix")
+
+// UpdateQueue sits between the threads that generate messages for Felix and
+// the single thread that writes them to the Felix socket.
+//
+// Key/value updates are batched into multi-key KVsMsg messages.
+//
+// While Felix is busy, repeated updates to the same key are coalesced so that
+// only the latest value is sent, in the position of the queued update.  Most
+// other messages act as a barrier: updates queued before it are sent before it
+// and updates queued after it are never coalesced with updates from before it.
+// IP set membership updates don't refer to any keys so updates are coalesced
+// across them.
+//
+// While there is no connection to Felix, the queue can be put into discarding
+// mode, in which it drops all messages without blocking the caller.
+type UpdateQueue struct {
+	maxBatchKeys  int
+	maxBatchBytes int
+	maxLatency    time.Duration
+	maxQueued     int
+
+	lock sync.Mutex
+	// notFull is signalled when the queue drops below maxQueued items.
+	notFull *sync.Cond
+	// wake is poked (without blocking) whenever something is queued.
+	wake chan struct{}
+	// segments holds the queued messages in order.  Each segment is
+	// either a single message or a batch of key/value updates.
+	segments []*segment
+	// numQueued is the total number of messages and distinct keys queued.
+	numQueued int
+	// batchByKey maps from key to the batch holding its queued update,
+	// for keys that were queued since the last barrier.
+	batchByKey map[string]*kvBatch
+	// discarding is true if messages should be dropped.
+	discarding bool
+}
+
+type segment struct {
+	msg   Message
+	batch *kvBatch
+}
+
+// kvBatch holds a set of key/value updates, in order of first arrival.
+type kvBatch struct {
+	keys   []string
+	values map[string]*string
+	// numBytes is the total length of the keys and values in the batch.
+	numBytes int
+}
+
+func (b *kvBatch) set(key string, valueOrNil *string) {
+	if oldValue, ok := b.values[key]; ok {
+		if oldValue != nil {
+			b.numBytes -= len(*oldValue)
+		}
+	} else {
+		b.keys = append(b.keys, key)
+		b.numBytes += len(key)
+	}
+	if valueOrNil != nil {
+		b.numBytes += len(*valueOrNil)
+	}
+	b.values[key] = valueOrNil
+}
+
+// NewUpdateQueue creates a queue that sends batches of at most maxBatchKeys
+// keys and (approximately) maxBatchBytes bytes.  A batch that is below those
+// limits is held for up to maxLatency waiting for more updates.  Once
+// maxQueued messages and distinct keys are queued, callers are blocked until
+// Felix catches up; updates to keys that are already queued never block.
+func NewUpdateQueue(maxBatchKeys, maxBatchBytes int, maxLatency time.Duration, maxQueued int) *UpdateQueue {
+	q := &UpdateQueue{
+		maxBatchKeys:  maxBatchKeys,
+		maxBatchBytes: maxBatchBytes,
+		maxLatency:    maxLatency,
+		maxQueued:     maxQueued,
+		wake:          make(chan struct{}, 1),
+		batchByKey:    make(map[string]*kvBatch),
+	}
+	q.notFull = sync.NewCond(&q.lock)
+	return q
+}
+
+// QueueKV queues an update to a key; valueOrNil should be nil for a deletion.
+func (q *UpdateQueue) QueueKV(key string, valueOrNil *string) {
+	if valueOrNil != nil {
+		// Take a copy, the caller may reuse the storage.
+		value := *valueOrNil
+		valueOrNil = &value
+	}
+	q.lock.Lock()
+	if q.discarding {
+		q.lock.Unlock()
+		return
+	}
+	for {
+		if batch, ok := q.batchByKey[key]; ok {
+			// Coalesce with the queued update.
+			batch.set(key, valueOrNil)
+			q.lock.Unlock()
+			return
+		}
+		if q.numQueued < q.maxQueued {
+			break
+		}
+		// waitForSpaceLocked drops the lock so the key may have been
+		// queued by the time it returns; go round again.
+		if !q.waitForSpaceLocked() {
+			q.lock.Unlock()
+			return
+		}
+	}
+	var batch *kvBatch
+	if n := len(q.segments); n > 0 && q.segments[n-1].batch != nil {
+		batch = q.segments[n-1].batch
+	} else {
+		batch = &kvBatch{values: make(map[string]*string)}
+		q.segments = append(q.segments, &segment{batch: batch})
+	}
+	batch.set(key, valueOrNil)
+	q.batchByKey[key] = batch
+	q.numQueued++
+	q.lock.Unlock()
+	q.poke()
+}
+
+// QueueMessage queues a message other than a key/value update.
+func (q *UpdateQueue) QueueMessage(msg Message) {
+	q.lock.Lock()
+	if q.discarding || !q.waitForSpaceLocked() {
+		q.lock.Unlock()
+		return
+	}
+	q.segments = append(q.segments, &segment{msg: msg})
+	q.numQueued++
+	if isBarrier(msg) {
+		q.batchByKey = make(map[string]*kvBatch)
+	}
+	q.lock.Unlock()
+	q.poke()
+}
+
+// isBarrier returns true if key/value updates must not be reordered with the
+// given message.  Policies refer to selectors and endpoint policies refer to
+// policies, for example, so Felix needs to see them in order.
+func isBarrier(msg Message) bool {
+	switch msg.(type) {
+	case *IPAddedMsg, *IPRemovedMsg:
+		return false
+	}
+	return true
+}
+
+// SetDiscarding enables or disables discarding mode.  Enabling it drops any
+// messages that are already queued.
+func (q *UpdateQueue) SetDiscarding(discarding bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.discarding = discarding
+	if discarding {
+		q.segments = nil
+		q.numQueued = 0
+		q.batchByKey = make(map[string]*kvBatch)
+		q.notFull.Broadcast()
+	}
+}
+
+// Len returns the number of messages and distinct keys that are queued.
+func (q *UpdateQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.numQueued
+}
+
+// Next blocks until there is a message to send to Felix and then returns it.
+// Returns nil if the stop channel is closed first.
+func (q *UpdateQueue) Next(stop <-chan struct{}) Message {
+	var lingerTimer <-chan time.Time
+	lingerExpired := false
+	for {
+		q.lock.Lock()
+		if len(q.segments) > 0 {
+			head := q.segments[0]
+			if head.msg != nil ||
+				len(q.segments) > 1 ||
+				lingerExpired ||
+				q.batchFullLocked(head.batch) {
+				msg := q.popLocked()
+				q.lock.Unlock()
+				return msg
+			}
+			if lingerTimer == nil {
+				lingerTimer = time.After(q.maxLatency)
+			}
+		}
+		q.lock.Unlock()
+
+		select {
+		case <-q.wake:
+		case <-lingerTimer:
+			lingerExpired = true
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+// popLocked removes the next message from the head of the queue.  For a batch
+// of key/value updates, it takes as many updates as will fit in one message,
+// leaving the rest queued.
+func (q *UpdateQueue) popLocked() Message {
+	head := q.segments[0]
+	if head.msg != nil {
+		q.segments[0] = nil
+		q.segments = q.segments[1:]
+		q.numQueued--
+		q.notFull.Broadcast()
+		return head.msg
+	}
+
+	batch := head.batch
+	kvs := make([]KV, 0, len(batch.keys))
+	numBytes := 0
+	numTaken := 0
+	for _, key := range batch.keys {
+		if numTaken > 0 &&
+			(numTaken >= q.maxBatchKeys || numBytes >= q.maxBatchBytes) {
+			break
+		}
+		valueOrNil := batch.values[key]
+		numBytes += len(key)
+		if valueOrNil != nil {
+			numBytes += len(*valueOrNil)
+		}
+		kvs = append(kvs, KV{Key: key, ValueOrNil: valueOrNil})
+		delete(batch.values, key)
+		if q.batchByKey[key] == batch {
+			delete(q.batchByKey, key)
+		}
+		numTaken++
+	}
+	batch.keys = batch.keys[numTaken:]
+	batch.numBytes -= numBytes
+	if len(batch.keys) == 0 {
+		q.segments[0] = nil
+		q.segments = q.segments[1:]
+	}
+	q.numQueued -= numTaken
+	q.notFull.Broadcast()
+	log.Debugf("Sending batch of %v keys, %v bytes", numTaken, numBytes)
+	return &KVsMsg{KVs: kvs}
+}
+
+func (q *UpdateQueue) batchFullLocked(batch *kvBatch) bool {
+	return len(batch.keys) >= q.maxBatchKeys || batch.numBytes >= q.maxBatchBytes
+}
+
+// waitForSpaceLocked blocks until the queue has space.  Returns false if the
+// queue switched to discarding mode while we were waiting.
+func (q *UpdateQueue) waitForSpaceLocked() bool {
+	for q.numQueued >= q.maxQueued && !q.discarding {
+		q.notFull.Wait()
+	}
+	return !q.discarding
+}
+
+func (q *UpdateQueue) poke() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package felix_test
+
+import (
+	"time"
+
+	. "github.com/projectcalico/calico-go/etcd-driver/felix"
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func kv(k string, v interface{}) KV {
+	if v == nil {
+		return KV{Key: k}
+	}
+	return KV{Key: k, ValueOrNil: strPtr(v.(string))}
+}
+
+func kvs(kvs ...KV) Message {
+	return &KVsMsg{KVs: kvs}
+}
+
+var _ = Describe("UpdateQueue", func() {
+	var q *UpdateQueue
+
+	BeforeEach(func() {
+		q = NewUpdateQueue(3, 1000, time.Millisecond, 100)
+	})
+
+	It("should batch updates", func() {
+		q.QueueKV("/a", strPtr("1"))
+		q.QueueKV("/b", nil)
+		Expect(q.Next(nil)).To(Equal(kvs(kv("/a", "1"), kv("/b", nil))))
+	})
+	It("should coalesce updates to the same key", func() {
+		q.QueueKV("/a", strPtr("1"))
+		q.QueueKV("/b", strPtr("2"))
+		q.QueueKV("/a", strPtr("3"))
+		q.QueueKV("/a", nil)
+		Expect(q.Next(nil)).To(Equal(kvs(kv("/a", nil), kv("/b", "2"))))
+	})
+	It("should split batches that exceed the key limit", func() {
+		for _, k := range []string{"/a", "/b", "/c", "/d"} {
+			q.QueueKV(k, strPtr("v"))
+		}
+		Expect(q.Next(nil)).To(Equal(kvs(kv("/a", "v"), kv("/b", "v"), kv("/c", "v"))))
+		Expect(q.Next(nil)).To(Equal(kvs(kv("/d", "v"))))
+	})
+	It("should split batches that exceed the byte limit", func() {
+		q = NewUpdateQueue(100, 10, time.Millisecond, 100)
+		q.QueueKV("/a", strPtr("12345678"))
+		q.QueueKV("/b", strPtr("1"))
+		Expect(q.Next(nil)).To(Equal(kvs(kv("/a", "12345678"))))
+		Expect(q.Next(nil)).To(Equal(kvs(kv("/b", "1"))))
+	})
+	It("should not coalesce across other messages", func() {
+		msg := &StatusMsg{Status: store.InSync}
+		q.QueueKV("/a", strPtr("1"))
+		q.QueueMessage(msg)
+		q.QueueKV("/a", strPtr("2"))
+		Expect(q.Next(nil)).To(Equal(kvs(kv("/a", "1"))))
+		Expect(q.Next(nil)).To(Equal(msg))
+		Expect(q.Next(nil)).To(Equal(kvs(kv("/a", "2"))))
+	})
+	It("should coalesce across IP set updates", func() {
+		msg := &IPAddedMsg{SelectorID: "sel1", IPVersion: 4, IP: "10.0.0.1/32"}
+		q.QueueKV("/a", strPtr("1"))
+		q.QueueMessage(msg)
+		q.QueueKV("/b", strPtr("2"))
+		q.QueueKV("/a", strPtr("3"))
+		Expect(q.Len()).To(Equal(3))
+		Expect(q.Next(nil)).To(Equal(kvs(kv("/a", "3"))))
+		Expect(q.Next(nil)).To(Equal(msg))
+		Expect(q.Next(nil)).To(Equal(kvs(kv("/b", "2"))))
+	})
+	It("should not coalesce across IP set updates once a barrier is queued", func() {
+		ipMsg := &IPAddedMsg{SelectorID: "sel1", IPVersion: 4, IP: "10.0.0.1/32"}
+		statusMsg := &StatusMsg{Status: store.InSync}
+		q.QueueKV("/a", strPtr("1"))
+		q.QueueMessage(ipMsg)
+		q.QueueMessage(statusMsg)
+		q.QueueKV("/a", strPtr("2"))
+		Expect(q.Next(nil)).To(Equal(kvs(kv("/a", "1"))))
+		Expect(q.Next(nil)).To(Equal(ipMsg))
+		Expect(q.Next(nil)).To(Equal(statusMsg))
+		Expect(q.Next(nil)).To(Equal(kvs(kv("/a", "2"))))
+	})
+	It("should coalesce into a partly-sent batch", func() {
+		for _, k := range []string{"/a", "/b", "/c", "/d"} {
+			q.QueueKV(k, strPtr("v"))
+		}
+		Expect(q.Next(nil)).To(Equal(kvs(kv("/a", "v"), kv("/b", "v"), kv("/c", "v"))))
+		q.QueueKV("/a", strPtr("w"))
+		q.QueueKV("/d", strPtr("w"))
+		Expect(q.Next(nil)).To(Equal(kvs(kv("/d", "w"), kv("/a", "w"))))
+	})
+	It("should track the size of coalesced values", func() {
+		q = NewUpdateQueue(100, 10, time.Hour, 100)
+		q.QueueKV("/a", strPtr("12345678"))
+		q.QueueKV("/a", strPtr("1"))
+		// The batch is no longer full so it should linger.
+		stop := make(chan struct{})
+		time.AfterFunc(10*time.Millisecond, func() { close(stop) })
+		Expect(q.Next(stop)).To(BeNil())
+		q.QueueKV("/b", strPtr("1234567"))
+		Expect(q.Next(nil)).To(Equal(kvs(kv("/a", "1"), kv("/b", "1234567"))))
+	})
+	It("should copy values", func() {
+		value := "1"
+		q.QueueKV("/a", &value)
+		value = "2"
+		Expect(q.Next(nil)).To(Equal(kvs(kv("/a", "1"))))
+	})
+	It("should block until there is a message", func() {
+		msgs := make(chan Message)
+		go func() {
+			msgs <- q.Next(nil)
+		}()
+		Consistently(msgs, "20ms").ShouldNot(Receive())
+		q.QueueKV("/a", strPtr("1"))
+		Eventually(msgs).Should(Receive(Equal(kvs(kv("/a", "1")))))
+	})
+	It("should return nil when stopped", func() {
+		stop := make(chan struct{})
+		close(stop)
+		Expect(q.Next(stop)).To(BeNil())
+	})
+	It("should drop messages when discarding", func() {
+		q.QueueKV("/a", strPtr("1"))
+		q.SetDiscarding(true)
+		q.QueueKV("/b", strPtr("1"))
+		q.QueueMessage(&StatusMsg{})
+		q.SetDiscarding(false)
+		q.QueueKV("/c", strPtr("1"))
+		Expect(q.Next(nil)).To(Equal(kvs(kv("/c", "1"))))
+	})
+	It("should block senders when full", func() {
+		q = NewUpdateQueue(3, 1000, time.Millisecond, 2)
+		q.QueueKV("/a", strPtr("1"))
+		q.QueueKV("/b", strPtr("1"))
+		done := make(chan bool)
+		go func() {
+			q.QueueKV("/c", strPtr("1"))
+			done <- true
+		}()
+		Consistently(done, "20ms").ShouldNot(Receive())
+		// Updates to queued keys are coalesced so they don't block.
+		q.QueueKV("/a", strPtr("2"))
+		Expect(q.Next(nil)).To(Equal(kvs(kv("/a", "2"), kv("/b", "1"))))
+		Eventually(done).Should(Receive())
+		Expect(q.Next(nil)).To(Equal(kvs(kv("/c", "1"))))
+	})
+	It("should unblock senders when switching to discarding", func() {
+		q = NewUpdateQueue(3, 1000, time.Millisecond, 1)
+		q.QueueKV("/a", strPtr("1"))
+		done := make(chan bool)
+		go func() {
+			q.QueueKV("/b", strPtr("1"))
+			done <- true
+		}()
+		Consistently(done, "20ms").ShouldNot(Receive())
+		q.SetDiscarding(true)
+		Eventually(done).Should(Receive())
+	})
+})
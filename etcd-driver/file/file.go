@@ -0,0 +1,229 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package file implements a datastore driver that loads keys from a directory
+// tree instead of etcd, which is useful for testing Felix offline.  Each
+// regular file under the root directory is a key: the file's path relative to
+// the root is the key and its contents are the value.  For example, the file
+// <root>/calico/v1/config/InterfacePrefix holds the value of the key
+// /calico/v1/config/InterfacePrefix.  The directory is polled for changes.
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/op/go-logging"
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+)
+
+var log = logging.MustGetLogger("store.file")
+
+const pollInterval = 1 * time.Second
+
+func init() {
+	store.Register("file", New)
+}
+
+func New(callbacks store.Callbacks, config *store.DriverConfiguration) (store.Driver, error) {
+	if config.FileDriverRoot == "" {
+		return nil, errors.New("no root directory configured for the file driver")
+	}
+	if info, err := os.Stat(config.FileDriverRoot); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%v is not a directory", config.FileDriverRoot)
+	}
+	return &fileDriver{
+		callbacks:   callbacks,
+		config:      config,
+		forceResync: make(chan struct{}, 1),
+	}, nil
+}
+
+type fileDriver struct {
+	callbacks store.Callbacks
+	config    *store.DriverConfiguration
+
+	// values maps from key to the value that we last sent to the
+	// callbacks.  Owned by the polling thread once it has started.
+	values map[string]string
+	// felixConfig is the config that we loaded at start of day.
+	felixConfig *store.FelixConfig
+	// forceResync is signalled to ask the polling thread to resend
+	// everything.
+	forceResync chan struct{}
+}
+
+func (driver *fileDriver) Start() {
+	log.Infof("Starting file driver, loading keys from %v",
+		driver.config.FileDriverRoot)
+	values := driver.readKeysWithRetry()
+
+	// Extract the config from the initial snapshot so that Felix can
+	// configure itself before it receives any updates.
+	driver.felixConfig = store.NewFelixConfig(driver.config.FelixHostname, nil, nil)
+	for key, value := range values {
+		value := value
+		driver.felixConfig.OnUpdate(store.Update{Key: key, ValueOrNil: &value})
+	}
+	driver.callbacks.OnConfigLoaded(driver.felixConfig.CopyMaps())
+
+	driver.callbacks.OnStatusUpdated(store.WaitForDatastore)
+	driver.callbacks.OnStatusUpdated(store.ResyncInProgress)
+	driver.values = make(map[string]string)
+	driver.applySnapshot(values, false)
+	driver.callbacks.OnStatusUpdated(store.InSync)
+
+	go driver.pollForChanges()
+}
+
+// ForceResync asks the polling thread to reread the directory immediately and
+// resend every key.
+func (driver *fileDriver) ForceResync() {
+	select {
+	case driver.forceResync <- struct{}{}:
+		log.Info("Forced resync requested")
+	default:
+		log.Info("Forced resync already pending")
+	}
+}
+
+// pollForChanges periodically rereads the directory, sending any changes to
+// the callbacks.
+func (driver *fileDriver) pollForChanges() {
+	for {
+		forced := false
+		select {
+		case <-time.After(pollInterval):
+		case <-driver.forceResync:
+			forced = true
+		}
+		values, err := driver.readKeys()
+		if err != nil {
+			log.Warningf("Failed to read keys from %v: %v",
+				driver.config.FileDriverRoot, err)
+			continue
+		}
+		if forced {
+			log.Info("Resending all keys")
+			driver.callbacks.OnStatusUpdated(store.ResyncInProgress)
+			driver.applySnapshot(values, true)
+			driver.callbacks.OnStatusUpdated(store.InSync)
+		} else {
+			driver.applySnapshot(values, false)
+		}
+	}
+}
+
+// applySnapshot calculates the differences between the new snapshot and the
+// values that we've already sent and sends the changes to the callbacks.  If
+// resendAll is true, unchanged values are sent too.
+func (driver *fileDriver) applySnapshot(values map[string]string, resendAll bool) {
+	updates := make([]store.Update, 0)
+	for _, key := range sortedKeys(values) {
+		value := values[key]
+		oldValue, ok := driver.values[key]
+		if ok && oldValue == value && !resendAll {
+			continue
+		}
+		updates = append(updates, store.Update{Key: key, ValueOrNil: &value})
+	}
+	for _, key := range sortedKeys(driver.values) {
+		if _, ok := values[key]; !ok {
+			updates = append(updates, store.Update{Key: key})
+		}
+	}
+	driver.values = values
+	if len(updates) == 0 {
+		return
+	}
+
+	log.Infof("Sending %v updates", len(updates))
+	configChanged := false
+	for _, update := range updates {
+		if driver.felixConfig.OnUpdate(update) {
+			log.Infof("Config key %v changed", update.Key)
+			configChanged = true
+		}
+	}
+	driver.callbacks.OnKeysUpdated(updates)
+	if configChanged {
+		log.Warning("Felix config changed, Felix needs to restart")
+		driver.callbacks.OnConfigChanged(driver.felixConfig.CopyMaps())
+	}
+}
+
+// readKeysWithRetry reads the keys from disk, retrying until it succeeds.
+func (driver *fileDriver) readKeysWithRetry() map[string]string {
+	for {
+		values, err := driver.readKeys()
+		if err == nil {
+			return values
+		}
+		log.Warningf("Failed to read keys from %v, retrying: %v",
+			driver.config.FileDriverRoot, err)
+		time.Sleep(pollInterval)
+	}
+}
+
+// readKeys walks the root directory, loading each file as a key.  Hidden files
+// (such as editor swap files) are skipped.
+func (driver *fileDriver) readKeys() (map[string]string, error) {
+	root := driver.config.FileDriverRoot
+	values := make(map[string]string)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		key := "/" + filepath.ToSlash(relPath)
+		// Editors tend to add a trailing newline, which would break
+		// the raw string config values.
+		values[key] = strings.TrimRight(string(data), "\r\n")
+		return nil
+	})
+	return values, err
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	. "github.com/projectcalico/calico-go/etcd-driver/file"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+)
+
+// recordingCallbacks records the callbacks made by the driver, which come from
+// a background thread once the driver has started.
+type recordingCallbacks struct {
+	lock          sync.Mutex
+	statuses      []store.DriverStatus
+	values        map[string]string
+	globalConfig  map[string]string
+	hostConfig    map[string]string
+	configChanged bool
+	numUpdates    int
+}
+
+func (cbs *recordingCallbacks) OnConfigLoaded(global, host map[string]string) {
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+	cbs.globalConfig, cbs.hostConfig = global, host
+}
+
+func (cbs *recordingCallbacks) OnConfigChanged(global, host map[string]string) {
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+	cbs.globalConfig, cbs.hostConfig = global, host
+	cbs.configChanged = true
+}
+
+func (cbs *recordingCallbacks) OnStatusUpdated(status store.DriverStatus) {
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+	cbs.statuses = append(cbs.statuses, status)
+}
+
+func (cbs *recordingCallbacks) OnKeysUpdated(updates []store.Update) {
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+	cbs.numUpdates += len(updates)
+	for _, update := range updates {
+		if update.ValueOrNil == nil {
+			delete(cbs.values, update.Key)
+		} else {
+			cbs.values[update.Key] = *update.ValueOrNil
+		}
+	}
+}
+
+func (cbs *recordingCallbacks) copyValues() map[string]string {
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+	values := make(map[string]string)
+	for k, v := range cbs.values {
+		values[k] = v
+	}
+	return values
+}
+
+func (cbs *recordingCallbacks) getNumUpdates() int {
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+	return cbs.numUpdates
+}
+
+func (cbs *recordingCallbacks) getStatuses() []store.DriverStatus {
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+	return append([]store.DriverStatus(nil), cbs.statuses...)
+}
+
+func (cbs *recordingCallbacks) wasConfigChanged() bool {
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+	return cbs.configChanged
+}
+
+func writeKey(root, key, value string) {
+	filename := filepath.Join(root, filepath.FromSlash(key))
+	Expect(os.MkdirAll(filepath.Dir(filename), 0755)).To(Succeed())
+	Expect(ioutil.WriteFile(filename, []byte(value), 0644)).To(Succeed())
+}
+
+var _ = Describe("File driver", func() {
+	var root string
+	var cbs *recordingCallbacks
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "file-driver")
+		Expect(err).NotTo(HaveOccurred())
+		cbs = &recordingCallbacks{values: make(map[string]string)}
+	})
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("should be registered", func() {
+		Expect(store.RegisteredDrivers()).To(ContainElement("file"))
+	})
+
+	It("should reject a missing root directory", func() {
+		_, err := New(cbs, &store.DriverConfiguration{
+			FileDriverRoot: filepath.Join(root, "missing"),
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	Describe("after starting", func() {
+		var driver store.Driver
+
+		BeforeEach(func() {
+			writeKey(root, "/calico/v1/config/InterfacePrefix", "cali\n")
+			writeKey(root, "/calico/v1/host/h1/config/LogSeverityScreen", "debug")
+			writeKey(root, "/calico/v1/host/h2/config/LogSeverityScreen", "info")
+			writeKey(root, "/calico/v1/policy/profile/prof1/rules", "{}")
+			writeKey(root, "/calico/v1/policy/profile/.prof1.swp", "junk")
+			newDriver, err := store.Lookup("file")
+			Expect(err).NotTo(HaveOccurred())
+			driver, err = newDriver(cbs, &store.DriverConfiguration{
+				FelixHostname:  "h1",
+				FileDriverRoot: root,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			driver.Start()
+		})
+
+		It("should load the config", func() {
+			Expect(cbs.globalConfig).To(Equal(map[string]string{
+				"InterfacePrefix": "cali",
+			}))
+			Expect(cbs.hostConfig).To(Equal(map[string]string{
+				"LogSeverityScreen": "debug",
+			}))
+		})
+		It("should load the keys and report in-sync", func() {
+			Expect(cbs.copyValues()).To(Equal(map[string]string{
+				"/calico/v1/config/InterfacePrefix":           "cali",
+				"/calico/v1/host/h1/config/LogSeverityScreen": "debug",
+				"/calico/v1/host/h2/config/LogSeverityScreen": "info",
+				"/calico/v1/policy/profile/prof1/rules":       "{}",
+			}))
+			Expect(cbs.statuses).To(Equal([]store.DriverStatus{
+				store.WaitForDatastore,
+				store.ResyncInProgress,
+				store.InSync,
+			}))
+		})
+		It("should pick up changes and deletions", func() {
+			writeKey(root, "/calico/v1/policy/profile/prof1/tags", "[]")
+			Expect(os.Remove(filepath.Join(root, "calico/v1/policy/profile/prof1/rules"))).To(Succeed())
+			Eventually(cbs.copyValues, "5s").ShouldNot(HaveKey("/calico/v1/policy/profile/prof1/rules"))
+			Expect(cbs.copyValues()).To(HaveKeyWithValue("/calico/v1/policy/profile/prof1/tags", "[]"))
+			Expect(cbs.wasConfigChanged()).To(BeFalse())
+		})
+		It("should resend everything on a forced resync", func() {
+			Expect(cbs.getNumUpdates()).To(Equal(4))
+			Expect(os.Remove(filepath.Join(root, "calico/v1/policy/profile/prof1/rules"))).To(Succeed())
+			driver.ForceResync()
+			// 3 remaining keys plus the deletion.
+			Eventually(cbs.getNumUpdates).Should(Equal(8))
+			Expect(cbs.copyValues()).NotTo(HaveKey("/calico/v1/policy/profile/prof1/rules"))
+			Eventually(cbs.getStatuses).Should(Equal([]store.DriverStatus{
+				store.WaitForDatastore,
+				store.ResyncInProgress,
+				store.InSync,
+				store.ResyncInProgress,
+				store.InSync,
+			}))
+		})
+		It("should report config changes", func() {
+			writeKey(root, "/calico/v1/config/InterfacePrefix", "tap")
+			Eventually(cbs.wasConfigChanged, "5s").Should(BeTrue())
+		})
+	})
+})
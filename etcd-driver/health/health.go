@@ -0,0 +1,167 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package health implements the driver's HTTP health endpoints:
+//
+//	/liveness   returns 200 as long as the process is serving requests.
+//	/readiness  returns 200 if the datastore driver is in sync, 503 otherwise.
+//	/status     returns a JSON Status object.
+//	/resync     on POST, asks the datastore driver for a forced resync.
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+)
+
+// Status is the body of the /status endpoint.
+type Status struct {
+	DatastoreStatus string `json:"datastoreStatus"`
+	InSync          bool   `json:"inSync"`
+	// StatusChangeTime is the time of the last status transition.
+	StatusChangeTime *time.Time `json:"statusChangeTime,omitempty"`
+	// LastInSyncTime is the time that the driver last became in sync.
+	LastInSyncTime *time.Time `json:"lastInSyncTime,omitempty"`
+	FelixConnected bool       `json:"felixConnected"`
+	// SnapshotIndex and the driver's queue depths are only reported if
+	// the driver implements store.StatsReporter.
+	SnapshotIndex uint64         `json:"snapshotIndex,omitempty"`
+	QueueDepths   map[string]int `json:"queueDepths"`
+}
+
+// Monitor tracks the state reported by the health endpoints.
+type Monitor struct {
+	lock             sync.Mutex
+	status           store.DriverStatus
+	statusKnown      bool
+	statusChangeTime time.Time
+	lastInSyncTime   time.Time
+	felixConnected   bool
+	driver           store.Driver
+	queueDepthFuncs  map[string]func() int
+}
+
+func NewMonitor() *Monitor {
+	return &Monitor{
+		queueDepthFuncs: make(map[string]func() int),
+	}
+}
+
+// SetDriver tells the monitor which driver to query for statistics.
+func (m *Monitor) SetDriver(driver store.Driver) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.driver = driver
+}
+
+// AddQueue registers a queue whose depth should be reported.
+func (m *Monitor) AddQueue(name string, depth func() int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.queueDepthFuncs[name] = depth
+}
+
+func (m *Monitor) OnStatusUpdated(status store.DriverStatus) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	if !m.statusKnown || status != m.status {
+		m.statusChangeTime = now
+	}
+	if status == store.InSync {
+		m.lastInSyncTime = now
+	}
+	m.status, m.statusKnown = status, true
+}
+
+func (m *Monitor) OnFelixConnectionChanged(connected bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.felixConnected = connected
+}
+
+// Status returns a snapshot of the current status.
+func (m *Monitor) Status() Status {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	status := Status{
+		DatastoreStatus: "unknown",
+		FelixConnected:  m.felixConnected,
+		QueueDepths:     make(map[string]int),
+	}
+	if m.statusKnown {
+		status.DatastoreStatus = m.status.String()
+		status.InSync = m.status == store.InSync
+		changeTime := m.statusChangeTime
+		status.StatusChangeTime = &changeTime
+	}
+	if !m.lastInSyncTime.IsZero() {
+		inSyncTime := m.lastInSyncTime
+		status.LastInSyncTime = &inSyncTime
+	}
+	for name, depth := range m.queueDepthFuncs {
+		status.QueueDepths[name] = depth()
+	}
+	if reporter, ok := m.driver.(store.StatsReporter); ok {
+		stats := reporter.Stats()
+		status.SnapshotIndex = stats.SnapshotIndex
+		for name, depth := range stats.QueueDepths {
+			status.QueueDepths[name] = depth
+		}
+	}
+	return status
+}
+
+// Handler returns an http.Handler that serves the health endpoints.
+func (m *Monitor) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/liveness", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readiness", func(w http.ResponseWriter, r *http.Request) {
+		status := m.Status()
+		if !status.InSync {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		fmt.Fprintln(w, status.DatastoreStatus)
+	})
+	mux.HandleFunc("/resync", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		m.lock.Lock()
+		driver := m.driver
+		m.lock.Unlock()
+		if driver == nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, "no driver")
+			return
+		}
+		driver.ForceResync()
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintln(w, "resync requested")
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(m.Status())
+	})
+	return mux
+}
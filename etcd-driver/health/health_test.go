@@ -0,0 +1,117 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/projectcalico/calico-go/etcd-driver/health"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+)
+
+type statsDriver struct {
+	resyncs *int
+}
+
+func (d statsDriver) Start() {}
+
+func (d statsDriver) ForceResync() {
+	*d.resyncs++
+}
+
+func (d statsDriver) Stats() store.DriverStats {
+	return store.DriverStats{
+		SnapshotIndex: 1234,
+		QueueDepths:   map[string]int{"events": 5},
+	}
+}
+
+var _ = Describe("Monitor", func() {
+	var monitor *Monitor
+	var server *httptest.Server
+
+	get := func(path string) int {
+		resp, err := http.Get(server.URL + path)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	BeforeEach(func() {
+		monitor = NewMonitor()
+		server = httptest.NewServer(monitor.Handler())
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should always be live", func() {
+		Expect(get("/liveness")).To(Equal(http.StatusOK))
+	})
+	It("should only be ready when in sync", func() {
+		Expect(get("/readiness")).To(Equal(http.StatusServiceUnavailable))
+		monitor.OnStatusUpdated(store.WaitForDatastore)
+		Expect(get("/readiness")).To(Equal(http.StatusServiceUnavailable))
+		monitor.OnStatusUpdated(store.InSync)
+		Expect(get("/readiness")).To(Equal(http.StatusOK))
+		monitor.OnStatusUpdated(store.ResyncInProgress)
+		Expect(get("/readiness")).To(Equal(http.StatusServiceUnavailable))
+	})
+	It("should report the status as JSON", func() {
+		monitor.SetDriver(statsDriver{resyncs: new(int)})
+		monitor.AddQueue("felix", func() int { return 7 })
+		monitor.OnFelixConnectionChanged(true)
+		monitor.OnStatusUpdated(store.InSync)
+
+		resp, err := http.Get(server.URL + "/status")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		var status Status
+		Expect(json.NewDecoder(resp.Body).Decode(&status)).To(Succeed())
+		Expect(status.DatastoreStatus).To(Equal("in-sync"))
+		Expect(status.InSync).To(BeTrue())
+		Expect(status.FelixConnected).To(BeTrue())
+		Expect(status.LastInSyncTime).NotTo(BeNil())
+		Expect(status.SnapshotIndex).To(BeEquivalentTo(1234))
+		Expect(status.QueueDepths).To(Equal(map[string]int{
+			"events": 5,
+			"felix":  7,
+		}))
+	})
+	It("should trigger a resync on POST to /resync", func() {
+		resyncs := 0
+		monitor.SetDriver(statsDriver{resyncs: &resyncs})
+		Expect(get("/resync")).To(Equal(http.StatusMethodNotAllowed))
+		Expect(resyncs).To(Equal(0))
+		resp, err := http.Post(server.URL+"/resync", "text/plain", nil)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+		Expect(resyncs).To(Equal(1))
+	})
+	It("should remember the last in-sync time during a resync", func() {
+		monitor.OnStatusUpdated(store.InSync)
+		monitor.OnStatusUpdated(store.ResyncInProgress)
+		status := monitor.Status()
+		Expect(status.InSync).To(BeFalse())
+		Expect(status.LastInSyncTime).NotTo(BeNil())
+		Expect(status.StatusChangeTime.Before(*status.LastInSyncTime)).To(BeFalse())
+	})
+})
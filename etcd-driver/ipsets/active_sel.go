@@ -19,7 +19,8 @@ import (
 )
 
 // ActiveSelectorCalculator calculates the active set of selectors from the current set of policies/profiles.
-// It generates events for selectors becoming active/inactive.
+// It generates events for selectors becoming active/inactive.  Tags in rules are treated as selectors
+// that match the endpoints in profiles with that tag.
 type ActiveSelectorCalculator struct {
 	// selectorsByUid maps from a selector's UID to the selector itself.
 	selectorsByUid selByUid
@@ -42,7 +43,8 @@ func NewActiveSelectorCalculator() *ActiveSelectorCalculator {
 }
 
 func (calc *ActiveSelectorCalculator) UpdatePolicy(key backend.PolicyKey, policy *backend.Policy) {
-	calc.updateResource(key, policy.InboundRules, policy.OutboundRules)
+	policy.InboundRules, policy.OutboundRules = calc.updateResource(
+		key, policy.InboundRules, policy.OutboundRules)
 }
 
 func (calc *ActiveSelectorCalculator) DeletePolicy(key backend.PolicyKey) {
@@ -50,14 +52,26 @@ func (calc *ActiveSelectorCalculator) DeletePolicy(key backend.PolicyKey) {
 }
 
 func (calc *ActiveSelectorCalculator) UpdateProfile(key backend.ProfileKey, profile *backend.Profile) {
-	calc.updateResource(key, profile.Rules.InboundRules, profile.Rules.OutboundRules)
+	calc.UpdateProfileRules(key, &profile.Rules)
 }
 
-func (calc *ActiveSelectorCalculator) updateResource(key backend.KeyInterface, inbound, outbound []backend.Rule) {
+func (calc *ActiveSelectorCalculator) UpdateProfileRules(key backend.ProfileKey, rules *backend.ProfileRules) {
+	rules.InboundRules, rules.OutboundRules = calc.updateResource(
+		key, rules.InboundRules, rules.OutboundRules)
+}
+
+func (calc *ActiveSelectorCalculator) DeleteProfile(key backend.ProfileKey) {
+	calc.updateResource(key, []backend.Rule{}, []backend.Rule{})
+}
+
+// updateResource updates the selectors used by the given policy or profile.
+// It returns the rules with their selectors and tags rewritten to IDs and any
+// rules with bad selectors removed.
+func (calc *ActiveSelectorCalculator) updateResource(key backend.KeyInterface, inbound, outbound []backend.Rule) ([]backend.Rule, []backend.Rule) {
 	// Extract all the new selectors.
 	currentSelsByUid := make(selByUid)
-	currentSelsByUid.addSelectorsFromRules(inbound)
-	currentSelsByUid.addSelectorsFromRules(outbound)
+	inbound = currentSelsByUid.addSelectorsFromRules(key, inbound)
+	outbound = currentSelsByUid.addSelectorsFromRules(key, outbound)
 
 	// Find the set of old selectors.
 	knownUids, knownUidsPresent := calc.activeUidsByResource[key]
@@ -119,29 +133,69 @@ func (calc *ActiveSelectorCalculator) updateResource(key backend.KeyInterface, i
 			calc.OnSelectorInactive(sel)
 		}
 	}
+	return inbound, outbound
 }
 
 // selByUid is an augmented map with methods to assist in extracting rules from policies.
 type selByUid map[string]selector.Selector
 
-func (sbu selByUid) addSelectorsFromRules(rules []backend.Rule) {
-	for i, rule := range rules {
+// addSelectorsFromRules adds the selectors and tags used by the rules and
+// rewrites them to their IDs.  Felix can't match a bad selector so a rule with
+// one is rewritten to fail closed: an allow rule is dropped and any other rule
+// becomes a deny rule without the bad selector, which denies at least the
+// traffic that the rule could have matched.  It returns the remaining rules.
+func (sbu selByUid) addSelectorsFromRules(key backend.KeyInterface, rules []backend.Rule) []backend.Rule {
+	validRules := rules[:0]
+	for _, rule := range rules {
 		selStrPs := []*string{&rule.SrcSelector,
 			&rule.DstSelector,
 			&rule.NotSrcSelector,
 			&rule.NotDstSelector}
+		sels := make([]selector.Selector, 0, len(selStrPs))
+		badSelector := false
 		for _, selStrP := range selStrPs {
-			if *selStrP != "" {
-				sel, err := selector.Parse(*selStrP)
-				if err != nil {
-					panic("FIXME: Handle bad selector")
-				}
+			if *selStrP == "" {
+				continue
+			}
+			sel, err := selector.Parse(*selStrP)
+			if err != nil {
+				log.Errorf("Bad selector %#v in rule in %v: %v",
+					*selStrP, key, err)
+				badSelector = true
+				*selStrP = ""
+				continue
+			}
+			sels = append(sels, sel)
+			// FIXME: Remove this horrible hack where we update the policy rule
+			*selStrP = sel.UniqueId()
+		}
+		if badSelector {
+			if rule.Action == "allow" {
+				log.Errorf("Dropping allow rule in %v with bad selector", key)
+				continue
+			}
+			log.Errorf("Replacing %v rule in %v with bad selector by a deny rule",
+				rule.Action, key)
+			rule.Action = "deny"
+		}
+		for _, sel := range sels {
+			sbu[sel.UniqueId()] = sel
+		}
+		// Tags are calculated like selectors; Felix finds the
+		// IP set via the rewritten tag.
+		tagPs := []*string{&rule.SrcTag,
+			&rule.DstTag,
+			&rule.NotSrcTag,
+			&rule.NotDstTag}
+		for _, tagP := range tagPs {
+			if *tagP != "" {
+				sel := tagSelector(*tagP)
 				uid := sel.UniqueId()
 				sbu[uid] = sel
-				// FIXME: Remove this horrible hack where we update the policy rule
-				*selStrP = uid
+				*tagP = uid
 			}
 		}
-		rules[i] = rule
+		validRules = append(validRules, rule)
 	}
+	return validRules
 }
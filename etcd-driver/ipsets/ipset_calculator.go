@@ -15,20 +15,27 @@ package ipsets
 
 import "github.com/projectcalico/calico-go/lib/backend"
 
+// ipMember is a member of an IP set.  We track the IP version with the IP
+// so that Felix can put it in the right family's set.
+type ipMember struct {
+	version int
+	ip      string
+}
+
 type IpsetCalculator struct {
-	keyToIPs            map[backend.KeyInterface][]string
+	keyToIPs            map[backend.KeyInterface][]ipMember
 	keyToMatchingSelIDs map[backend.KeyInterface]map[string]bool
-	selIdToIPToKey      map[string]map[string]map[backend.KeyInterface]bool
+	selIdToIPToKey      map[string]map[ipMember]map[backend.KeyInterface]bool
 
-	OnIPAdded   func(selID string, ip string)
-	OnIPRemoved func(selID string, ip string)
+	OnIPAdded   func(selID string, ipVersion int, ip string)
+	OnIPRemoved func(selID string, ipVersion int, ip string)
 }
 
 func NewIpsetCalculator() *IpsetCalculator {
 	calc := &IpsetCalculator{
-		keyToIPs:            make(map[backend.KeyInterface][]string),
+		keyToIPs:            make(map[backend.KeyInterface][]ipMember),
 		keyToMatchingSelIDs: make(map[backend.KeyInterface]map[string]bool),
-		selIdToIPToKey:      make(map[string]map[string]map[backend.KeyInterface]bool),
+		selIdToIPToKey:      make(map[string]map[ipMember]map[backend.KeyInterface]bool),
 	}
 	return calc
 }
@@ -45,11 +52,11 @@ func (calc *IpsetCalculator) OnMatchStarted(key backend.KeyInterface, selId stri
 	calc.addMatchToIndex(selId, key, ips)
 }
 
-func (calc *IpsetCalculator) addMatchToIndex(selID string, key backend.KeyInterface, ips []string) {
+func (calc *IpsetCalculator) addMatchToIndex(selID string, key backend.KeyInterface, ips []ipMember) {
 	log.Debugf("Selector %v now matches IPs %v via %v", selID, ips, key)
 	ipToKeys, ok := calc.selIdToIPToKey[selID]
 	if !ok {
-		ipToKeys = make(map[string]map[backend.KeyInterface]bool)
+		ipToKeys = make(map[ipMember]map[backend.KeyInterface]bool)
 		calc.selIdToIPToKey[selID] = ipToKeys
 	}
 
@@ -58,7 +65,7 @@ func (calc *IpsetCalculator) addMatchToIndex(selID string, key backend.KeyInterf
 		if !ok {
 			keys = make(map[backend.KeyInterface]bool)
 			ipToKeys[ip] = keys
-			calc.OnIPAdded(selID, ip)
+			calc.OnIPAdded(selID, ip.version, ip.ip)
 		}
 		keys[key] = true
 	}
@@ -75,14 +82,14 @@ func (calc *IpsetCalculator) OnMatchStopped(key backend.KeyInterface, selId stri
 	calc.removeMatchFromIndex(selId, key, ips)
 }
 
-func (calc *IpsetCalculator) removeMatchFromIndex(selID string, key backend.KeyInterface, ips []string) {
+func (calc *IpsetCalculator) removeMatchFromIndex(selID string, key backend.KeyInterface, ips []ipMember) {
 	log.Debugf("Selector %v no longer matches IPs %v via %v", selID, ips, key)
 	ipToKeys := calc.selIdToIPToKey[selID]
 	for _, ip := range ips {
 		keys := ipToKeys[ip]
 		delete(keys, key)
 		if len(keys) == 0 {
-			calc.OnIPRemoved(selID, ip)
+			calc.OnIPRemoved(selID, ip.version, ip.ip)
 			delete(ipToKeys, ip)
 			if len(ipToKeys) == 0 {
 				delete(calc.selIdToIPToKey, selID)
@@ -91,8 +98,18 @@ func (calc *IpsetCalculator) removeMatchFromIndex(selID string, key backend.KeyI
 	}
 }
 
-func (calc *IpsetCalculator) OnEndpointUpdate(endpointKey backend.KeyInterface, ips []string) {
-	log.Debugf("Endpoint %v IPs updated to %v", endpointKey, ips)
+// OnEndpointUpdate updates an endpoint's IPs.  The IPv4 and IPv6 IPs are
+// tracked separately so an IP that moves between the lists is removed from
+// one family's set and added to the other.
+func (calc *IpsetCalculator) OnEndpointUpdate(endpointKey backend.KeyInterface, ipv4s, ipv6s []string) {
+	log.Debugf("Endpoint %v IPs updated to %v %v", endpointKey, ipv4s, ipv6s)
+	ips := make([]ipMember, 0, len(ipv4s)+len(ipv6s))
+	for _, ip := range ipv4s {
+		ips = append(ips, ipMember{version: 4, ip: ip})
+	}
+	for _, ip := range ipv6s {
+		ips = append(ips, ipMember{version: 6, ip: ip})
+	}
 	oldIPs := calc.keyToIPs[endpointKey]
 	if len(ips) == 0 {
 		delete(calc.keyToIPs, endpointKey)
@@ -100,13 +117,13 @@ func (calc *IpsetCalculator) OnEndpointUpdate(endpointKey backend.KeyInterface,
 		calc.keyToIPs[endpointKey] = ips
 	}
 
-	oldIPsSet := make(map[string]bool)
+	oldIPsSet := make(map[ipMember]bool)
 	for _, ip := range oldIPs {
 		oldIPsSet[ip] = true
 	}
 
-	addedIPs := make([]string, 0)
-	currentIPs := make(map[string]bool)
+	addedIPs := make([]ipMember, 0)
+	currentIPs := make(map[ipMember]bool)
 	for _, ip := range ips {
 		if !oldIPsSet[ip] {
 			addedIPs = append(addedIPs, ip)
@@ -114,7 +131,7 @@ func (calc *IpsetCalculator) OnEndpointUpdate(endpointKey backend.KeyInterface,
 		currentIPs[ip] = true
 	}
 
-	removedIPs := make([]string, 0)
+	removedIPs := make([]ipMember, 0)
 	for _, ip := range oldIPs {
 		if !currentIPs[ip] {
 			removedIPs = append(removedIPs, ip)
@@ -130,5 +147,5 @@ func (calc *IpsetCalculator) OnEndpointUpdate(endpointKey backend.KeyInterface,
 }
 
 func (calc *IpsetCalculator) OnEndpointDelete(endpointKey backend.KeyInterface) {
-	calc.OnEndpointUpdate(endpointKey, []string{})
+	calc.OnEndpointUpdate(endpointKey, nil, nil)
 }
@@ -20,10 +20,26 @@ import (
 	"github.com/projectcalico/calico-go/etcd-driver/store"
 	"github.com/projectcalico/calico-go/lib/backend"
 	"github.com/projectcalico/calico-go/lib/selector"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 var log = logging.MustGetLogger("ipsets")
 
+var (
+	activeSelectorsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "etcd_driver_ipsets_active_selectors",
+		Help: "Number of selectors that are in use in policy rules.",
+	})
+	ipSetMembersGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "etcd_driver_ipsets_members",
+		Help: "Total number of IPs in the IP sets of the active selectors.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(activeSelectorsGauge, ipSetMembersGauge)
+}
+
 // Resolver processes datastore updates to calculate the current set of active ipsets.
 // It generates events for ipsets being added/removed and IPs being added/removed from them.
 type Resolver struct {
@@ -37,17 +53,31 @@ type Resolver struct {
 	// different endpoints.
 	ipsetCalc *IpsetCalculator
 
+	// policyKeysByTier tracks the policies in each tier so that we can
+	// clean them up if the tier is deleted.
+	policyKeysByTier map[string]map[backend.PolicyKey]bool
+
+	// labelsByProfile and tagsByProfile hold each profile's labels and
+	// tags, which we combine into the labels that the profile's endpoints
+	// inherit.
+	labelsByProfile map[string]map[string]string
+	tagsByProfile   map[string][]string
+
 	OnSelectorAdded   func(selID string)
-	OnIPAdded         func(selID, ip string)
-	OnIPRemoved       func(selID, ip string)
+	OnIPAdded         func(selID string, ipVersion int, ip string)
+	OnIPRemoved       func(selID string, ipVersion int, ip string)
 	OnSelectorRemoved func(selID string)
 }
 
 func NewResolver() *Resolver {
 	resolver := &Resolver{
+		policyKeysByTier: make(map[string]map[backend.PolicyKey]bool),
+		labelsByProfile:  make(map[string]map[string]string),
+		tagsByProfile:    make(map[string][]string),
+
 		OnSelectorAdded:   func(selID string) {},
-		OnIPAdded:         func(selID, ip string) {},
-		OnIPRemoved:       func(selID, ip string) {},
+		OnIPAdded:         func(selID string, ipVersion int, ip string) {},
+		OnIPRemoved:       func(selID string, ipVersion int, ip string) {},
 		OnSelectorRemoved: func(selID string) {},
 	}
 	resolver.activeSelCalc = NewActiveSelectorCalculator()
@@ -67,8 +97,12 @@ func NewResolver() *Resolver {
 // RegisterWith registers the update callbacks that this object requires with the dispatcher.
 func (res *Resolver) RegisterWith(disp *store.Dispatcher) {
 	disp.Register(backend.WorkloadEndpointKey{}, res.onEndpointUpdate)
+	disp.Register(backend.HostEndpointKey{}, res.onEndpointUpdate)
 	disp.Register(backend.PolicyKey{}, res.onPolicyUpdate)
-	// TODO: Profile update
+	disp.Register(backend.ProfileRulesKey{}, res.onProfileRulesUpdate)
+	disp.Register(backend.ProfileLabelsKey{}, res.onProfileLabelsUpdate)
+	disp.Register(backend.ProfileTagsKey{}, res.onProfileTagsUpdate)
+	disp.Register(backend.TierKey{}, res.onTierUpdate)
 }
 
 // Datastore callbacks:
@@ -76,10 +110,30 @@ func (res *Resolver) RegisterWith(disp *store.Dispatcher) {
 func (res *Resolver) onEndpointUpdate(update *store.ParsedUpdate) {
 	log.Debugf("Endpoint %v updated", update)
 	if update.Value != nil {
-		ep := update.Value.(*backend.WorkloadEndpoint)
-		res.ipsetCalc.OnEndpointUpdate(update.Key, ep.IPv4Nets)
-		// TODO Parent IDs.
-		res.labelIdx.UpdateLabels(update.Key, ep.Labels, make([]interface{}, 0))
+		var ipv4s, ipv6s, profileIDs []string
+		var epLabels map[string]string
+		switch ep := update.Value.(type) {
+		case *backend.WorkloadEndpoint:
+			ipv4s, ipv6s = ep.IPv4Nets, ep.IPv6Nets
+			epLabels, profileIDs = ep.Labels, ep.ProfileID
+		case *backend.HostEndpoint:
+			// Host endpoints have bare IPs; convert them to the
+			// same form as workload endpoints' nets.
+			for _, ip := range ep.ExpectedIPv4Addrs {
+				ipv4s = append(ipv4s, ip.String()+"/32")
+			}
+			for _, ip := range ep.ExpectedIPv6Addrs {
+				ipv6s = append(ipv6s, ip.String()+"/128")
+			}
+			epLabels, profileIDs = ep.Labels, ep.ProfileIDs
+		}
+		res.ipsetCalc.OnEndpointUpdate(update.Key, ipv4s, ipv6s)
+		// The endpoint inherits labels from its profiles.
+		parents := make([]interface{}, len(profileIDs))
+		for i, profileID := range profileIDs {
+			parents[i] = profileID
+		}
+		res.labelIdx.UpdateLabels(update.Key, epLabels, parents)
 	} else {
 		res.ipsetCalc.OnEndpointDelete(update.Key)
 		res.labelIdx.DeleteLabels(update.Key)
@@ -90,34 +144,128 @@ func (res *Resolver) onEndpointUpdate(update *store.ParsedUpdate) {
 // It passes through to the ActiveSetCalculator, which extracts the active ipsets from its rules.
 func (res *Resolver) onPolicyUpdate(update *store.ParsedUpdate) {
 	log.Debugf("Policy %v updated", update)
+	key := update.Key.(backend.PolicyKey)
 	if update.Value != nil {
 		policy := update.Value.(*backend.Policy)
-		res.activeSelCalc.UpdatePolicy(update.Key.(backend.PolicyKey), policy)
+		if _, err := selector.Parse(policy.Selector); err != nil {
+			// Fail closed.  The policy resolver applies a policy
+			// with a bad selector to every endpoint so make sure
+			// that its rules only deny traffic.
+			log.Errorf("Replacing rules of policy %v with bad selector %#v by deny rules: %v",
+				key, policy.Selector, err)
+			policy.Selector = "all()"
+			policy.InboundRules = []backend.Rule{{Action: "deny"}}
+			policy.OutboundRules = []backend.Rule{{Action: "deny"}}
+		}
+		res.activeSelCalc.UpdatePolicy(key, policy)
+		update.ValueUpdated = true
+		if res.policyKeysByTier[key.Tier] == nil {
+			res.policyKeysByTier[key.Tier] = make(map[backend.PolicyKey]bool)
+		}
+		res.policyKeysByTier[key.Tier][key] = true
+	} else {
+		res.activeSelCalc.DeletePolicy(key)
+		delete(res.policyKeysByTier[key.Tier], key)
+		if len(res.policyKeysByTier[key.Tier]) == 0 {
+			delete(res.policyKeysByTier, key.Tier)
+		}
+	}
+}
+
+// onProfileRulesUpdate is called when we get a profile rules update from the
+// datastore.  Like a policy update, it passes through to the
+// ActiveSetCalculator.
+func (res *Resolver) onProfileRulesUpdate(update *store.ParsedUpdate) {
+	log.Debugf("Profile rules %v updated", update)
+	key := update.Key.(backend.ProfileRulesKey)
+	if update.Value != nil {
+		rules := update.Value.(*backend.ProfileRules)
+		res.activeSelCalc.UpdateProfileRules(key.ProfileKey, rules)
 		update.ValueUpdated = true
 	} else {
-		res.activeSelCalc.DeletePolicy(update.Key.(backend.PolicyKey))
+		res.activeSelCalc.DeleteProfile(key.ProfileKey)
+	}
+}
+
+// onProfileLabelsUpdate is called when we get a profile labels update from the
+// datastore.  The profile's labels are inherited by the endpoints that use
+// the profile.
+func (res *Resolver) onProfileLabelsUpdate(update *store.ParsedUpdate) {
+	log.Debugf("Profile labels %v updated", update)
+	key := update.Key.(backend.ProfileLabelsKey)
+	if update.Value != nil {
+		labels := update.Value.(*map[string]string)
+		res.labelsByProfile[key.Name] = *labels
+	} else {
+		delete(res.labelsByProfile, key.Name)
+	}
+	res.updateParentLabels(key.Name)
+}
+
+// onProfileTagsUpdate is called when we get a profile tags update from the
+// datastore.  Each tag is modelled as a label that the profile's endpoints
+// inherit, which the tag selectors match on.
+func (res *Resolver) onProfileTagsUpdate(update *store.ParsedUpdate) {
+	log.Debugf("Profile tags %v updated", update)
+	key := update.Key.(backend.ProfileTagsKey)
+	if update.Value != nil {
+		tags := update.Value.(*[]string)
+		res.tagsByProfile[key.Name] = *tags
+	} else {
+		delete(res.tagsByProfile, key.Name)
+	}
+	res.updateParentLabels(key.Name)
+}
+
+// updateParentLabels combines a profile's labels and tags and passes them to
+// the label index.
+func (res *Resolver) updateParentLabels(profileID string) {
+	labels, labelsPresent := res.labelsByProfile[profileID]
+	tags, tagsPresent := res.tagsByProfile[profileID]
+	if !labelsPresent && !tagsPresent {
+		res.labelIdx.DeleteParentLabels(profileID)
+		return
+	}
+	combined := make(map[string]string, len(labels)+len(tags))
+	for k, v := range labels {
+		combined[k] = v
+	}
+	for _, tag := range tags {
+		combined[tagLabel(tag)] = ""
 	}
+	res.labelIdx.UpdateParentLabels(profileID, combined)
 }
 
-//// OnProfileUpdate is called when we get a profile update from the datastore.
-//// It passes through to the ActiveSetCalculator, which extracts the active ipsets from its rules.
-//func (res *Resolver) OnProfileUpdate(key backend.ProfileKey, policy *backend.Profile) {
-//	log.Infof("Profile %v updated", key)
-//	res.activeSelCalc.UpdateProfile(key, policy)
-//}
+// onTierUpdate is called when we get a tier update from the datastore.
+// Deleting a tier deletes all of its policies; we clean them up straight away
+// rather than relying on the datastore driver to report each deletion.
+func (res *Resolver) onTierUpdate(update *store.ParsedUpdate) {
+	if update.Value != nil {
+		return
+	}
+	key := update.Key.(backend.TierKey)
+	log.Debugf("Tier %v deleted, removing %v policies", key.Name,
+		len(res.policyKeysByTier[key.Name]))
+	for policyKey := range res.policyKeysByTier[key.Name] {
+		res.activeSelCalc.DeletePolicy(policyKey)
+	}
+	delete(res.policyKeysByTier, key.Name)
+}
 
 // IpsetCalculator callbacks:
 
 // onIPAdded is called when an IP is now present in an active selector.
-func (res *Resolver) onIPAdded(selID, ip string) {
-	log.Debugf("IP set %v now contains %v", selID, ip)
-	res.OnIPAdded(selID, ip)
+func (res *Resolver) onIPAdded(selID string, ipVersion int, ip string) {
+	log.Debugf("IPv%v set %v now contains %v", ipVersion, selID, ip)
+	ipSetMembersGauge.Inc()
+	res.OnIPAdded(selID, ipVersion, ip)
 }
 
 // onIPAdded is called when an IP is no longer present in a selector.
-func (res *Resolver) onIPRemoved(selID, ip string) {
-	log.Debugf("IP set %v no longer contains %v", selID, ip)
-	res.OnIPRemoved(selID, ip)
+func (res *Resolver) onIPRemoved(selID string, ipVersion int, ip string) {
+	log.Debugf("IPv%v set %v no longer contains %v", ipVersion, selID, ip)
+	ipSetMembersGauge.Dec()
+	res.OnIPRemoved(selID, ipVersion, ip)
 }
 
 // LabelIndex callbacks:
@@ -140,6 +288,7 @@ func (res *Resolver) onMatchStopped(selId, labelId interface{}) {
 // It adds the selector to the label index and starts tracking it.
 func (res *Resolver) onSelectorActive(sel selector.Selector) {
 	log.Infof("Selector %v now active", sel)
+	activeSelectorsGauge.Inc()
 	res.OnSelectorAdded(sel.UniqueId())
 	res.labelIdx.UpdateSelector(sel.UniqueId(), sel)
 }
@@ -148,6 +297,7 @@ func (res *Resolver) onSelectorActive(sel selector.Selector) {
 // It removes the selector to the label index and stops tracking it.
 func (res *Resolver) onSelectorInactive(sel selector.Selector) {
 	log.Infof("Selector %v now inactive", sel)
+	activeSelectorsGauge.Dec()
 	res.labelIdx.DeleteSelector(sel.UniqueId())
 	res.OnSelectorRemoved(sel.UniqueId())
 }
@@ -17,13 +17,349 @@ package ipsets_test
 import (
 	. "github.com/projectcalico/calico-go/etcd-driver/ipsets"
 
+	"encoding/json"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+	"github.com/projectcalico/calico-go/lib/backend"
+	"github.com/projectcalico/calico-go/lib/selector"
+)
+
+const (
+	ep1Key      = "/calico/v1/host/myhost/workload/k8s/pod1/endpoint/eth0"
+	ep2Key      = "/calico/v1/host/myhost/workload/k8s/pod2/endpoint/eth0"
+	ep3Key      = "/calico/v1/host/myhost/workload/k8s/pod3/endpoint/eth0"
+	hepKey      = "/calico/v1/host/myhost/endpoint/eth1"
+	profRules   = "/calico/v1/policy/profile/prof1/rules"
+	profLabels  = "/calico/v1/policy/profile/prof1/labels"
+	profTags    = "/calico/v1/policy/profile/prof1/tags"
+	prof2Tags   = "/calico/v1/policy/profile/prof2/tags"
+	tier1Key    = "/calico/v1/policy/tier/t1/metadata"
+	webSelector = "app == 'web'"
 )
 
+func policyKey(tier, name string) string {
+	return "/calico/v1/policy/tier/" + tier + "/policy/" + name
+}
+
+func tagID(tag string) string {
+	value := `{"inbound_rules": [{"src_tag": "` + tag + `"}]}`
+	update := &store.Update{Key: "/calico/v1/policy/profile/scratch/rules", ValueOrNil: &value}
+	disp := store.NewDispatcher()
+	NewResolver().RegisterWith(disp)
+	disp.DispatchUpdate(update)
+	var rules backend.ProfileRules
+	Expect(json.Unmarshal([]byte(*update.ValueOrNil), &rules)).To(Succeed())
+	return rules.InboundRules[0].SrcTag
+}
+
+func selID(sel string) string {
+	parsed, err := selector.Parse(sel)
+	Expect(err).NotTo(HaveOccurred())
+	return parsed.UniqueId()
+}
+
 var _ = Describe("Resolver", func() {
-	It("foo", func() {
-		_ = NewIpsetCalculator()
-		Expect("foo").To(Equal("foo"))
+	var disp *store.Dispatcher
+	var ipsets map[string]map[string]bool
+	// ipVersions records the IP versions of each IP in each IP set.  An IP
+	// that moves between versions is briefly in both.
+	var ipVersions map[string]map[string]map[int]bool
+
+	set := func(key, value string) {
+		disp.DispatchUpdate(&store.Update{Key: key, ValueOrNil: &value})
+	}
+	del := func(key string) {
+		disp.DispatchUpdate(&store.Update{Key: key})
+	}
+
+	BeforeEach(func() {
+		disp = store.NewDispatcher()
+		res := NewResolver()
+		res.RegisterWith(disp)
+		ipsets = make(map[string]map[string]bool)
+		ipVersions = make(map[string]map[string]map[int]bool)
+		res.OnSelectorAdded = func(selID string) {
+			Expect(ipsets).NotTo(HaveKey(selID))
+			ipsets[selID] = make(map[string]bool)
+			ipVersions[selID] = make(map[string]map[int]bool)
+		}
+		res.OnSelectorRemoved = func(selID string) {
+			Expect(ipsets).To(HaveKey(selID))
+			delete(ipsets, selID)
+			delete(ipVersions, selID)
+		}
+		res.OnIPAdded = func(selID string, ipVersion int, ip string) {
+			Expect(ipsets).To(HaveKey(selID))
+			Expect(ipVersions[selID][ip]).NotTo(HaveKey(ipVersion))
+			ipsets[selID][ip] = true
+			if ipVersions[selID][ip] == nil {
+				ipVersions[selID][ip] = make(map[int]bool)
+			}
+			ipVersions[selID][ip][ipVersion] = true
+		}
+		res.OnIPRemoved = func(selID string, ipVersion int, ip string) {
+			Expect(ipVersions[selID][ip]).To(HaveKey(ipVersion))
+			delete(ipVersions[selID][ip], ipVersion)
+			if len(ipVersions[selID][ip]) == 0 {
+				delete(ipVersions[selID], ip)
+				delete(ipsets[selID], ip)
+			}
+		}
+
+		set(ep1Key, `{"labels": {"app": "web"}, "ipv4_nets": ["10.0.0.1/32"]}`)
+		set(ep2Key, `{"labels": {"app": "db"}, "ipv4_nets": ["10.0.0.2/32"]}`)
+	})
+
+	It("should calculate IP sets for selectors in policy rules", func() {
+		set(policyKey("t1", "p1"),
+			`{"selector": "all()", "inbound_rules": [{"src_selector": "app == 'web'"}]}`)
+		Expect(ipsets).To(Equal(map[string]map[string]bool{
+			selID(webSelector): {"10.0.0.1/32": true},
+		}))
+	})
+	It("should rewrite rule selectors to their IDs", func() {
+		update := &store.Update{Key: policyKey("t1", "p1")}
+		value := `{"selector": "all()", "inbound_rules": [{"src_selector": "app == 'web'"}]}`
+		update.ValueOrNil = &value
+		disp.DispatchUpdate(update)
+		Expect(*update.ValueOrNil).To(ContainSubstring(selID(webSelector)))
+	})
+	Describe("with bad selectors", func() {
+		// rewrite dispatches the policy and returns the inbound rules
+		// that would be sent to Felix.
+		rewrite := func(rules string) []backend.Rule {
+			update := &store.Update{Key: policyKey("t1", "p1")}
+			value := `{"selector": "all()", "inbound_rules": ` + rules + `}`
+			update.ValueOrNil = &value
+			disp.DispatchUpdate(update)
+			policy := backend.Policy{}
+			Expect(json.Unmarshal([]byte(*update.ValueOrNil), &policy)).To(Succeed())
+			return policy.InboundRules
+		}
+
+		It("should drop allow rules", func() {
+			rules := rewrite(`[{"action": "allow", "!src_selector": "app =="}, ` +
+				`{"action": "deny", "src_selector": "app == 'web'"}]`)
+			Expect(rules).To(Equal([]backend.Rule{
+				{Action: "deny", SrcSelector: selID(webSelector)},
+			}))
+			Expect(ipsets).To(Equal(map[string]map[string]bool{
+				selID(webSelector): {"10.0.0.1/32": true},
+			}))
+		})
+		It("should keep deny rules, matching everything in place of the bad selector", func() {
+			rules := rewrite(`[{"action": "deny", "src_selector": "app ==", ` +
+				`"dst_selector": "app == 'web'"}, ` +
+				`{"action": "deny", "!dst_selector": "app =="}, ` +
+				`{"action": "allow"}]`)
+			Expect(rules).To(Equal([]backend.Rule{
+				{Action: "deny", DstSelector: selID(webSelector)},
+				{Action: "deny"},
+				{Action: "allow"},
+			}))
+			Expect(ipsets).To(HaveKey(selID(webSelector)))
+		})
+		It("should replace the rules of a policy with a bad selector by deny rules", func() {
+			update := &store.Update{Key: policyKey("t1", "p1")}
+			value := `{"selector": "app ==", "inbound_rules": [{"action": "allow", "src_selector": "app == 'web'"}]}`
+			update.ValueOrNil = &value
+			disp.DispatchUpdate(update)
+			policy := backend.Policy{}
+			Expect(json.Unmarshal([]byte(*update.ValueOrNil), &policy)).To(Succeed())
+			Expect(policy.Selector).To(Equal("all()"))
+			Expect(policy.InboundRules).To(Equal([]backend.Rule{{Action: "deny"}}))
+			Expect(policy.OutboundRules).To(Equal([]backend.Rule{{Action: "deny"}}))
+			Expect(ipsets).To(BeEmpty())
+		})
+		It("should turn next-tier rules into deny rules", func() {
+			rules := rewrite(`[{"action": "next-tier", "src_selector": "app =="}]`)
+			Expect(rules).To(Equal([]backend.Rule{{Action: "deny"}}))
+			Expect(ipsets).To(BeEmpty())
+		})
+	})
+	It("should include IPv6 addresses in IP sets", func() {
+		set(ep1Key, `{"labels": {"app": "web"}, "ipv4_nets": ["10.0.0.1/32"], "ipv6_nets": ["fd00::1/128"]}`)
+		set(policyKey("t1", "p1"),
+			`{"selector": "all()", "inbound_rules": [{"src_selector": "app == 'web'"}]}`)
+		Expect(ipsets).To(Equal(map[string]map[string]bool{
+			selID(webSelector): {"10.0.0.1/32": true, "fd00::1/128": true},
+		}))
+		Expect(ipVersions[selID(webSelector)]).To(Equal(map[string]map[int]bool{
+			"10.0.0.1/32": {4: true},
+			"fd00::1/128": {6: true},
+		}))
+	})
+	It("should handle IPs moving between IP versions", func() {
+		set(policyKey("t1", "p1"),
+			`{"selector": "all()", "inbound_rules": [{"src_selector": "app == 'web'"}]}`)
+		set(ep1Key, `{"labels": {"app": "web"}, "ipv6_nets": ["10.0.0.1/32"]}`)
+		Expect(ipsets[selID(webSelector)]).To(Equal(map[string]bool{"10.0.0.1/32": true}))
+		Expect(ipVersions[selID(webSelector)]["10.0.0.1/32"]).To(Equal(map[int]bool{6: true}))
+		set(ep1Key, `{"labels": {"app": "web"}, "ipv4_nets": ["10.0.0.1/32"]}`)
+		Expect(ipVersions[selID(webSelector)]["10.0.0.1/32"]).To(Equal(map[int]bool{4: true}))
+		del(ep1Key)
+		Expect(ipsets[selID(webSelector)]).To(BeEmpty())
+	})
+	It("should include host endpoints in IP sets", func() {
+		set(policyKey("t1", "p1"),
+			`{"selector": "all()", "inbound_rules": [{"src_selector": "role == 'host'"}]}`)
+		set(hepKey, `{"labels": {"role": "host"}, "expected_ipv4_addrs": ["10.1.0.1"], "expected_ipv6_addrs": ["fd00::1:1"]}`)
+		Expect(ipsets[selID("role == 'host'")]).To(Equal(map[string]bool{
+			"10.1.0.1/32":   true,
+			"fd00::1:1/128": true,
+		}))
+		Expect(ipVersions[selID("role == 'host'")]["fd00::1:1/128"]).To(Equal(map[int]bool{6: true}))
+
+		set(hepKey, `{"labels": {"role": "host"}, "expected_ipv4_addrs": ["10.1.0.2"]}`)
+		Expect(ipsets[selID("role == 'host'")]).To(Equal(map[string]bool{
+			"10.1.0.2/32": true,
+		}))
+		del(hepKey)
+		Expect(ipsets[selID("role == 'host'")]).To(BeEmpty())
+	})
+	It("should calculate IP sets for selectors in profile rules", func() {
+		set(profRules, `{"inbound_rules": [{"src_selector": "app == 'web'"}], "outbound_rules": [{"dst_selector": "app == 'db'"}]}`)
+		Expect(ipsets).To(Equal(map[string]map[string]bool{
+			selID(webSelector):   {"10.0.0.1/32": true},
+			selID("app == 'db'"): {"10.0.0.2/32": true},
+		}))
+	})
+	It("should remove IP sets when profile rules change", func() {
+		set(profRules, `{"inbound_rules": [{"src_selector": "app == 'web'"}]}`)
+		set(profRules, `{"inbound_rules": [{"src_selector": "app == 'db'"}]}`)
+		Expect(ipsets).To(Equal(map[string]map[string]bool{
+			selID("app == 'db'"): {"10.0.0.2/32": true},
+		}))
+	})
+	It("should remove IP sets when profile rules are deleted", func() {
+		set(profRules, `{"inbound_rules": [{"src_selector": "app == 'web'"}]}`)
+		del(profRules)
+		Expect(ipsets).To(BeEmpty())
+	})
+	It("should remove IP sets when a tier is deleted", func() {
+		set(tier1Key, `{"order": 10}`)
+		set(policyKey("t1", "p1"),
+			`{"selector": "all()", "inbound_rules": [{"src_selector": "app == 'web'"}]}`)
+		set(policyKey("t1", "p2"),
+			`{"selector": "all()", "inbound_rules": [{"src_selector": "app == 'db'"}]}`)
+		set(policyKey("t2", "p1"),
+			`{"selector": "all()", "inbound_rules": [{"src_selector": "has(app)"}]}`)
+		del(tier1Key)
+		Expect(ipsets).To(Equal(map[string]map[string]bool{
+			selID("has(app)"): {"10.0.0.1/32": true, "10.0.0.2/32": true},
+		}))
+
+		// The per-policy deletions that follow should be harmless.
+		del(policyKey("t1", "p1"))
+		del(policyKey("t1", "p2"))
+		Expect(ipsets).To(HaveLen(1))
+	})
+	It("should keep a selector shared by a policy and a profile until both are gone", func() {
+		set(policyKey("t1", "p1"),
+			`{"selector": "all()", "inbound_rules": [{"src_selector": "app == 'web'"}]}`)
+		set(profRules, `{"inbound_rules": [{"src_selector": "app == 'web'"}]}`)
+		del(policyKey("t1", "p1"))
+		Expect(ipsets).To(HaveKey(selID(webSelector)))
+		del(profRules)
+		Expect(ipsets).To(BeEmpty())
+	})
+
+	Describe("with an endpoint that uses a profile", func() {
+		dbSelector := "role == 'db'"
+
+		BeforeEach(func() {
+			set(profRules, `{"inbound_rules": [{"src_selector": "role == 'db'"}]}`)
+			set(ep3Key, `{"profile_ids": ["prof1"], "ipv4_nets": ["10.0.0.3/32"]}`)
+		})
+
+		It("should match on labels inherited from the profile", func() {
+			Expect(ipsets[selID(dbSelector)]).To(BeEmpty())
+			set(profLabels, `{"role": "db"}`)
+			Expect(ipsets[selID(dbSelector)]).To(Equal(map[string]bool{
+				"10.0.0.3/32": true,
+			}))
+		})
+		It("should stop matching when the profile labels are deleted", func() {
+			set(profLabels, `{"role": "db"}`)
+			del(profLabels)
+			Expect(ipsets[selID(dbSelector)]).To(BeEmpty())
+		})
+		It("should stop matching when the profile labels change", func() {
+			set(profLabels, `{"role": "db"}`)
+			set(profLabels, `{"role": "web"}`)
+			Expect(ipsets[selID(dbSelector)]).To(BeEmpty())
+		})
+		It("should stop matching when the endpoint leaves the profile", func() {
+			set(profLabels, `{"role": "db"}`)
+			set(ep3Key, `{"ipv4_nets": ["10.0.0.3/32"]}`)
+			Expect(ipsets[selID(dbSelector)]).To(BeEmpty())
+		})
+		It("should calculate IP sets for tags", func() {
+			set(profTags, `["db"]`)
+			set(policyKey("t1", "p1"),
+				`{"selector": "all()", "inbound_rules": [{"src_tag": "db"}]}`)
+			Expect(ipsets[tagID("db")]).To(Equal(map[string]bool{
+				"10.0.0.3/32": true,
+			}))
+		})
+		It("should give tag and selector IP sets different IDs", func() {
+			Expect(tagID("db")).NotTo(Equal(selID("has(db)")))
+			Expect(tagID("db")).NotTo(Equal(tagID("web")))
+		})
+		It("should not match a tag on labels", func() {
+			set(ep1Key, `{"labels": {"db": ""}, "ipv4_nets": ["10.0.0.1/32"]}`)
+			set(profLabels, `{"db": ""}`)
+			set(policyKey("t1", "p1"),
+				`{"selector": "all()", "inbound_rules": [{"dst_tag": "db"}]}`)
+			Expect(ipsets[tagID("db")]).To(BeEmpty())
+		})
+		It("should update tag IP sets as tags and profile membership change", func() {
+			set(policyKey("t1", "p1"),
+				`{"selector": "all()", "outbound_rules": [{"!dst_tag": "db"}]}`)
+			Expect(ipsets[tagID("db")]).To(BeEmpty())
+			set(profTags, `["db", "other"]`)
+			set(prof2Tags, `["db"]`)
+			set(ep1Key, `{"profile_ids": ["prof2"], "ipv4_nets": ["10.0.0.1/32"]}`)
+			Expect(ipsets[tagID("db")]).To(Equal(map[string]bool{
+				"10.0.0.1/32": true,
+				"10.0.0.3/32": true,
+			}))
+			set(profTags, `["other"]`)
+			Expect(ipsets[tagID("db")]).To(Equal(map[string]bool{
+				"10.0.0.1/32": true,
+			}))
+			del(prof2Tags)
+			Expect(ipsets[tagID("db")]).To(BeEmpty())
+		})
+		It("should keep profile labels when the tags are deleted", func() {
+			set(profLabels, `{"role": "db"}`)
+			set(profTags, `["db"]`)
+			del(profTags)
+			Expect(ipsets[selID(dbSelector)]).To(Equal(map[string]bool{
+				"10.0.0.3/32": true,
+			}))
+		})
+		It("should match host endpoints on labels inherited from the profile", func() {
+			set(profLabels, `{"role": "db"}`)
+			set(hepKey, `{"profile_ids": ["prof1"], "expected_ipv4_addrs": ["10.1.0.1"]}`)
+			Expect(ipsets[selID(dbSelector)]).To(Equal(map[string]bool{
+				"10.0.0.3/32": true,
+				"10.1.0.1/32": true,
+			}))
+			set(profTags, `["db"]`)
+			set(policyKey("t1", "p1"),
+				`{"selector": "all()", "inbound_rules": [{"src_tag": "db"}]}`)
+			Expect(ipsets[tagID("db")]).To(Equal(map[string]bool{
+				"10.0.0.3/32": true,
+				"10.1.0.1/32": true,
+			}))
+		})
+		It("should prefer the endpoint's own labels", func() {
+			set(profLabels, `{"role": "db"}`)
+			set(ep3Key, `{"profile_ids": ["prof1"], "labels": {"role": "web"}, "ipv4_nets": ["10.0.0.3/32"]}`)
+			Expect(ipsets[selID(dbSelector)]).To(BeEmpty())
+		})
 	})
 })
@@ -0,0 +1,57 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipsets
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/projectcalico/calico-go/lib/selector"
+)
+
+// tagLabelPrefix prefixes the labels that we use to model profile tags.  A
+// colon can't appear in a valid label name so these labels can't clash with
+// real labels or be matched by a user's selector.
+const tagLabelPrefix = "calico/tag:"
+
+// tagLabel returns the name of the label that endpoints inherit from a
+// profile with the given tag.
+func tagLabel(tag string) string {
+	return tagLabelPrefix + tag
+}
+
+// tagSelector is a selector that matches endpoints in a profile with the given
+// tag.  We model a tag as a label that the profile's endpoints inherit so that
+// tag IP sets and selector IP sets can share the label index.
+type tagSelector string
+
+func (tag tagSelector) Evaluate(labels map[string]string) bool {
+	_, ok := labels[tagLabel(string(tag))]
+	return ok
+}
+
+func (tag tagSelector) String() string {
+	return "tag(" + string(tag) + ")"
+}
+
+// UniqueId returns a hash of the tag, in the same format as the IDs of real
+// selectors.  Since "tag(...)" isn't valid selector syntax, the IDs can't
+// clash.
+func (tag tagSelector) UniqueId() string {
+	hash := sha256.Sum224([]byte(tag.String()))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+var _ selector.Selector = tagSelector("")
@@ -0,0 +1,369 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policy calculates which policies apply to each of the local
+// endpoints, so that Felix doesn't have to.
+package policy
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/op/go-logging"
+	"github.com/projectcalico/calico-go/datastructures/labels"
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+	"github.com/projectcalico/calico-go/lib/backend"
+	"github.com/projectcalico/calico-go/lib/selector"
+)
+
+var log = logging.MustGetLogger("policy")
+
+// TierPolicies lists the policies in a tier that apply to an endpoint, in the
+// order that they should be applied.
+type TierPolicies struct {
+	Name     string
+	Policies []string
+}
+
+// Resolver calculates, for each endpoint on our host, the ordered list of tiers
+// and the policies in each tier whose selectors match the endpoint's labels.
+// Tiers and the policies within a tier are ordered by their order field, with
+// a missing order sorting last, and then by name.  Policies in a tier that
+// doesn't have any metadata are still applied, as if the tier had no order.
+//
+// It generates an event whenever the list for an endpoint changes.  It also
+// tracks which policies apply to at least one local endpoint and which
+// profiles are used by at least one local endpoint, and generates events as
+// they become active or inactive.
+type Resolver struct {
+	hostname string
+
+	// labelIdx matches the local endpoints' labels against the policies'
+	// selectors.
+	labelIdx labels.LabelInheritanceIndex
+
+	tierOrders   map[string]*float32
+	policyOrders map[backend.PolicyKey]*float32
+	localEPs     map[backend.KeyInterface]bool
+	policiesByEP map[backend.KeyInterface]map[backend.PolicyKey]bool
+	epsByPolicy  map[backend.PolicyKey]map[backend.KeyInterface]bool
+	dirtyEPs     map[backend.KeyInterface]bool
+	tiersByEP    map[backend.KeyInterface][]TierPolicies
+	// profilesByEP and epCountByProfile track the profiles used by the
+	// local endpoints.
+	profilesByEP     map[backend.KeyInterface][]string
+	epCountByProfile map[string]int
+
+	// OnEndpointTiersUpdate is called with the new list of tiers for an
+	// endpoint, or with nil tiers once the endpoint has been deleted.
+	OnEndpointTiersUpdate func(endpointKey backend.KeyInterface, tiers []TierPolicies)
+
+	OnPolicyActive    func(key backend.PolicyKey)
+	OnPolicyInactive  func(key backend.PolicyKey)
+	OnProfileActive   func(key backend.ProfileKey)
+	OnProfileInactive func(key backend.ProfileKey)
+}
+
+func NewResolver(hostname string) *Resolver {
+	res := &Resolver{
+		hostname:     hostname,
+		tierOrders:   make(map[string]*float32),
+		policyOrders: make(map[backend.PolicyKey]*float32),
+		localEPs:     make(map[backend.KeyInterface]bool),
+		policiesByEP: make(map[backend.KeyInterface]map[backend.PolicyKey]bool),
+		epsByPolicy:  make(map[backend.PolicyKey]map[backend.KeyInterface]bool),
+		dirtyEPs:     make(map[backend.KeyInterface]bool),
+		tiersByEP:    make(map[backend.KeyInterface][]TierPolicies),
+
+		profilesByEP:     make(map[backend.KeyInterface][]string),
+		epCountByProfile: make(map[string]int),
+
+		OnEndpointTiersUpdate: func(endpointKey backend.KeyInterface, tiers []TierPolicies) {},
+		OnPolicyActive:        func(key backend.PolicyKey) {},
+		OnPolicyInactive:      func(key backend.PolicyKey) {},
+		OnProfileActive:       func(key backend.ProfileKey) {},
+		OnProfileInactive:     func(key backend.ProfileKey) {},
+	}
+	res.labelIdx = labels.NewInheritanceIndex(res.onMatchStarted, res.onMatchStopped)
+	return res
+}
+
+// RegisterWith registers the update callbacks that this object requires with the dispatcher.
+func (res *Resolver) RegisterWith(disp *store.Dispatcher) {
+	disp.Register(backend.WorkloadEndpointKey{}, res.onEndpointUpdate)
+	disp.Register(backend.HostEndpointKey{}, res.onEndpointUpdate)
+	disp.Register(backend.PolicyKey{}, res.onPolicyUpdate)
+	disp.Register(backend.TierKey{}, res.onTierUpdate)
+	disp.Register(backend.ProfileLabelsKey{}, res.onProfileLabelsUpdate)
+}
+
+// Datastore callbacks:
+
+func (res *Resolver) onEndpointUpdate(update *store.ParsedUpdate) {
+	var hostname string
+	var epLabels map[string]string
+	var profileIDs []string
+	switch key := update.Key.(type) {
+	case backend.WorkloadEndpointKey:
+		hostname = key.Hostname
+		if update.Value != nil {
+			ep := update.Value.(*backend.WorkloadEndpoint)
+			epLabels, profileIDs = ep.Labels, ep.ProfileID
+		}
+	case backend.HostEndpointKey:
+		hostname = key.Hostname
+		if update.Value != nil {
+			ep := update.Value.(*backend.HostEndpoint)
+			epLabels, profileIDs = ep.Labels, ep.ProfileIDs
+		}
+	}
+	if hostname != res.hostname {
+		// Only our own endpoints are interesting.
+		return
+	}
+	log.Debugf("Local endpoint %v updated", update.Key)
+	if update.Value != nil {
+		res.localEPs[update.Key] = true
+		// The endpoint inherits labels from its profiles.
+		parents := make([]interface{}, len(profileIDs))
+		for i, profileID := range profileIDs {
+			parents[i] = profileID
+		}
+		res.labelIdx.UpdateLabels(update.Key, epLabels, parents)
+	} else {
+		delete(res.localEPs, update.Key)
+		res.labelIdx.DeleteLabels(update.Key)
+	}
+	res.updateProfiles(update.Key, profileIDs)
+	res.dirtyEPs[update.Key] = true
+	res.flush()
+}
+
+// updateProfiles updates the set of profiles used by an endpoint.
+func (res *Resolver) updateProfiles(epKey backend.KeyInterface, profileIDs []string) {
+	oldIDs := res.profilesByEP[epKey]
+	newIDs := make([]string, 0, len(profileIDs))
+	seen := make(map[string]bool)
+	for _, id := range profileIDs {
+		if !seen[id] {
+			seen[id] = true
+			newIDs = append(newIDs, id)
+		}
+	}
+	// Add the new references before removing the old ones so that a
+	// profile that the endpoint still uses never goes inactive.
+	for _, id := range newIDs {
+		res.epCountByProfile[id]++
+		if res.epCountByProfile[id] == 1 {
+			log.Debugf("Profile %v now active", id)
+			res.OnProfileActive(backend.ProfileKey{Name: id})
+		}
+	}
+	for _, id := range oldIDs {
+		res.epCountByProfile[id]--
+		if res.epCountByProfile[id] == 0 {
+			log.Debugf("Profile %v now inactive", id)
+			delete(res.epCountByProfile, id)
+			res.OnProfileInactive(backend.ProfileKey{Name: id})
+		}
+	}
+	if len(newIDs) > 0 {
+		res.profilesByEP[epKey] = newIDs
+	} else {
+		delete(res.profilesByEP, epKey)
+	}
+}
+
+func (res *Resolver) onPolicyUpdate(update *store.ParsedUpdate) {
+	key := update.Key.(backend.PolicyKey)
+	log.Debugf("Policy %v updated", key)
+	var sel selector.Selector
+	if update.Value != nil {
+		policy := update.Value.(*backend.Policy)
+		var err error
+		sel, err = selector.Parse(policy.Selector)
+		if err != nil {
+			// Fail closed: ignoring the policy would drop any deny
+			// rules so apply it to every endpoint instead.  The IP
+			// set resolver replaces its rules with deny rules.
+			log.Errorf("Applying policy %v with bad selector %#v to all endpoints: %v",
+				key, policy.Selector, err)
+			sel, _ = selector.Parse("all()")
+		}
+		if !reflect.DeepEqual(res.policyOrders[key], policy.Order) {
+			res.markPolicyDirty(key)
+		}
+		res.policyOrders[key] = policy.Order
+	}
+	if sel != nil {
+		res.labelIdx.UpdateSelector(key, sel)
+	} else {
+		delete(res.policyOrders, key)
+		res.labelIdx.DeleteSelector(key)
+	}
+	res.flush()
+}
+
+func (res *Resolver) onTierUpdate(update *store.ParsedUpdate) {
+	key := update.Key.(backend.TierKey)
+	log.Debugf("Tier %v updated", key)
+	if update.Value != nil {
+		res.tierOrders[key.Name] = update.Value.(*backend.Tier).Order
+	} else {
+		delete(res.tierOrders, key.Name)
+	}
+	for policyKey := range res.epsByPolicy {
+		if policyKey.Tier == key.Name {
+			res.markPolicyDirty(policyKey)
+		}
+	}
+	res.flush()
+}
+
+// onProfileLabelsUpdate passes a profile's labels to the label index, which
+// applies them to the endpoints that use the profile.
+func (res *Resolver) onProfileLabelsUpdate(update *store.ParsedUpdate) {
+	key := update.Key.(backend.ProfileLabelsKey)
+	log.Debugf("Profile labels %v updated", key)
+	if update.Value != nil {
+		res.labelIdx.UpdateParentLabels(key.Name, *update.Value.(*map[string]string))
+	} else {
+		res.labelIdx.DeleteParentLabels(key.Name)
+	}
+	res.flush()
+}
+
+// LabelIndex callbacks:
+
+func (res *Resolver) onMatchStarted(selId, labelId interface{}) {
+	policyKey := selId.(backend.PolicyKey)
+	epKey := labelId.(backend.KeyInterface)
+	log.Debugf("Policy %v now applies to %v", policyKey, epKey)
+	if res.policiesByEP[epKey] == nil {
+		res.policiesByEP[epKey] = make(map[backend.PolicyKey]bool)
+	}
+	res.policiesByEP[epKey][policyKey] = true
+	if res.epsByPolicy[policyKey] == nil {
+		res.epsByPolicy[policyKey] = make(map[backend.KeyInterface]bool)
+		log.Debugf("Policy %v now active", policyKey)
+		res.OnPolicyActive(policyKey)
+	}
+	res.epsByPolicy[policyKey][epKey] = true
+	res.dirtyEPs[epKey] = true
+}
+
+func (res *Resolver) onMatchStopped(selId, labelId interface{}) {
+	policyKey := selId.(backend.PolicyKey)
+	epKey := labelId.(backend.KeyInterface)
+	log.Debugf("Policy %v no longer applies to %v", policyKey, epKey)
+	delete(res.policiesByEP[epKey], policyKey)
+	if len(res.policiesByEP[epKey]) == 0 {
+		delete(res.policiesByEP, epKey)
+	}
+	delete(res.epsByPolicy[policyKey], epKey)
+	if len(res.epsByPolicy[policyKey]) == 0 {
+		delete(res.epsByPolicy, policyKey)
+		log.Debugf("Policy %v now inactive", policyKey)
+		res.OnPolicyInactive(policyKey)
+	}
+	res.dirtyEPs[epKey] = true
+}
+
+// markPolicyDirty marks all the endpoints that a policy applies to as needing
+// to be recalculated.
+func (res *Resolver) markPolicyDirty(key backend.PolicyKey) {
+	for epKey := range res.epsByPolicy[key] {
+		res.dirtyEPs[epKey] = true
+	}
+}
+
+// flush recalculates the tiers of the dirty endpoints and reports any that
+// have changed.
+func (res *Resolver) flush() {
+	for epKey := range res.dirtyEPs {
+		oldTiers, known := res.tiersByEP[epKey]
+		if !res.localEPs[epKey] {
+			if known {
+				delete(res.tiersByEP, epKey)
+				res.OnEndpointTiersUpdate(epKey, nil)
+			}
+			continue
+		}
+		tiers := res.calculateTiers(epKey)
+		if known && reflect.DeepEqual(oldTiers, tiers) {
+			continue
+		}
+		log.Debugf("Endpoint %v now has tiers %v", epKey, tiers)
+		res.tiersByEP[epKey] = tiers
+		res.OnEndpointTiersUpdate(epKey, tiers)
+	}
+	res.dirtyEPs = make(map[backend.KeyInterface]bool)
+}
+
+func (res *Resolver) calculateTiers(epKey backend.KeyInterface) []TierPolicies {
+	policiesByTier := make(map[string][]backend.PolicyKey)
+	for policyKey := range res.policiesByEP[epKey] {
+		policiesByTier[policyKey.Tier] = append(policiesByTier[policyKey.Tier], policyKey)
+	}
+	tierNames := make([]string, 0, len(policiesByTier))
+	for name := range policiesByTier {
+		tierNames = append(tierNames, name)
+	}
+	sort.Sort(byOrderThenName{
+		names:  tierNames,
+		orders: func(i int) *float32 { return res.tierOrders[tierNames[i]] },
+	})
+	tiers := make([]TierPolicies, len(tierNames))
+	for i, tierName := range tierNames {
+		policyKeys := policiesByTier[tierName]
+		policyNames := make([]string, len(policyKeys))
+		for j, policyKey := range policyKeys {
+			policyNames[j] = policyKey.Name
+		}
+		sort.Sort(byOrderThenName{
+			names: policyNames,
+			orders: func(j int) *float32 {
+				return res.policyOrders[backend.PolicyKey{Tier: tierName, Name: policyNames[j]}]
+			},
+		})
+		tiers[i] = TierPolicies{Name: tierName, Policies: policyNames}
+	}
+	return tiers
+}
+
+// byOrderThenName sorts names by their order, with a nil order sorting last,
+// then by name.
+type byOrderThenName struct {
+	names  []string
+	orders func(i int) *float32
+}
+
+func (s byOrderThenName) Len() int {
+	return len(s.names)
+}
+
+func (s byOrderThenName) Less(i, j int) bool {
+	orderI, orderJ := s.orders(i), s.orders(j)
+	if orderI != nil && orderJ != nil && *orderI != *orderJ {
+		return *orderI < *orderJ
+	}
+	if (orderI == nil) != (orderJ == nil) {
+		return orderI != nil
+	}
+	return s.names[i] < s.names[j]
+}
+
+func (s byOrderThenName) Swap(i, j int) {
+	s.names[i], s.names[j] = s.names[j], s.names[i]
+}
@@ -0,0 +1,294 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy_test
+
+import (
+	. "github.com/projectcalico/calico-go/etcd-driver/policy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+	"github.com/projectcalico/calico-go/lib/backend"
+)
+
+const (
+	ep1Key  = "/calico/v1/host/myhost/workload/k8s/pod1/endpoint/eth0"
+	ep2Key  = "/calico/v1/host/myhost/workload/k8s/pod2/endpoint/eth0"
+	hepKey  = "/calico/v1/host/myhost/endpoint/eth1"
+	otherEP = "/calico/v1/host/otherhost/workload/k8s/pod3/endpoint/eth0"
+)
+
+var (
+	ep1 = backend.WorkloadEndpointKey{
+		Hostname:       "myhost",
+		OrchestratorID: "k8s",
+		WorkloadID:     "pod1",
+		EndpointID:     "eth0",
+	}
+	ep2 = backend.WorkloadEndpointKey{
+		Hostname:       "myhost",
+		OrchestratorID: "k8s",
+		WorkloadID:     "pod2",
+		EndpointID:     "eth0",
+	}
+	hep = backend.HostEndpointKey{Hostname: "myhost", EndpointID: "eth1"}
+)
+
+func policyKey(tier, name string) string {
+	return "/calico/v1/policy/tier/" + tier + "/policy/" + name
+}
+
+func profileLabelsKey(profile string) string {
+	return "/calico/v1/policy/profile/" + profile + "/labels"
+}
+
+func tierKey(tier string) string {
+	return "/calico/v1/policy/tier/" + tier + "/metadata"
+}
+
+var _ = Describe("Resolver", func() {
+	var disp *store.Dispatcher
+	var updates map[backend.KeyInterface][]TierPolicies
+	var numUpdates int
+
+	set := func(key, value string) {
+		disp.DispatchUpdate(&store.Update{Key: key, ValueOrNil: &value})
+	}
+	del := func(key string) {
+		disp.DispatchUpdate(&store.Update{Key: key})
+	}
+
+	BeforeEach(func() {
+		disp = store.NewDispatcher()
+		res := NewResolver("myhost")
+		res.RegisterWith(disp)
+		updates = make(map[backend.KeyInterface][]TierPolicies)
+		numUpdates = 0
+		res.OnEndpointTiersUpdate = func(key backend.KeyInterface, tiers []TierPolicies) {
+			updates[key] = tiers
+			numUpdates++
+		}
+	})
+
+	It("should report local endpoints without any policy", func() {
+		set(ep1Key, `{"labels": {"app": "web"}}`)
+		Expect(updates).To(Equal(map[backend.KeyInterface][]TierPolicies{
+			ep1: {},
+		}))
+	})
+	It("should ignore other hosts' endpoints", func() {
+		set(otherEP, `{"labels": {"app": "web"}}`)
+		set(policyKey("default", "p1"), `{"selector": "app == 'web'"}`)
+		Expect(numUpdates).To(Equal(0))
+	})
+	It("should order tiers and policies by order then name", func() {
+		set(tierKey("t1"), `{"order": 20}`)
+		set(tierKey("t2"), `{"order": 10}`)
+		set(policyKey("t1", "b"), `{"order": 5, "selector": "all()"}`)
+		set(policyKey("t1", "a"), `{"order": 5, "selector": "all()"}`)
+		set(policyKey("t1", "z"), `{"order": 1, "selector": "all()"}`)
+		set(policyKey("t1", "none"), `{"selector": "all()"}`)
+		set(policyKey("t2", "p"), `{"selector": "all()"}`)
+		set(policyKey("no-metadata", "p"), `{"selector": "all()"}`)
+		set(ep1Key, `{}`)
+		Expect(updates[ep1]).To(Equal([]TierPolicies{
+			{Name: "t2", Policies: []string{"p"}},
+			{Name: "t1", Policies: []string{"z", "a", "b", "none"}},
+			{Name: "no-metadata", Policies: []string{"p"}},
+		}))
+	})
+	It("should only include matching policies", func() {
+		set(policyKey("default", "web"), `{"selector": "app == 'web'"}`)
+		set(policyKey("default", "db"), `{"selector": "app == 'db'"}`)
+		set(ep1Key, `{"labels": {"app": "web"}}`)
+		set(ep2Key, `{"labels": {"app": "db"}}`)
+		set(hepKey, `{"labels": {"app": "db"}}`)
+		Expect(updates).To(Equal(map[backend.KeyInterface][]TierPolicies{
+			ep1: {{Name: "default", Policies: []string{"web"}}},
+			ep2: {{Name: "default", Policies: []string{"db"}}},
+			hep: {{Name: "default", Policies: []string{"db"}}},
+		}))
+	})
+
+	It("should match policies on labels inherited from profiles", func() {
+		set(policyKey("default", "web"), `{"selector": "app == 'web'"}`)
+		set(ep1Key, `{"profile_ids": ["prof1"]}`)
+		set(hepKey, `{"profile_ids": ["prof1"], "labels": {"app": "db"}}`)
+		Expect(updates[ep1]).To(Equal([]TierPolicies{}))
+
+		set(profileLabelsKey("prof1"), `{"app": "web"}`)
+		Expect(updates).To(Equal(map[backend.KeyInterface][]TierPolicies{
+			ep1: {{Name: "default", Policies: []string{"web"}}},
+			// The endpoint's own labels take precedence.
+			hep: {},
+		}))
+
+		del(profileLabelsKey("prof1"))
+		Expect(updates[ep1]).To(Equal([]TierPolicies{}))
+	})
+
+	Describe("with an endpoint matching a policy", func() {
+		BeforeEach(func() {
+			set(tierKey("t1"), `{"order": 1}`)
+			set(tierKey("t2"), `{"order": 2}`)
+			set(policyKey("t1", "p1"), `{"order": 1, "selector": "app == 'web'"}`)
+			set(policyKey("t2", "p2"), `{"selector": "all()"}`)
+			set(ep1Key, `{"labels": {"app": "web"}}`)
+			Expect(updates[ep1]).To(Equal([]TierPolicies{
+				{Name: "t1", Policies: []string{"p1"}},
+				{Name: "t2", Policies: []string{"p2"}},
+			}))
+			numUpdates = 0
+		})
+
+		It("should update when the labels change", func() {
+			set(ep1Key, `{"labels": {"app": "db"}}`)
+			Expect(updates[ep1]).To(Equal([]TierPolicies{
+				{Name: "t2", Policies: []string{"p2"}},
+			}))
+		})
+		It("should not report unchanged tiers", func() {
+			set(ep1Key, `{"labels": {"app": "web", "foo": "bar"}}`)
+			set(policyKey("t1", "p1"), `{"order": 1, "selector": "app == 'web'", "inbound_rules": []}`)
+			Expect(numUpdates).To(Equal(0))
+		})
+		It("should update when the selector changes", func() {
+			set(policyKey("t1", "p1"), `{"order": 1, "selector": "app == 'db'"}`)
+			Expect(updates[ep1]).To(Equal([]TierPolicies{
+				{Name: "t2", Policies: []string{"p2"}},
+			}))
+		})
+		It("should apply a policy with a bad selector to every endpoint", func() {
+			set(ep2Key, `{"labels": {"app": "db"}}`)
+			Expect(updates[ep2]).To(Equal([]TierPolicies{
+				{Name: "t2", Policies: []string{"p2"}},
+			}))
+			set(policyKey("t1", "p1"), `{"order": 1, "selector": "app === "}`)
+			Expect(updates[ep2]).To(Equal([]TierPolicies{
+				{Name: "t1", Policies: []string{"p1"}},
+				{Name: "t2", Policies: []string{"p2"}},
+			}))
+			Expect(updates[ep1]).To(Equal([]TierPolicies{
+				{Name: "t1", Policies: []string{"p1"}},
+				{Name: "t2", Policies: []string{"p2"}},
+			}))
+		})
+		It("should update when a tier's order changes", func() {
+			set(tierKey("t1"), `{"order": 3}`)
+			Expect(updates[ep1]).To(Equal([]TierPolicies{
+				{Name: "t2", Policies: []string{"p2"}},
+				{Name: "t1", Policies: []string{"p1"}},
+			}))
+			numUpdates = 0
+			del(tierKey("t2"))
+			Expect(updates[ep1]).To(Equal([]TierPolicies{
+				{Name: "t1", Policies: []string{"p1"}},
+				{Name: "t2", Policies: []string{"p2"}},
+			}))
+			Expect(numUpdates).To(Equal(1))
+		})
+		It("should update when a policy's order changes", func() {
+			set(policyKey("t2", "p3"), `{"order": 2, "selector": "all()"}`)
+			Expect(updates[ep1][1]).To(Equal(
+				TierPolicies{Name: "t2", Policies: []string{"p3", "p2"}}))
+			set(policyKey("t2", "p2"), `{"order": 1, "selector": "all()"}`)
+			Expect(updates[ep1][1]).To(Equal(
+				TierPolicies{Name: "t2", Policies: []string{"p2", "p3"}}))
+		})
+		It("should update when a policy is deleted", func() {
+			del(policyKey("t2", "p2"))
+			Expect(updates[ep1]).To(Equal([]TierPolicies{
+				{Name: "t1", Policies: []string{"p1"}},
+			}))
+		})
+		It("should report nil tiers when the endpoint is deleted", func() {
+			del(ep1Key)
+			Expect(updates).To(HaveKey(ep1))
+			Expect(updates[ep1]).To(BeNil())
+			Expect(numUpdates).To(Equal(1))
+			del(policyKey("t2", "p2"))
+			Expect(numUpdates).To(Equal(1))
+		})
+	})
+
+	Describe("active policies and profiles", func() {
+		var res *Resolver
+		var active map[backend.KeyInterface]bool
+		var events []string
+
+		BeforeEach(func() {
+			disp = store.NewDispatcher()
+			res = NewResolver("myhost")
+			res.RegisterWith(disp)
+			active = make(map[backend.KeyInterface]bool)
+			events = nil
+			res.OnPolicyActive = func(key backend.PolicyKey) {
+				Expect(active[key]).To(BeFalse())
+				active[key] = true
+				events = append(events, "+"+key.Name)
+			}
+			res.OnPolicyInactive = func(key backend.PolicyKey) {
+				Expect(active[key]).To(BeTrue())
+				delete(active, key)
+				events = append(events, "-"+key.Name)
+			}
+			res.OnProfileActive = func(key backend.ProfileKey) {
+				Expect(active[key]).To(BeFalse())
+				active[key] = true
+				events = append(events, "+"+key.Name)
+			}
+			res.OnProfileInactive = func(key backend.ProfileKey) {
+				Expect(active[key]).To(BeTrue())
+				delete(active, key)
+				events = append(events, "-"+key.Name)
+			}
+		})
+
+		It("should activate policies that match local endpoints", func() {
+			set(policyKey("default", "web"), `{"selector": "app == 'web'"}`)
+			set(otherEP, `{"labels": {"app": "web"}}`)
+			Expect(active).To(BeEmpty())
+			set(ep1Key, `{"labels": {"app": "web"}}`)
+			set(ep2Key, `{"labels": {"app": "web"}}`)
+			Expect(events).To(Equal([]string{"+web"}))
+			del(ep1Key)
+			Expect(events).To(Equal([]string{"+web"}))
+			set(ep2Key, `{"labels": {"app": "db"}}`)
+			Expect(events).To(Equal([]string{"+web", "-web"}))
+		})
+		It("should deactivate a deleted policy", func() {
+			set(ep1Key, `{"labels": {"app": "web"}}`)
+			set(policyKey("default", "web"), `{"selector": "app == 'web'"}`)
+			del(policyKey("default", "web"))
+			Expect(events).To(Equal([]string{"+web", "-web"}))
+		})
+		It("should activate profiles used by local endpoints", func() {
+			set(otherEP, `{"profile_ids": ["other"]}`)
+			set(ep1Key, `{"profile_ids": ["prof1", "prof2", "prof1"]}`)
+			set(hepKey, `{"profile_ids": ["prof2"]}`)
+			Expect(active).To(Equal(map[backend.KeyInterface]bool{
+				backend.ProfileKey{Name: "prof1"}: true,
+				backend.ProfileKey{Name: "prof2"}: true,
+			}))
+			set(ep1Key, `{"profile_ids": ["prof2", "prof3"]}`)
+			Expect(events).To(Equal([]string{"+prof1", "+prof2", "+prof3", "-prof1"}))
+			del(ep1Key)
+			Expect(events[4:]).To(Equal([]string{"-prof3"}))
+			del(hepKey)
+			Expect(events[5:]).To(Equal([]string{"-prof2"}))
+			Expect(active).To(BeEmpty())
+		})
+	})
+})
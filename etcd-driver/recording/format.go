@@ -0,0 +1,77 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package recording records the stream of callbacks from a datastore driver to
+// a file and replays it later, without a datastore.
+//
+// A recording is a sequence of JSON objects, one per line, each recording a
+// single callback:
+//
+//	{"time": "...", "type": "config_loaded", "global": {...}, "host": {...}}
+//	{"time": "...", "type": "config_changed", "global": {...}, "host": {...}}
+//	{"time": "...", "type": "status", "status": "in-sync"}
+//	{"time": "...", "type": "updates", "updates": [{"k": "/calico/...", "v": "..."}]}
+//
+// A deletion is recorded as an update with a null value.
+package recording
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+)
+
+const (
+	entryTypeConfigLoaded  = "config_loaded"
+	entryTypeConfigChanged = "config_changed"
+	entryTypeStatus        = "status"
+	entryTypeUpdates       = "updates"
+)
+
+type entry struct {
+	Time    time.Time         `json:"time"`
+	Type    string            `json:"type"`
+	Global  map[string]string `json:"global,omitempty"`
+	Host    map[string]string `json:"host,omitempty"`
+	Status  string            `json:"status,omitempty"`
+	Updates []update          `json:"updates,omitempty"`
+}
+
+type update struct {
+	Key   string  `json:"k"`
+	Value *string `json:"v"`
+}
+
+var statusesByName = map[string]store.DriverStatus{}
+
+func init() {
+	for _, status := range []store.DriverStatus{
+		store.WaitForDatastore,
+		store.ResyncInProgress,
+		store.InSync,
+	} {
+		statusesByName[status.String()] = status
+	}
+}
+
+// Error indicating that a recording couldn't be parsed.
+type ErrorBadRecording struct {
+	Line   int
+	Reason string
+}
+
+func (e ErrorBadRecording) Error() string {
+	return fmt.Sprintf("bad recording at line %d: %s", e.Line, e.Reason)
+}
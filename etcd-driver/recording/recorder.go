@@ -0,0 +1,99 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recording
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/op/go-logging"
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+)
+
+var log = logging.MustGetLogger("recording")
+
+// Recorder is a store.Callbacks that writes each callback to a recording
+// before passing it on to the wrapped Callbacks.
+type Recorder struct {
+	next store.Callbacks
+
+	// lock serialises writes, the driver may call us from several
+	// threads.
+	lock    sync.Mutex
+	encoder *json.Encoder
+	failed  bool
+}
+
+func NewRecorder(w io.Writer, next store.Callbacks) *Recorder {
+	return &Recorder{
+		next:    next,
+		encoder: json.NewEncoder(w),
+	}
+}
+
+func (rec *Recorder) OnConfigLoaded(globalConfig map[string]string, hostConfig map[string]string) {
+	rec.record(entry{
+		Type:   entryTypeConfigLoaded,
+		Global: globalConfig,
+		Host:   hostConfig,
+	})
+	rec.next.OnConfigLoaded(globalConfig, hostConfig)
+}
+
+func (rec *Recorder) OnConfigChanged(globalConfig map[string]string, hostConfig map[string]string) {
+	rec.record(entry{
+		Type:   entryTypeConfigChanged,
+		Global: globalConfig,
+		Host:   hostConfig,
+	})
+	rec.next.OnConfigChanged(globalConfig, hostConfig)
+}
+
+func (rec *Recorder) OnStatusUpdated(status store.DriverStatus) {
+	rec.record(entry{
+		Type:   entryTypeStatus,
+		Status: status.String(),
+	})
+	rec.next.OnStatusUpdated(status)
+}
+
+func (rec *Recorder) OnKeysUpdated(updates []store.Update) {
+	e := entry{
+		Type:    entryTypeUpdates,
+		Updates: make([]update, len(updates)),
+	}
+	for i, u := range updates {
+		e.Updates[i] = update{Key: u.Key, Value: u.ValueOrNil}
+	}
+	rec.record(e)
+	rec.next.OnKeysUpdated(updates)
+}
+
+func (rec *Recorder) record(e entry) {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	if rec.failed {
+		return
+	}
+	e.Time = time.Now()
+	if err := rec.encoder.Encode(e); err != nil {
+		// Carry on without recording rather than taking down the
+		// driver.
+		log.Errorf("Failed to write to recording, recording stopped: %v", err)
+		rec.failed = true
+	}
+}
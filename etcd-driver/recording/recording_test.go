@@ -0,0 +1,142 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recording_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	. "github.com/projectcalico/calico-go/etcd-driver/recording"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+)
+
+// call records a single callback.
+type call struct {
+	Method  string
+	Global  map[string]string
+	Host    map[string]string
+	Status  store.DriverStatus
+	Updates []store.Update
+}
+
+type capturingCallbacks struct {
+	lock  sync.Mutex
+	calls []call
+}
+
+func (cbs *capturingCallbacks) add(c call) {
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+	cbs.calls = append(cbs.calls, c)
+}
+
+func (cbs *capturingCallbacks) getCalls() []call {
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+	return append([]call(nil), cbs.calls...)
+}
+
+func (cbs *capturingCallbacks) OnConfigLoaded(global, host map[string]string) {
+	cbs.add(call{Method: "OnConfigLoaded", Global: global, Host: host})
+}
+
+func (cbs *capturingCallbacks) OnConfigChanged(global, host map[string]string) {
+	cbs.add(call{Method: "OnConfigChanged", Global: global, Host: host})
+}
+
+func (cbs *capturingCallbacks) OnStatusUpdated(status store.DriverStatus) {
+	cbs.add(call{Method: "OnStatusUpdated", Status: status})
+}
+
+func (cbs *capturingCallbacks) OnKeysUpdated(updates []store.Update) {
+	cbs.add(call{Method: "OnKeysUpdated", Updates: updates})
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+// driveCallbacks makes a typical sequence of calls.
+func driveCallbacks(cbs store.Callbacks) {
+	cbs.OnConfigLoaded(map[string]string{"InterfacePrefix": "cali"},
+		map[string]string{})
+	cbs.OnStatusUpdated(store.WaitForDatastore)
+	cbs.OnStatusUpdated(store.ResyncInProgress)
+	cbs.OnKeysUpdated([]store.Update{
+		{Key: "/calico/v1/policy/tier/default/policy/pol1", ValueOrNil: strPtr(`{"order": 10}`)},
+		{Key: "/calico/v1/config/LogSeverityScreen", ValueOrNil: strPtr("info")},
+	})
+	cbs.OnKeysUpdated([]store.Update{
+		{Key: "/calico/v1/policy/tier/default/policy/pol1"},
+	})
+	cbs.OnStatusUpdated(store.InSync)
+	cbs.OnConfigChanged(map[string]string{"InterfacePrefix": "tap"},
+		map[string]string{"LogSeverityScreen": "debug"})
+}
+
+var _ = Describe("Recording", func() {
+	var expected *capturingCallbacks
+	var buf *bytes.Buffer
+
+	BeforeEach(func() {
+		expected = &capturingCallbacks{}
+		buf = &bytes.Buffer{}
+		driveCallbacks(NewRecorder(buf, expected))
+	})
+
+	It("should pass calls through", func() {
+		Expect(expected.getCalls()).To(HaveLen(7))
+	})
+	It("should write one line per call", func() {
+		Expect(strings.Count(buf.String(), "\n")).To(Equal(7))
+	})
+	It("should round-trip through Replay", func() {
+		replayed := &capturingCallbacks{}
+		Expect(Replay(buf, replayed)).To(Succeed())
+		Expect(replayed.getCalls()).To(Equal(expected.getCalls()))
+	})
+	It("should round-trip through the replay driver", func() {
+		f, err := ioutil.TempFile("", "recording")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.Remove(f.Name())
+		_, err = f.Write(buf.Bytes())
+		Expect(err).NotTo(HaveOccurred())
+		f.Close()
+
+		newDriver, err := store.Lookup("replay")
+		Expect(err).NotTo(HaveOccurred())
+		replayed := &capturingCallbacks{}
+		driver, err := newDriver(replayed, &store.DriverConfiguration{
+			ReplayFile: f.Name(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		driver.Start()
+		Eventually(replayed.getCalls).Should(Equal(expected.getCalls()))
+	})
+	It("should reject a bad recording", func() {
+		err := Replay(strings.NewReader("{\"type\": \"status\", \"status\": \"foo\"}\n"),
+			&capturingCallbacks{})
+		Expect(err).To(Equal(ErrorBadRecording{
+			Line:   1,
+			Reason: `unknown status "foo"`,
+		}))
+	})
+})
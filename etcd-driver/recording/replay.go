@@ -0,0 +1,123 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/projectcalico/calico-go/etcd-driver/store"
+)
+
+// maxLineLength bounds the length of a single recorded callback; a snapshot
+// can produce large batches of updates.
+const maxLineLength = 64 * 1024 * 1024
+
+func init() {
+	store.Register("replay", NewReplayDriver)
+}
+
+// NewReplayDriver creates a driver that replays the recording in the configured
+// ReplayFile, as fast as possible, instead of connecting to a datastore.
+func NewReplayDriver(callbacks store.Callbacks, config *store.DriverConfiguration) (store.Driver, error) {
+	if config.ReplayFile == "" {
+		return nil, errors.New("no recording configured for the replay driver")
+	}
+	file, err := os.Open(config.ReplayFile)
+	if err != nil {
+		return nil, err
+	}
+	return &replayDriver{
+		callbacks: callbacks,
+		file:      file,
+	}, nil
+}
+
+type replayDriver struct {
+	callbacks store.Callbacks
+	file      *os.File
+}
+
+func (driver *replayDriver) Start() {
+	go func() {
+		defer driver.file.Close()
+		log.Infof("Replaying %v", driver.file.Name())
+		if err := Replay(driver.file, driver.callbacks); err != nil {
+			log.Errorf("Replay failed: %v", err)
+			return
+		}
+		log.Info("Replay finished")
+	}()
+}
+
+// ForceResync is not supported: a recording can only be replayed once.
+func (driver *replayDriver) ForceResync() {
+	log.Warning("Ignoring request to resync, not supported when replaying")
+}
+
+// Replay reads a recording and makes the recorded calls to the callbacks.
+func Replay(r io.Reader, callbacks store.Callbacks) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return ErrorBadRecording{Line: lineNum, Reason: err.Error()}
+		}
+		switch e.Type {
+		case entryTypeConfigLoaded:
+			callbacks.OnConfigLoaded(nonNilMap(e.Global), nonNilMap(e.Host))
+		case entryTypeConfigChanged:
+			callbacks.OnConfigChanged(nonNilMap(e.Global), nonNilMap(e.Host))
+		case entryTypeStatus:
+			status, ok := statusesByName[e.Status]
+			if !ok {
+				return ErrorBadRecording{
+					Line:   lineNum,
+					Reason: fmt.Sprintf("unknown status %#v", e.Status),
+				}
+			}
+			callbacks.OnStatusUpdated(status)
+		case entryTypeUpdates:
+			updates := make([]store.Update, len(e.Updates))
+			for i, u := range e.Updates {
+				updates[i] = store.Update{Key: u.Key, ValueOrNil: u.Value}
+			}
+			callbacks.OnKeysUpdated(updates)
+		default:
+			return ErrorBadRecording{
+				Line:   lineNum,
+				Reason: fmt.Sprintf("unknown entry type %#v", e.Type),
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+func nonNilMap(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
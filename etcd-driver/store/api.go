@@ -14,6 +14,12 @@
 
 package store
 
+import (
+	"time"
+
+	"github.com/projectcalico/calico-go/lib/api"
+)
+
 type DriverStatus uint8
 
 const (
@@ -22,12 +28,112 @@ const (
 	InSync
 )
 
+// String returns the name of the status.  The same names are used in the
+// Felix protocol, in the host status that the driver reports to the datastore
+// and in recordings.
+func (status DriverStatus) String() string {
+	switch status {
+	case WaitForDatastore:
+		return "wait-for-ready"
+	case ResyncInProgress:
+		return "resync"
+	case InSync:
+		return "in-sync"
+	}
+	return "unknown"
+}
+
 type DriverConfiguration struct {
+	// ClientConfig holds the datastore connection settings: endpoints,
+	// TLS files and credentials.
+	api.ClientConfig
+
+	// FelixHostname is the hostname of the local Felix, used to load the
+	// per-host config.
+	FelixHostname string
+
+	// FileDriverRoot is the directory that the file driver loads keys
+	// from.
+	FileDriverRoot string
+
+	// ReplayFile is the recording that the replay driver replays.
+	ReplayFile string
+
+	// SnapshotPageSize is the number of hosts that the etcd driver loads
+	// in parallel when reading a snapshot.  Zero means use the default.
+	SnapshotPageSize int
+
+	// StateFile is where the etcd driver saves its state so that it can
+	// resume watching etcd after a restart instead of reading a full
+	// snapshot.  Empty to disable.
+	StateFile string
+
+	// StatusReportInterval is how often the driver reports Felix's status
+	// to the datastore, zero to disable status reports.  Reports expire
+	// after StatusTTL, so a host's status disappears if it stops
+	// reporting.
+	StatusReportInterval time.Duration
+	StatusTTL            time.Duration
+
+	// Version is the version of the driver, included in status reports.
+	Version string
+
+	// EndpointStatusRateLimit is the maximum number of endpoint status
+	// updates per second that the driver writes to the datastore, zero
+	// to disable endpoint status reporting.
+	EndpointStatusRateLimit int
+	// EndpointStatusCleanupDelay is how long the driver waits after it
+	// comes into sync before deleting any endpoint statuses that Felix
+	// hasn't reported.  Zero means use the default.
+	EndpointStatusCleanupDelay time.Duration
 }
 
 type Driver interface {
 	Start()
-	// ForceResync()
+	// ForceResync asks the driver to re-read the datastore and resend
+	// its contents, deleting any keys that have disappeared.  Used to
+	// repair suspected drift.  Returns immediately; the resync happens in
+	// the background.
+	ForceResync()
+}
+
+// DriverStats holds the statistics reported by drivers that implement
+// StatsReporter.
+type DriverStats struct {
+	// SnapshotIndex is the datastore index of the most recent snapshot,
+	// if the datastore has such a concept.
+	SnapshotIndex uint64
+	// QueueDepths maps from the name of each of the driver's internal
+	// queues to the number of items queued.
+	QueueDepths map[string]int
+}
+
+// StatsReporter is implemented by drivers that can report statistics.
+type StatsReporter interface {
+	Stats() DriverStats
+}
+
+// EndpointID identifies a workload or host endpoint on Felix's host.  For a
+// host endpoint, OrchestratorID and WorkloadID are empty.
+type EndpointID struct {
+	OrchestratorID string
+	WorkloadID     string
+	EndpointID     string
+}
+
+func (id EndpointID) IsHostEndpoint() bool {
+	return id.WorkloadID == ""
+}
+
+// EndpointStatusReporter is implemented by drivers that can write the status
+// of Felix's endpoints back to the datastore.
+type EndpointStatusReporter interface {
+	// ReportEndpointStatus records the status of an endpoint, for
+	// example, "up" once Felix has programmed its policy.  A nil status
+	// means that Felix no longer has the endpoint and its status should
+	// be removed.  Returns immediately; the datastore is updated in the
+	// background.
+	ReportEndpointStatus(id EndpointID, statusOrNil *string)
 }
 
 type Update struct {
@@ -37,12 +143,12 @@ type Update struct {
 
 type Callbacks interface {
 	OnConfigLoaded(globalConfig map[string]string, hostConfig map[string]string)
+	// OnConfigChanged is called if the global or per-host config changes
+	// after OnConfigLoaded has been called.  Felix needs to restart to pick
+	// up the new config.
+	OnConfigChanged(globalConfig map[string]string, hostConfig map[string]string)
 	OnStatusUpdated(status DriverStatus)
 	OnKeysUpdated(updates []Update)
 }
 
 type DriverConstructor func(callbacks Callbacks, config *DriverConfiguration) (Driver, error)
-
-func Register(name string, constructor DriverConstructor) {
-	// TODO Implement driver registration
-}
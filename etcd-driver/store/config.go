@@ -0,0 +1,87 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"strings"
+
+	"github.com/projectcalico/calico-go/lib/backend"
+)
+
+// FelixConfig tracks the config that was passed to OnConfigLoaded so that a
+// driver can spot changes that require Felix to restart.
+type FelixConfig struct {
+	hostname string
+	global   map[string]string
+	host     map[string]string
+}
+
+func NewFelixConfig(hostname string, global, host map[string]string) *FelixConfig {
+	if global == nil {
+		global = make(map[string]string)
+	}
+	if host == nil {
+		host = make(map[string]string)
+	}
+	return &FelixConfig{
+		hostname: hostname,
+		global:   global,
+		host:     host,
+	}
+}
+
+// OnUpdate applies an update to the tracked config.  Returns true if the update
+// was for one of our config keys and it changed the config.
+func (config *FelixConfig) OnUpdate(update Update) bool {
+	if !strings.Contains(update.Key, "/config/") {
+		// Fast path: not a config key.
+		return false
+	}
+	var values map[string]string
+	var name string
+	switch key := backend.ParseKey(update.Key).(type) {
+	case backend.GlobalConfigKey:
+		values, name = config.global, key.Name
+	case backend.HostConfigKey:
+		if key.Hostname != config.hostname {
+			return false
+		}
+		values, name = config.host, key.Name
+	default:
+		return false
+	}
+
+	oldValue, present := values[name]
+	if update.ValueOrNil == nil {
+		delete(values, name)
+		return present
+	}
+	values[name] = *update.ValueOrNil
+	return !present || oldValue != *update.ValueOrNil
+}
+
+// CopyMaps returns copies of the global and per-host config, suitable for
+// passing to the callbacks.
+func (config *FelixConfig) CopyMaps() (global, host map[string]string) {
+	return copyMap(config.global), copyMap(config.host)
+}
+
+func copyMap(m map[string]string) map[string]string {
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store_test
+
+import (
+	. "github.com/projectcalico/calico-go/etcd-driver/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func set(key, value string) Update {
+	return Update{Key: key, ValueOrNil: &value}
+}
+
+func del(key string) Update {
+	return Update{Key: key}
+}
+
+var _ = Describe("FelixConfig", func() {
+	var config *FelixConfig
+
+	BeforeEach(func() {
+		config = NewFelixConfig("myhost",
+			map[string]string{"LogSeverityScreen": "info"},
+			map[string]string{"InterfacePrefix": "tap"})
+	})
+
+	expectConfig := func(global, host map[string]string) {
+		actualGlobal, actualHost := config.CopyMaps()
+		Expect(actualGlobal).To(Equal(global))
+		Expect(actualHost).To(Equal(host))
+	}
+
+	It("should report a new global parameter", func() {
+		Expect(config.OnUpdate(set("/calico/v1/config/MetadataPort", "8775"))).To(BeTrue())
+		expectConfig(
+			map[string]string{"LogSeverityScreen": "info", "MetadataPort": "8775"},
+			map[string]string{"InterfacePrefix": "tap"})
+	})
+	It("should report a changed global parameter", func() {
+		Expect(config.OnUpdate(set("/calico/v1/config/LogSeverityScreen", "debug"))).To(BeTrue())
+		expectConfig(
+			map[string]string{"LogSeverityScreen": "debug"},
+			map[string]string{"InterfacePrefix": "tap"})
+	})
+	It("should report a changed parameter for our host", func() {
+		Expect(config.OnUpdate(set("/calico/v1/host/myhost/config/InterfacePrefix", "cali"))).To(BeTrue())
+		expectConfig(
+			map[string]string{"LogSeverityScreen": "info"},
+			map[string]string{"InterfacePrefix": "cali"})
+	})
+	It("should not report a parameter rewritten with the same value", func() {
+		Expect(config.OnUpdate(set("/calico/v1/config/LogSeverityScreen", "info"))).To(BeFalse())
+		Expect(config.OnUpdate(set("/calico/v1/host/myhost/config/InterfacePrefix", "tap"))).To(BeFalse())
+	})
+	It("should report a deleted parameter", func() {
+		Expect(config.OnUpdate(del("/calico/v1/config/LogSeverityScreen"))).To(BeTrue())
+		Expect(config.OnUpdate(del("/calico/v1/host/myhost/config/InterfacePrefix"))).To(BeTrue())
+		expectConfig(map[string]string{}, map[string]string{})
+	})
+	It("should not report the deletion of a parameter that isn't set", func() {
+		Expect(config.OnUpdate(del("/calico/v1/config/MetadataPort"))).To(BeFalse())
+	})
+	It("should ignore another host's config", func() {
+		Expect(config.OnUpdate(set("/calico/v1/host/otherhost/config/InterfacePrefix", "cali"))).To(BeFalse())
+		Expect(config.OnUpdate(del("/calico/v1/host/otherhost/config/InterfacePrefix"))).To(BeFalse())
+		expectConfig(
+			map[string]string{"LogSeverityScreen": "info"},
+			map[string]string{"InterfacePrefix": "tap"})
+	})
+	It("should ignore keys that aren't config", func() {
+		Expect(config.OnUpdate(set("/calico/v1/policy/profile/config/rules", "{}"))).To(BeFalse())
+		Expect(config.OnUpdate(set("/calico/v1/host/myhost/endpoint/config", "{}"))).To(BeFalse())
+	})
+	It("should return copies of the config", func() {
+		global, host := config.CopyMaps()
+		global["LogSeverityScreen"] = "debug"
+		host["InterfacePrefix"] = "cali"
+		expectConfig(
+			map[string]string{"LogSeverityScreen": "info"},
+			map[string]string{"InterfacePrefix": "tap"})
+	})
+})
@@ -0,0 +1,65 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// constructorsByName holds the registered drivers.  Drivers register
+// themselves from their init() functions so it is only written to before
+// main() starts.
+var constructorsByName = make(map[string]DriverConstructor)
+
+// Register makes a driver available under the given name.
+func Register(name string, constructor DriverConstructor) {
+	if _, ok := constructorsByName[name]; ok {
+		panic(fmt.Sprintf("Driver %#v registered twice", name))
+	}
+	log.Infof("Registering datastore driver %#v", name)
+	constructorsByName[name] = constructor
+}
+
+// Lookup returns the constructor for the named driver.
+func Lookup(name string) (DriverConstructor, error) {
+	constructor, ok := constructorsByName[name]
+	if !ok {
+		return nil, ErrorUnknownDriver{Name: name, Known: RegisteredDrivers()}
+	}
+	return constructor, nil
+}
+
+// RegisteredDrivers returns the sorted names of the registered drivers.
+func RegisteredDrivers() []string {
+	names := make([]string, 0, len(constructorsByName))
+	for name := range constructorsByName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Error indicating that there is no driver registered with the given name.
+type ErrorUnknownDriver struct {
+	Name  string
+	Known []string
+}
+
+func (e ErrorUnknownDriver) Error() string {
+	return fmt.Sprintf("unknown datastore driver '%s' (available drivers: %s)",
+		e.Name, strings.Join(e.Known, ", "))
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	. "github.com/projectcalico/calico-go/lib/api/unversioned"
+)
+
+// FelixConfigurationMetadata identifies a single Felix configuration parameter.
+// If the Hostname is blank the parameter applies to all hosts, otherwise it
+// applies to (and overrides the global value for) the specified host only.
+type FelixConfigurationMetadata struct {
+	ObjectMetadata
+	Hostname string `json:"hostname,omitempty" validate:"omitempty,hostname"`
+}
+
+type FelixConfigurationSpec struct {
+	Value string `json:"value"`
+}
+
+type FelixConfiguration struct {
+	TypeMetadata
+	Metadata FelixConfigurationMetadata `json:"metadata,omitempty"`
+	Spec     FelixConfigurationSpec     `json:"spec,omitempty"`
+}
+
+func NewFelixConfiguration() *FelixConfiguration {
+	return &FelixConfiguration{TypeMetadata: TypeMetadata{Kind: "felixConfiguration", APIVersion: "v1"}}
+}
+
+type FelixConfigurationList struct {
+	TypeMetadata
+	Metadata ListMetadata         `json:"metadata,omitempty"`
+	Items    []FelixConfiguration `json:"items" validate:"dive"`
+}
+
+func NewFelixConfigurationList() *FelixConfigurationList {
+	return &FelixConfigurationList{TypeMetadata: TypeMetadata{Kind: "felixConfigurationList", APIVersion: "v1"}}
+}
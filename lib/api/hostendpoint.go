@@ -31,10 +31,22 @@ type HostEndpointSpec struct {
 	Profiles      []string `json:"profiles,omitempty" validate:"omitempty,dive,name"`
 }
 
+// EndpointStatus is the status of an endpoint, as reported by the Felix on the
+// endpoint's host.  It is read-only.
+type EndpointStatus struct {
+	// Status is "up" once Felix has programmed the endpoint's policy,
+	// "down" if the endpoint's interface is down or "error" if Felix
+	// failed to program the endpoint.
+	Status string `json:"status"`
+}
+
 type HostEndpoint struct {
 	TypeMetadata
 	Metadata HostEndpointMetadata `json:"metadata,omitempty"`
 	Spec     HostEndpointSpec     `json:"spec,omitempty"`
+	// Status is filled in when the host endpoint is read, if Felix has
+	// reported it.  It's ignored when writing.
+	Status *EndpointStatus `json:"status,omitempty"`
 }
 
 func NewHostEndpoint() *HostEndpoint {
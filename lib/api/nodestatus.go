@@ -0,0 +1,59 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	. "github.com/projectcalico/calico-go/lib/api/unversioned"
+)
+
+type NodeStatusMetadata struct {
+	Hostname string `json:"hostname,omitempty" validate:"omitempty,hostname"`
+}
+
+type NodeStatusSpec struct {
+	LastReported string `json:"lastReported"`
+	Uptime       string `json:"uptime"`
+	Version      string `json:"version"`
+	// SyncStatus is the status of Felix's datastore driver: one of
+	// "wait-for-ready" (waiting to connect to the datastore), "resync"
+	// (reading a snapshot of the datastore) or "in-sync".  These are the
+	// same names that the driver uses to report its status to Felix.
+	SyncStatus string `json:"syncStatus"`
+	// InSync is true if SyncStatus is "in-sync".
+	InSync bool `json:"inSync"`
+}
+
+// NodeStatus is the status most recently reported by the Felix on a host.  It
+// is read-only; a host only has a NodeStatus while its Felix is alive and
+// reporting.
+type NodeStatus struct {
+	TypeMetadata
+	Metadata NodeStatusMetadata `json:"metadata,omitempty"`
+	Spec     NodeStatusSpec     `json:"spec,omitempty"`
+}
+
+func NewNodeStatus() *NodeStatus {
+	return &NodeStatus{TypeMetadata: TypeMetadata{Kind: "nodeStatus", APIVersion: "v1"}}
+}
+
+type NodeStatusList struct {
+	TypeMetadata
+	Metadata ListMetadata `json:"metadata,omitempty"`
+	Items    []NodeStatus `json:"items" validate:"dive"`
+}
+
+func NewNodeStatusList() *NodeStatusList {
+	return &NodeStatusList{TypeMetadata: TypeMetadata{Kind: "nodeStatusList", APIVersion: "v1"}}
+}
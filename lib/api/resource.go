@@ -57,6 +57,8 @@ func init() {
 	registerHelper(NewPolicy(), NewPolicyList())
 	registerHelper(NewProfile(), NewProfileList())
 	registerHelper(NewHostEndpoint(), NewHostEndpointList())
+	registerHelper(NewFelixConfiguration(), NewFelixConfigurationList())
+	registerHelper(NewNodeStatus(), NewNodeStatusList())
 }
 
 // ResourceHelper encapsulates details about a specific version of a specific resource:
@@ -0,0 +1,50 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	. "github.com/projectcalico/calico-go/lib/api/unversioned"
+)
+
+type WorkloadEndpointStatusMetadata struct {
+	// Name is the ID of the endpoint.
+	Name           string `json:"name,omitempty" validate:"omitempty,name"`
+	Hostname       string `json:"hostname,omitempty" validate:"omitempty,hostname"`
+	OrchestratorID string `json:"orchestratorID,omitempty" validate:"omitempty,name"`
+	WorkloadID     string `json:"workloadID,omitempty" validate:"omitempty,name"`
+}
+
+// WorkloadEndpointStatus is the status most recently reported by the Felix on
+// a workload endpoint's host.  It is read-only; Felix removes the status when
+// it removes the endpoint.
+type WorkloadEndpointStatus struct {
+	TypeMetadata
+	Metadata WorkloadEndpointStatusMetadata `json:"metadata,omitempty"`
+	Spec     EndpointStatus                 `json:"spec,omitempty"`
+}
+
+func NewWorkloadEndpointStatus() *WorkloadEndpointStatus {
+	return &WorkloadEndpointStatus{TypeMetadata: TypeMetadata{Kind: "workloadEndpointStatus", APIVersion: "v1"}}
+}
+
+type WorkloadEndpointStatusList struct {
+	TypeMetadata
+	Metadata ListMetadata             `json:"metadata,omitempty"`
+	Items    []WorkloadEndpointStatus `json:"items" validate:"dive"`
+}
+
+func NewWorkloadEndpointStatusList() *WorkloadEndpointStatusList {
+	return &WorkloadEndpointStatusList{TypeMetadata: TypeMetadata{Kind: "workloadEndpointStatusList", APIVersion: "v1"}}
+}
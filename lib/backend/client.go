@@ -73,58 +73,75 @@ func NewClient(config *api.ClientConfig) (*Client, error) {
 	return &c, c.connectEtcd()
 }
 
+// NewClientWithKeysAPI creates a backend datastore client that uses the given
+// etcd KeysAPI rather than connecting to etcd itself.
+func NewClientWithKeysAPI(config *api.ClientConfig, keysAPI etcd.KeysAPI) *Client {
+	return &Client{config: config, connected: true, etcdKeysAPI: keysAPI}
+}
+
 // Connect the client to the etcd datastore specified in the config.
 func (c *Client) connectEtcd() error {
 	if c.connected {
 		panic("Client is already connected")
 	}
 
+	client, err := NewEtcdClient(c.config, clientTimeout)
+	if err != nil {
+		return err
+	}
+	keys := etcd.NewKeysAPI(client)
+	c.etcdClient = client
+	c.etcdKeysAPI = keys
+	c.connected = true
+	return nil
+}
+
+// NewEtcdClient creates an etcd client using the connection details (endpoints,
+// TLS files and credentials) in the config.  The timeout is used when dialling and
+// as the per-request header timeout.
+func NewEtcdClient(config *api.ClientConfig, timeout time.Duration) (etcd.Client, error) {
 	// Determine the location from the authority or the endpoints.  The endpoints
 	// takes precedence if both are specified.
 	etcdLocation := []string{}
-	if c.config.EtcdAuthority != "" {
-		etcdLocation = []string{"http://" + c.config.EtcdAuthority}
+	if config.EtcdAuthority != "" {
+		scheme := config.EtcdScheme
+		if scheme == "" {
+			scheme = "http"
+		}
+		etcdLocation = []string{scheme + "://" + config.EtcdAuthority}
 	}
-	if c.config.EtcdEndpoints != "" {
-		etcdLocation = strings.Split(c.config.EtcdEndpoints, ",")
+	if config.EtcdEndpoints != "" {
+		etcdLocation = strings.Split(config.EtcdEndpoints, ",")
 	}
 
 	if len(etcdLocation) == 0 {
-		return errors.New("no etcd authority or endpoints specified")
+		return nil, errors.New("no etcd authority or endpoints specified")
 	}
 
 	// Create the etcd client
 	tls := transport.TLSInfo{
-		CAFile:   c.config.EtcdCACertFile,
-		CertFile: c.config.EtcdCertFile,
-		KeyFile:  c.config.EtcdKeyFile,
+		CAFile:   config.EtcdCACertFile,
+		CertFile: config.EtcdCertFile,
+		KeyFile:  config.EtcdKeyFile,
 	}
-	transport, err := transport.NewTransport(tls, clientTimeout)
+	transport, err := transport.NewTransport(tls, timeout)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	cfg := etcd.Config{
 		Endpoints:               etcdLocation,
 		Transport:               transport,
-		HeaderTimeoutPerRequest: clientTimeout,
+		HeaderTimeoutPerRequest: timeout,
 	}
 
 	// Plumb through the username and password if both are configured.
-	if c.config.EtcdUsername != "" && c.config.EtcdPassword != "" {
-		cfg.Username = c.config.EtcdUsername
-		cfg.Password = c.config.EtcdPassword
+	if config.EtcdUsername != "" && config.EtcdPassword != "" {
+		cfg.Username = config.EtcdUsername
+		cfg.Password = config.EtcdPassword
 	}
 
-	client, err := etcd.New(cfg)
-	if err != nil {
-		return err
-	}
-	keys := etcd.NewKeysAPI(client)
-	c.etcdClient = client
-	c.etcdKeysAPI = keys
-	c.connected = true
-	return nil
+	return etcd.New(cfg)
 }
 
 // Create an entry in the datastore.  This errors if the entry already exists.
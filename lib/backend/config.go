@@ -0,0 +1,143 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/golang/glog"
+	"github.com/projectcalico/calico-go/lib/common"
+	"reflect"
+)
+
+var (
+	matchGlobalConfig = regexp.MustCompile("^/?calico/v1/config/([^/]+)$")
+	matchHostConfig   = regexp.MustCompile("^/?calico/v1/host/([^/]+)/config/([^/]+)$")
+	typeConfigValue   = reflect.TypeOf("")
+)
+
+// GlobalConfigKey is the key for a Felix configuration parameter that applies
+// to all hosts.  Unlike most other values in the datastore, config values are
+// stored as raw strings rather than JSON.
+type GlobalConfigKey struct {
+	Name string `json:"-" validate:"required,name"`
+}
+
+func (key GlobalConfigKey) asEtcdKey() (string, error) {
+	if key.Name == "" {
+		return "", common.ErrorInsufficientIdentifiers{}
+	}
+	e := fmt.Sprintf("/calico/v1/config/%s", key.Name)
+	return e, nil
+}
+
+func (key GlobalConfigKey) asEtcdDeleteKey() (string, error) {
+	return key.asEtcdKey()
+}
+
+func (key GlobalConfigKey) valueType() reflect.Type {
+	return typeConfigValue
+}
+
+type GlobalConfigListOptions struct {
+	Name string
+}
+
+func (options GlobalConfigListOptions) asEtcdKeyRoot() string {
+	k := "/calico/v1/config"
+	if options.Name == "" {
+		return k
+	}
+	k = k + fmt.Sprintf("/%s", options.Name)
+	return k
+}
+
+func (options GlobalConfigListOptions) keyFromEtcdResult(ekey string) KeyInterface {
+	glog.V(2).Infof("Get GlobalConfig key from %s", ekey)
+	r := matchGlobalConfig.FindAllStringSubmatch(ekey, -1)
+	if len(r) != 1 {
+		glog.V(2).Infof("Didn't match regex")
+		return nil
+	}
+	name := r[0][1]
+	if options.Name != "" && name != options.Name {
+		glog.V(2).Infof("Didn't match name %s != %s", options.Name, name)
+		return nil
+	}
+	return GlobalConfigKey{Name: name}
+}
+
+// HostConfigKey is the key for a Felix configuration parameter that applies
+// to a single host.  Per-host config overrides the global config.
+type HostConfigKey struct {
+	Hostname string `json:"-" validate:"required,hostname"`
+	Name     string `json:"-" validate:"required,name"`
+}
+
+func (key HostConfigKey) asEtcdKey() (string, error) {
+	if key.Hostname == "" || key.Name == "" {
+		return "", common.ErrorInsufficientIdentifiers{}
+	}
+	e := fmt.Sprintf("/calico/v1/host/%s/config/%s",
+		key.Hostname, key.Name)
+	return e, nil
+}
+
+func (key HostConfigKey) asEtcdDeleteKey() (string, error) {
+	return key.asEtcdKey()
+}
+
+func (key HostConfigKey) valueType() reflect.Type {
+	return typeConfigValue
+}
+
+type HostConfigListOptions struct {
+	Hostname string
+	Name     string
+}
+
+func (options HostConfigListOptions) asEtcdKeyRoot() string {
+	k := "/calico/v1/host"
+	if options.Hostname == "" {
+		return k
+	}
+	k = k + fmt.Sprintf("/%s/config", options.Hostname)
+	if options.Name == "" {
+		return k
+	}
+	k = k + fmt.Sprintf("/%s", options.Name)
+	return k
+}
+
+func (options HostConfigListOptions) keyFromEtcdResult(ekey string) KeyInterface {
+	glog.V(2).Infof("Get HostConfig key from %s", ekey)
+	r := matchHostConfig.FindAllStringSubmatch(ekey, -1)
+	if len(r) != 1 {
+		glog.V(2).Infof("Didn't match regex")
+		return nil
+	}
+	hostname := r[0][1]
+	name := r[0][2]
+	if options.Hostname != "" && hostname != options.Hostname {
+		glog.V(2).Infof("Didn't match hostname %s != %s", options.Hostname, hostname)
+		return nil
+	}
+	if options.Name != "" && name != options.Name {
+		glog.V(2).Infof("Didn't match name %s != %s", options.Name, name)
+		return nil
+	}
+	return HostConfigKey{Hostname: hostname, Name: name}
+}
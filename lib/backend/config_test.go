@@ -0,0 +1,45 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend_test
+
+import (
+	. "github.com/projectcalico/calico-go/lib/backend"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config keys", func() {
+	It("should parse global config keys", func() {
+		Expect(ParseKey("/calico/v1/config/LogSeverityScreen")).To(Equal(
+			GlobalConfigKey{Name: "LogSeverityScreen"}))
+	})
+	It("should parse per-host config keys", func() {
+		Expect(ParseKey("/calico/v1/host/myhost/config/InterfacePrefix")).To(Equal(
+			HostConfigKey{Hostname: "myhost", Name: "InterfacePrefix"}))
+	})
+	It("should not parse config directories or nested keys", func() {
+		Expect(ParseKey("/calico/v1/config")).To(BeNil())
+		Expect(ParseKey("/calico/v1/host/myhost/config")).To(BeNil())
+		Expect(ParseKey("/calico/v1/config/foo/bar")).To(BeNil())
+		Expect(ParseKey("/calico/v1/host/myhost/config/foo/bar")).To(BeNil())
+	})
+	It("should return config values as raw strings", func() {
+		key, value, err := ParseKeyValue("/calico/v1/config/LogSeverityScreen", []byte("info"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key).To(Equal(GlobalConfigKey{Name: "LogSeverityScreen"}))
+		Expect(value).To(Equal("info"))
+	})
+})
@@ -0,0 +1,194 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+
+	"github.com/golang/glog"
+	"github.com/projectcalico/calico-go/lib/common"
+)
+
+var (
+	matchHostEndpointStatus     = regexp.MustCompile("^/?calico/felix/v1/host/([^/]+)/endpoint/([^/]+)$")
+	matchWorkloadEndpointStatus = regexp.MustCompile("^/?calico/felix/v1/host/([^/]+)/workload/([^/]+)/([^/]+)/endpoint/([^/]+)$")
+)
+
+// HostEndpointStatusKey is the key for the status of a host endpoint, as
+// reported by the Felix on that host.
+type HostEndpointStatusKey struct {
+	Hostname   string `json:"-" validate:"required,hostname"`
+	EndpointID string `json:"-" validate:"required,hostname"`
+}
+
+func (key HostEndpointStatusKey) asEtcdKey() (string, error) {
+	if key.Hostname == "" || key.EndpointID == "" {
+		return "", common.ErrorInsufficientIdentifiers{}
+	}
+	e := fmt.Sprintf("/calico/felix/v1/host/%s/endpoint/%s",
+		key.Hostname, key.EndpointID)
+	return e, nil
+}
+
+func (key HostEndpointStatusKey) asEtcdDeleteKey() (string, error) {
+	return key.asEtcdKey()
+}
+
+func (key HostEndpointStatusKey) valueType() reflect.Type {
+	return reflect.TypeOf(EndpointStatus{})
+}
+
+type HostEndpointStatusListOptions struct {
+	Hostname   string
+	EndpointID string
+}
+
+func (options HostEndpointStatusListOptions) asEtcdKeyRoot() string {
+	k := "/calico/felix/v1/host"
+	if options.Hostname == "" {
+		return k
+	}
+	k = k + fmt.Sprintf("/%s/endpoint", options.Hostname)
+	if options.EndpointID == "" {
+		return k
+	}
+	k = k + fmt.Sprintf("/%s", options.EndpointID)
+	return k
+}
+
+func (options HostEndpointStatusListOptions) keyFromEtcdResult(ekey string) KeyInterface {
+	glog.V(2).Infof("Get HostEndpointStatus key from %s", ekey)
+	r := matchHostEndpointStatus.FindAllStringSubmatch(ekey, -1)
+	if len(r) != 1 {
+		glog.V(2).Infof("Didn't match regex")
+		return nil
+	}
+	hostname := r[0][1]
+	endpointID := r[0][2]
+	if options.Hostname != "" && hostname != options.Hostname {
+		glog.V(2).Infof("Didn't match hostname %s != %s", options.Hostname, hostname)
+		return nil
+	}
+	if options.EndpointID != "" && endpointID != options.EndpointID {
+		glog.V(2).Infof("Didn't match endpointID %s != %s", options.EndpointID, endpointID)
+		return nil
+	}
+	return HostEndpointStatusKey{Hostname: hostname, EndpointID: endpointID}
+}
+
+// WorkloadEndpointStatusKey is the key for the status of a workload endpoint,
+// as reported by the Felix on the workload's host.
+type WorkloadEndpointStatusKey struct {
+	Hostname       string `json:"-"`
+	OrchestratorID string `json:"-"`
+	WorkloadID     string `json:"-"`
+	EndpointID     string `json:"-"`
+}
+
+func (key WorkloadEndpointStatusKey) asEtcdKey() (string, error) {
+	if key.Hostname == "" || key.OrchestratorID == "" || key.WorkloadID == "" || key.EndpointID == "" {
+		return "", common.ErrorInsufficientIdentifiers{}
+	}
+	return fmt.Sprintf("/calico/felix/v1/host/%s/workload/%s/%s/endpoint/%s",
+		key.Hostname, key.OrchestratorID, key.WorkloadID, key.EndpointID), nil
+}
+
+func (key WorkloadEndpointStatusKey) asEtcdDeleteKey() (string, error) {
+	return key.asEtcdKey()
+}
+
+func (key WorkloadEndpointStatusKey) valueType() reflect.Type {
+	return reflect.TypeOf(EndpointStatus{})
+}
+
+type WorkloadEndpointStatusListOptions struct {
+	Hostname       string
+	OrchestratorID string
+	WorkloadID     string
+	EndpointID     string
+}
+
+func (options WorkloadEndpointStatusListOptions) asEtcdKeyRoot() string {
+	k := "/calico/felix/v1/host"
+	if options.Hostname == "" {
+		return k
+	}
+	k = k + fmt.Sprintf("/%s/workload", options.Hostname)
+	if options.OrchestratorID == "" {
+		return k
+	}
+	k = k + fmt.Sprintf("/%s", options.OrchestratorID)
+	if options.WorkloadID == "" {
+		return k
+	}
+	k = k + fmt.Sprintf("/%s/endpoint", options.WorkloadID)
+	if options.EndpointID == "" {
+		return k
+	}
+	k = k + fmt.Sprintf("/%s", options.EndpointID)
+	return k
+}
+
+func (options WorkloadEndpointStatusListOptions) keyFromEtcdResult(ekey string) KeyInterface {
+	glog.V(2).Infof("Get WorkloadEndpointStatus key from %s", ekey)
+	r := matchWorkloadEndpointStatus.FindAllStringSubmatch(ekey, -1)
+	if len(r) != 1 {
+		glog.V(2).Infof("Didn't match regex")
+		return nil
+	}
+	hostname := r[0][1]
+	orch := r[0][2]
+	workload := r[0][3]
+	endpointID := r[0][4]
+	if options.Hostname != "" && hostname != options.Hostname {
+		glog.V(2).Infof("Didn't match hostname %s != %s", options.Hostname, hostname)
+		return nil
+	}
+	if options.OrchestratorID != "" && orch != options.OrchestratorID {
+		glog.V(2).Infof("Didn't match orchestrator %s != %s", options.OrchestratorID, orch)
+		return nil
+	}
+	if options.WorkloadID != "" && workload != options.WorkloadID {
+		glog.V(2).Infof("Didn't match workload %s != %s", options.WorkloadID, workload)
+		return nil
+	}
+	if options.EndpointID != "" && endpointID != options.EndpointID {
+		glog.V(2).Infof("Didn't match endpointID %s != %s", options.EndpointID, endpointID)
+		return nil
+	}
+	return WorkloadEndpointStatusKey{
+		Hostname:       hostname,
+		OrchestratorID: orch,
+		WorkloadID:     workload,
+		EndpointID:     endpointID,
+	}
+}
+
+// WorkloadEndpointStatus is an EndpointStatus along with the key of the
+// workload endpoint that it belongs to.
+type WorkloadEndpointStatus struct {
+	WorkloadEndpointStatusKey `json:"-"`
+	EndpointStatus
+}
+
+// EndpointStatus is the status of a workload or host endpoint.
+type EndpointStatus struct {
+	// Status is "up" once Felix has programmed the endpoint's policy,
+	// "down" if the endpoint's interface is down or "error" if Felix
+	// failed to program the endpoint.
+	Status string `json:"status"`
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+
+	"github.com/golang/glog"
+	"github.com/projectcalico/calico-go/lib/common"
+)
+
+var (
+	matchHostStatus = regexp.MustCompile("^/?calico/felix/v1/host/([^/]+)/status$")
+)
+
+// HostStatusKey is the key for the status that Felix (via its datastore
+// driver) periodically reports for its host.  Status keys are written with a
+// TTL so a host's status disappears if it stops reporting.
+type HostStatusKey struct {
+	Hostname string `json:"-" validate:"required,hostname"`
+}
+
+func (key HostStatusKey) asEtcdKey() (string, error) {
+	if key.Hostname == "" {
+		return "", common.ErrorInsufficientIdentifiers{}
+	}
+	e := fmt.Sprintf("/calico/felix/v1/host/%s/status", key.Hostname)
+	return e, nil
+}
+
+func (key HostStatusKey) asEtcdDeleteKey() (string, error) {
+	return key.asEtcdKey()
+}
+
+func (key HostStatusKey) valueType() reflect.Type {
+	return reflect.TypeOf(HostStatus{})
+}
+
+type HostStatusListOptions struct {
+	Hostname string
+}
+
+func (options HostStatusListOptions) asEtcdKeyRoot() string {
+	k := "/calico/felix/v1/host"
+	if options.Hostname == "" {
+		return k
+	}
+	k = k + fmt.Sprintf("/%s/status", options.Hostname)
+	return k
+}
+
+func (options HostStatusListOptions) keyFromEtcdResult(ekey string) KeyInterface {
+	glog.V(2).Infof("Get HostStatus key from %s", ekey)
+	r := matchHostStatus.FindAllStringSubmatch(ekey, -1)
+	if len(r) != 1 {
+		glog.V(2).Infof("Didn't match regex")
+		return nil
+	}
+	hostname := r[0][1]
+	if options.Hostname != "" && hostname != options.Hostname {
+		glog.V(2).Infof("Didn't match hostname %s != %s", options.Hostname, hostname)
+		return nil
+	}
+	return HostStatusKey{Hostname: hostname}
+}
+
+type HostStatus struct {
+	HostStatusKey `json:"-"`
+	// Time is when the status was reported, in RFC 3339 format.
+	Time string `json:"time"`
+	// Uptime is the number of seconds since the driver started.
+	Uptime     float64 `json:"uptime"`
+	Version    string  `json:"version"`
+	SyncStatus string  `json:"sync_status"`
+}
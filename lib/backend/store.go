@@ -30,6 +30,8 @@ func ParseKey(key string) KeyInterface {
 			WorkloadID:     m[3],
 			EndpointID:     m[4],
 		}
+	} else if m := matchHostEndpoint.FindStringSubmatch(key); m != nil {
+		return HostEndpointKey{Hostname: m[1], EndpointID: m[2]}
 	} else if m := matchPolicy.FindStringSubmatch(key); m != nil {
 		return PolicyKey{
 			Tier: m[1],
@@ -50,12 +52,33 @@ func ParseKey(key string) KeyInterface {
 		return TierKey{Name: m[1]}
 	} else if m := matchHostIp.FindStringSubmatch(key); m != nil {
 		return HostIPKey{Hostname: m[1]}
+	} else if m := matchGlobalConfig.FindStringSubmatch(key); m != nil {
+		return GlobalConfigKey{Name: m[1]}
+	} else if m := matchHostConfig.FindStringSubmatch(key); m != nil {
+		return HostConfigKey{Hostname: m[1], Name: m[2]}
+	} else if m := matchHostStatus.FindStringSubmatch(key); m != nil {
+		return HostStatusKey{Hostname: m[1]}
+	} else if m := matchHostEndpointStatus.FindStringSubmatch(key); m != nil {
+		return HostEndpointStatusKey{Hostname: m[1], EndpointID: m[2]}
+	} else if m := matchWorkloadEndpointStatus.FindStringSubmatch(key); m != nil {
+		return WorkloadEndpointStatusKey{
+			Hostname:       m[1],
+			OrchestratorID: m[2],
+			WorkloadID:     m[3],
+			EndpointID:     m[4],
+		}
 	}
 	// Not a key we know about.
 	return nil
 }
 
+// ParseValue parses the raw datastore value for the given key.  Most values
+// are JSON and are returned as a pointer to the appropriate struct; config
+// values are stored as raw strings and are returned as a string.
 func ParseValue(key KeyInterface, rawData []byte) (interface{}, error) {
+	if key.valueType() == typeConfigValue {
+		return string(rawData), nil
+	}
 	value := reflect.New(key.valueType()).Interface()
 	err := json.Unmarshal(rawData, value)
 	if err != nil {
@@ -19,6 +19,7 @@ import (
 	"io/ioutil"
 	"reflect"
 
+	etcd "github.com/coreos/etcd/client"
 	"github.com/ghodss/yaml"
 	"github.com/golang/glog"
 	"github.com/kelseyhightower/envconfig"
@@ -58,6 +59,12 @@ func New(config *api.ClientConfig) (c *Client, err error) {
 	return &cc, err
 }
 
+// NewWithKeysAPI returns a Client that uses the given etcd KeysAPI rather than
+// connecting to etcd itself.
+func NewWithKeysAPI(config *api.ClientConfig, keysAPI etcd.KeysAPI) *Client {
+	return &Client{backend: backend.NewClientWithKeysAPI(config, keysAPI)}
+}
+
 func (c *Client) Tiers() TierInterface {
 	return newTiers(c)
 }
@@ -74,6 +81,18 @@ func (c *Client) HostEndpoints() HostEndpointInterface {
 	return newHostEndpoints(c)
 }
 
+func (c *Client) FelixConfigurations() FelixConfigurationInterface {
+	return newFelixConfigurations(c)
+}
+
+func (c *Client) NodeStatuses() NodeStatusInterface {
+	return newNodeStatuses(c)
+}
+
+func (c *Client) WorkloadEndpointStatuses() WorkloadEndpointStatusInterface {
+	return newWorkloadEndpointStatuses(c)
+}
+
 // Load the client config from the specified file (if specified) and from environment
 // variables.  The values from both locations are merged together, with file values
 // taking precedence).
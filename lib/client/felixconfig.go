@@ -0,0 +1,191 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"github.com/projectcalico/calico-go/lib/api"
+	"github.com/projectcalico/calico-go/lib/backend"
+)
+
+// FelixConfigurationInterface has methods to work with FelixConfiguration resources.
+type FelixConfigurationInterface interface {
+	List(api.FelixConfigurationMetadata) (*api.FelixConfigurationList, error)
+	Get(api.FelixConfigurationMetadata) (*api.FelixConfiguration, error)
+	Create(*api.FelixConfiguration) (*api.FelixConfiguration, error)
+	Update(*api.FelixConfiguration) (*api.FelixConfiguration, error)
+	Apply(*api.FelixConfiguration) (*api.FelixConfiguration, error)
+	Delete(api.FelixConfigurationMetadata) error
+}
+
+// felixConfigurations implements FelixConfigurationInterface
+type felixConfigurations struct {
+	c *Client
+}
+
+// felixConfigValue is the backend representation of a single Felix config
+// parameter.  Config values are stored as raw strings rather than JSON, so
+// felixConfigurations also provides its own backendObjectReaderWriter.
+type felixConfigValue struct {
+	Key   backend.KeyInterface
+	Value string
+}
+
+// newFelixConfigurations returns a felixConfigurations
+func newFelixConfigurations(c *Client) *felixConfigurations {
+	return &felixConfigurations{c}
+}
+
+// List takes a Metadata, and returns the list of config parameters that match that
+// Metadata (wildcarding missing fields).  A blank hostname lists the global config.
+func (h *felixConfigurations) List(metadata api.FelixConfigurationMetadata) (*api.FelixConfigurationList, error) {
+	if l, err := h.c.list(felixConfigValue{}, metadata, h, h); err != nil {
+		return nil, err
+	} else {
+		hl := api.NewFelixConfigurationList()
+		hl.Items = make([]api.FelixConfiguration, 0, len(l))
+		for _, h := range l {
+			hl.Items = append(hl.Items, *h.(*api.FelixConfiguration))
+		}
+		return hl, nil
+	}
+}
+
+// Get returns information about a particular config parameter.
+func (h *felixConfigurations) Get(metadata api.FelixConfigurationMetadata) (*api.FelixConfiguration, error) {
+	if a, err := h.c.get(felixConfigValue{}, metadata, h, h); err != nil {
+		return nil, err
+	} else {
+		return a.(*api.FelixConfiguration), nil
+	}
+}
+
+// Create creates a new config parameter.
+func (h *felixConfigurations) Create(a *api.FelixConfiguration) (*api.FelixConfiguration, error) {
+	return a, h.c.create(*a, h, h)
+}
+
+// Update updates an existing config parameter.
+func (h *felixConfigurations) Update(a *api.FelixConfiguration) (*api.FelixConfiguration, error) {
+	return a, h.c.update(*a, h, h)
+}
+
+// Apply creates a new or replaces an existing config parameter.
+func (h *felixConfigurations) Apply(a *api.FelixConfiguration) (*api.FelixConfiguration, error) {
+	return a, h.c.apply(*a, h, h)
+}
+
+// Delete deletes an existing config parameter.
+func (h *felixConfigurations) Delete(metadata api.FelixConfigurationMetadata) error {
+	return h.c.delete(metadata, h)
+}
+
+// Convert a FelixConfigurationMetadata to a global or host config ListInterface
+func (h *felixConfigurations) convertMetadataToListInterface(m interface{}) (backend.ListInterface, error) {
+	cm := m.(api.FelixConfigurationMetadata)
+	if cm.Hostname == "" {
+		return backend.GlobalConfigListOptions{
+			Name: cm.Name,
+		}, nil
+	}
+	return backend.HostConfigListOptions{
+		Hostname: cm.Hostname,
+		Name:     cm.Name,
+	}, nil
+}
+
+// Convert a FelixConfigurationMetadata to a global or host config KeyInterface
+func (h *felixConfigurations) convertMetadataToKeyInterface(m interface{}) (backend.KeyInterface, error) {
+	cm := m.(api.FelixConfigurationMetadata)
+	if cm.Hostname == "" {
+		return backend.GlobalConfigKey{
+			Name: cm.Name,
+		}, nil
+	}
+	return backend.HostConfigKey{
+		Hostname: cm.Hostname,
+		Name:     cm.Name,
+	}, nil
+}
+
+// Convert an API FelixConfiguration structure to a backend config value
+func (h *felixConfigurations) convertAPIToBackend(a interface{}) (interface{}, error) {
+	ac := a.(api.FelixConfiguration)
+	k, err := h.convertMetadataToKeyInterface(ac.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	bc := felixConfigValue{
+		Key:   k,
+		Value: ac.Spec.Value,
+	}
+
+	return bc, nil
+}
+
+// Convert a backend config value to an API FelixConfiguration structure
+func (h *felixConfigurations) convertBackendToAPI(b interface{}) (interface{}, error) {
+	bc := *b.(*felixConfigValue)
+	ac := api.NewFelixConfiguration()
+
+	switch k := bc.Key.(type) {
+	case backend.GlobalConfigKey:
+		ac.Metadata.Name = k.Name
+	case backend.HostConfigKey:
+		ac.Metadata.Hostname = k.Hostname
+		ac.Metadata.Name = k.Name
+	}
+
+	ac.Spec.Value = bc.Value
+
+	return ac, nil
+}
+
+func (h *felixConfigurations) copyKeyValues(kvs []backend.KeyValue, b interface{}) {
+	bc := b.(*felixConfigValue)
+	bc.Key = kvs[0].Key
+}
+
+func (h *felixConfigurations) backendCreate(k backend.KeyInterface, obj interface{}) error {
+	c := obj.(felixConfigValue)
+	return h.c.backend.Create(backend.KeyValue{Key: k, Value: []byte(c.Value)})
+}
+
+func (h *felixConfigurations) backendUpdate(k backend.KeyInterface, obj interface{}) error {
+	c := obj.(felixConfigValue)
+	return h.c.backend.Update(backend.KeyValue{Key: k, Value: []byte(c.Value)})
+}
+
+func (h *felixConfigurations) backendApply(k backend.KeyInterface, obj interface{}) error {
+	c := obj.(felixConfigValue)
+	return h.c.backend.Apply(backend.KeyValue{Key: k, Value: []byte(c.Value)})
+}
+
+func (h *felixConfigurations) backendGet(k backend.KeyInterface, objp interface{}) (interface{}, error) {
+	if kv, err := h.c.backend.Get(k); err != nil {
+		return nil, err
+	} else {
+		return &felixConfigValue{Key: k, Value: string(kv.Value)}, nil
+	}
+}
+
+func (h *felixConfigurations) backendListConvert(in []backend.KeyValue) [][]backend.KeyValue {
+	return h.c.backendListConvert(in)
+}
+
+// Config values are raw strings, so there is nothing to unmarshal.
+func (h *felixConfigurations) unmarshalIntoNewBackendStruct(kvs []backend.KeyValue, backendObjectp interface{}) (interface{}, error) {
+	return &felixConfigValue{Value: string(kvs[0].Value)}, nil
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"sort"
+	"strings"
+
+	etcd "github.com/coreos/etcd/client"
+	"github.com/projectcalico/calico-go/lib/api"
+	"github.com/projectcalico/calico-go/lib/api/unversioned"
+	. "github.com/projectcalico/calico-go/lib/client"
+	"github.com/projectcalico/calico-go/lib/common"
+	"golang.org/x/net/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeKeysAPI is an in-memory etcd KeysAPI.  Methods that the client doesn't
+// use are left unimplemented and panic.
+type fakeKeysAPI struct {
+	etcd.KeysAPI
+	values map[string]string
+}
+
+func (f *fakeKeysAPI) Get(ctx context.Context, key string, opts *etcd.GetOptions) (*etcd.Response, error) {
+	if value, ok := f.values[key]; ok {
+		return &etcd.Response{Node: &etcd.Node{Key: key, Value: value}}, nil
+	}
+	// Return the directory's keys as a flat list; the client only looks
+	// at the leaves.
+	dir := &etcd.Node{Key: key, Dir: true}
+	keys := []string{}
+	for k := range f.values {
+		if strings.HasPrefix(k, key+"/") {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, etcd.Error{Code: etcd.ErrorCodeKeyNotFound}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		dir.Nodes = append(dir.Nodes, &etcd.Node{Key: k, Value: f.values[k]})
+	}
+	return &etcd.Response{Node: dir}, nil
+}
+
+func (f *fakeKeysAPI) Set(ctx context.Context, key, value string, opts *etcd.SetOptions) (*etcd.Response, error) {
+	f.values[key] = value
+	return &etcd.Response{}, nil
+}
+
+func (f *fakeKeysAPI) Create(ctx context.Context, key, value string) (*etcd.Response, error) {
+	if _, ok := f.values[key]; ok {
+		return nil, etcd.Error{Code: etcd.ErrorCodeNodeExist}
+	}
+	f.values[key] = value
+	return &etcd.Response{}, nil
+}
+
+func (f *fakeKeysAPI) Update(ctx context.Context, key, value string) (*etcd.Response, error) {
+	if _, ok := f.values[key]; !ok {
+		return nil, etcd.Error{Code: etcd.ErrorCodeKeyNotFound}
+	}
+	f.values[key] = value
+	return &etcd.Response{}, nil
+}
+
+func (f *fakeKeysAPI) Delete(ctx context.Context, key string, opts *etcd.DeleteOptions) (*etcd.Response, error) {
+	if _, ok := f.values[key]; !ok {
+		return nil, etcd.Error{Code: etcd.ErrorCodeKeyNotFound}
+	}
+	delete(f.values, key)
+	return &etcd.Response{}, nil
+}
+
+func felixConfig(hostname, name, value string) *api.FelixConfiguration {
+	c := api.NewFelixConfiguration()
+	c.Metadata.Hostname = hostname
+	c.Metadata.Name = name
+	c.Spec.Value = value
+	return c
+}
+
+var _ = Describe("FelixConfigurations", func() {
+	var keys *fakeKeysAPI
+	var configs FelixConfigurationInterface
+
+	BeforeEach(func() {
+		keys = &fakeKeysAPI{values: make(map[string]string)}
+		configs = NewWithKeysAPI(&api.ClientConfig{}, keys).FelixConfigurations()
+	})
+
+	It("should store global and per-host config as raw strings", func() {
+		_, err := configs.Create(felixConfig("", "LogSeverityScreen", "info"))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = configs.Create(felixConfig("myhost", "InterfacePrefix", "tap"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys.values).To(Equal(map[string]string{
+			"/calico/v1/config/LogSeverityScreen":           "info",
+			"/calico/v1/host/myhost/config/InterfacePrefix": "tap",
+		}))
+	})
+
+	Describe("with some config", func() {
+		BeforeEach(func() {
+			keys.values = map[string]string{
+				"/calico/v1/config/LogSeverityScreen":               "info",
+				"/calico/v1/config/MetadataPort":                    "8775",
+				"/calico/v1/host/myhost/config/InterfacePrefix":     "tap",
+				"/calico/v1/host/otherhost/config/InterfacePrefix":  "cali",
+				"/calico/v1/host/myhost/endpoint/eth0":              "{}",
+				"/calico/v1/host/myhost/workload/k8s/p/endpoint/e0": "{}",
+			}
+		})
+
+		It("should get a global parameter", func() {
+			c, err := configs.Get(api.FelixConfigurationMetadata{
+				ObjectMetadata: unversioned.ObjectMetadata{Name: "LogSeverityScreen"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c).To(Equal(felixConfig("", "LogSeverityScreen", "info")))
+		})
+		It("should get a per-host parameter", func() {
+			c, err := configs.Get(api.FelixConfigurationMetadata{
+				ObjectMetadata: unversioned.ObjectMetadata{Name: "InterfacePrefix"},
+				Hostname:       "myhost",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c).To(Equal(felixConfig("myhost", "InterfacePrefix", "tap")))
+		})
+		It("should list the global config", func() {
+			l, err := configs.List(api.FelixConfigurationMetadata{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(l.Items).To(Equal([]api.FelixConfiguration{
+				*felixConfig("", "LogSeverityScreen", "info"),
+				*felixConfig("", "MetadataPort", "8775"),
+			}))
+		})
+		It("should list only the given host's config", func() {
+			l, err := configs.List(api.FelixConfigurationMetadata{Hostname: "myhost"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(l.Items).To(Equal([]api.FelixConfiguration{
+				*felixConfig("myhost", "InterfacePrefix", "tap"),
+			}))
+		})
+		It("should update and delete a parameter", func() {
+			_, err := configs.Update(felixConfig("myhost", "InterfacePrefix", "cali"))
+			Expect(err).NotTo(HaveOccurred())
+			c, err := configs.Get(api.FelixConfigurationMetadata{
+				ObjectMetadata: unversioned.ObjectMetadata{Name: "InterfacePrefix"},
+				Hostname:       "myhost",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Spec.Value).To(Equal("cali"))
+
+			metadata := api.FelixConfigurationMetadata{
+				ObjectMetadata: unversioned.ObjectMetadata{Name: "MetadataPort"},
+			}
+			Expect(configs.Delete(metadata)).To(Succeed())
+			_, err = configs.Get(metadata)
+			Expect(err).To(BeAssignableToTypeOf(common.ErrorResourceDoesNotExist{}))
+		})
+		It("should refuse to create a parameter that exists", func() {
+			_, err := configs.Create(felixConfig("", "LogSeverityScreen", "debug"))
+			Expect(err).To(BeAssignableToTypeOf(common.ErrorResourceAlreadyExists{}))
+			Expect(keys.values["/calico/v1/config/LogSeverityScreen"]).To(Equal("info"))
+		})
+	})
+})
@@ -15,6 +15,9 @@
 package client
 
 import (
+	"encoding/json"
+
+	"github.com/golang/glog"
 	"github.com/projectcalico/calico-go/lib/api"
 	"github.com/projectcalico/calico-go/lib/backend"
 	. "github.com/projectcalico/calico-go/lib/common"
@@ -46,10 +49,16 @@ func (h *hostEndpoints) List(metadata api.HostEndpointMetadata) (*api.HostEndpoi
 	if l, err := h.c.list(backend.HostEndpoint{}, metadata, h, nil); err != nil {
 		return nil, err
 	} else {
+		statuses := h.loadStatuses(metadata)
 		hl := api.NewHostEndpointList()
 		hl.Items = make([]api.HostEndpoint, 0, len(l))
-		for _, h := range l {
-			hl.Items = append(hl.Items, *h.(*api.HostEndpoint))
+		for _, a := range l {
+			ah := *a.(*api.HostEndpoint)
+			ah.Status = statuses[backend.HostEndpointKey{
+				Hostname:   ah.Metadata.Hostname,
+				EndpointID: ah.Metadata.Name,
+			}]
+			hl.Items = append(hl.Items, ah)
 		}
 		return hl, nil
 	}
@@ -60,9 +69,41 @@ func (h *hostEndpoints) Get(metadata api.HostEndpointMetadata) (*api.HostEndpoin
 	if a, err := h.c.get(backend.HostEndpoint{}, metadata, h, nil); err != nil {
 		return nil, err
 	} else {
-		h := a.(api.HostEndpoint)
-		return &h, nil
+		ah := a.(*api.HostEndpoint)
+		ah.Status = h.loadStatuses(metadata)[backend.HostEndpointKey{
+			Hostname:   ah.Metadata.Hostname,
+			EndpointID: ah.Metadata.Name,
+		}]
+		return ah, nil
+	}
+}
+
+// loadStatuses returns the statuses that Felix has reported for the host
+// endpoints that match the metadata.  The statuses are informational so a
+// failure to load them isn't an error.
+func (h *hostEndpoints) loadStatuses(metadata api.HostEndpointMetadata) map[backend.HostEndpointKey]*api.EndpointStatus {
+	kvs, err := h.c.backend.List(backend.HostEndpointStatusListOptions{
+		Hostname:   metadata.Hostname,
+		EndpointID: metadata.Name,
+	})
+	if err != nil {
+		glog.V(2).Infof("Failed to load host endpoint statuses: %v", err)
+		return nil
+	}
+	statuses := make(map[backend.HostEndpointKey]*api.EndpointStatus)
+	for _, kv := range kvs {
+		var bs backend.EndpointStatus
+		if err := json.Unmarshal(kv.Value, &bs); err != nil {
+			glog.V(2).Infof("Ignoring bad host endpoint status: %v", err)
+			continue
+		}
+		k := kv.Key.(backend.HostEndpointStatusKey)
+		statuses[backend.HostEndpointKey{
+			Hostname:   k.Hostname,
+			EndpointID: k.EndpointID,
+		}] = &api.EndpointStatus{Status: bs.Status}
 	}
+	return statuses
 }
 
 // Create creates a new host endpoint.
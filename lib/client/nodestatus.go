@@ -0,0 +1,125 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"time"
+
+	"github.com/projectcalico/calico-go/lib/api"
+	"github.com/projectcalico/calico-go/lib/backend"
+)
+
+// NodeStatusInterface has methods to work with NodeStatus resources.  Node
+// statuses are written by Felix, so they are read-only.
+type NodeStatusInterface interface {
+	List(api.NodeStatusMetadata) (*api.NodeStatusList, error)
+	Get(api.NodeStatusMetadata) (*api.NodeStatus, error)
+}
+
+// nodeStatuses implements NodeStatusInterface
+type nodeStatuses struct {
+	c *Client
+}
+
+// newNodeStatuses returns a nodeStatuses
+func newNodeStatuses(c *Client) *nodeStatuses {
+	return &nodeStatuses{c}
+}
+
+// List takes a Metadata, and returns the list of node statuses that match that
+// Metadata (wildcarding missing fields).
+func (h *nodeStatuses) List(metadata api.NodeStatusMetadata) (*api.NodeStatusList, error) {
+	if l, err := h.c.list(backend.HostStatus{}, metadata, h, nil); err != nil {
+		return nil, err
+	} else {
+		hl := api.NewNodeStatusList()
+		hl.Items = make([]api.NodeStatus, 0, len(l))
+		for _, h := range l {
+			hl.Items = append(hl.Items, *h.(*api.NodeStatus))
+		}
+		return hl, nil
+	}
+}
+
+// Get returns the status of a particular node.
+func (h *nodeStatuses) Get(metadata api.NodeStatusMetadata) (*api.NodeStatus, error) {
+	if a, err := h.c.get(backend.HostStatus{}, metadata, h, nil); err != nil {
+		return nil, err
+	} else {
+		return a.(*api.NodeStatus), nil
+	}
+}
+
+// Convert a NodeStatusMetadata to a HostStatusListInterface
+func (h *nodeStatuses) convertMetadataToListInterface(m interface{}) (backend.ListInterface, error) {
+	nm := m.(api.NodeStatusMetadata)
+	l := backend.HostStatusListOptions{
+		Hostname: nm.Hostname,
+	}
+	return l, nil
+}
+
+// Convert a NodeStatusMetadata to a HostStatusKeyInterface
+func (h *nodeStatuses) convertMetadataToKeyInterface(m interface{}) (backend.KeyInterface, error) {
+	nm := m.(api.NodeStatusMetadata)
+	k := backend.HostStatusKey{
+		Hostname: nm.Hostname,
+	}
+	return k, nil
+}
+
+// Convert an API NodeStatus structure to a Backend HostStatus structure.  Only
+// needed to satisfy conversionHelper since node statuses are read-only.
+func (h *nodeStatuses) convertAPIToBackend(a interface{}) (interface{}, error) {
+	an := a.(api.NodeStatus)
+	k, err := h.convertMetadataToKeyInterface(an.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	uptime, _ := time.ParseDuration(an.Spec.Uptime)
+
+	bh := backend.HostStatus{
+		HostStatusKey: k.(backend.HostStatusKey),
+		Time:          an.Spec.LastReported,
+		Uptime:        uptime.Seconds(),
+		Version:       an.Spec.Version,
+		SyncStatus:    an.Spec.SyncStatus,
+	}
+
+	return bh, nil
+}
+
+// Convert a Backend HostStatus structure to an API NodeStatus structure
+func (h *nodeStatuses) convertBackendToAPI(b interface{}) (interface{}, error) {
+	bh := *b.(*backend.HostStatus)
+	an := api.NewNodeStatus()
+
+	an.Metadata.Hostname = bh.HostStatusKey.Hostname
+
+	uptime := time.Duration(bh.Uptime) * time.Second
+	an.Spec.LastReported = bh.Time
+	an.Spec.Uptime = uptime.String()
+	an.Spec.Version = bh.Version
+	an.Spec.SyncStatus = bh.SyncStatus
+	an.Spec.InSync = bh.SyncStatus == "in-sync"
+
+	return an, nil
+}
+
+func (h *nodeStatuses) copyKeyValues(kvs []backend.KeyValue, b interface{}) {
+	bh := b.(*backend.HostStatus)
+	k := kvs[0].Key.(backend.HostStatusKey)
+	bh.HostStatusKey = k
+}
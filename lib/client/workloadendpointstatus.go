@@ -0,0 +1,131 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"github.com/projectcalico/calico-go/lib/api"
+	"github.com/projectcalico/calico-go/lib/backend"
+)
+
+// WorkloadEndpointStatusInterface has methods to work with
+// WorkloadEndpointStatus resources.  Workload endpoint statuses are written by
+// Felix, so they are read-only.
+type WorkloadEndpointStatusInterface interface {
+	List(api.WorkloadEndpointStatusMetadata) (*api.WorkloadEndpointStatusList, error)
+	Get(api.WorkloadEndpointStatusMetadata) (*api.WorkloadEndpointStatus, error)
+}
+
+// workloadEndpointStatuses implements WorkloadEndpointStatusInterface
+type workloadEndpointStatuses struct {
+	c *Client
+}
+
+// newWorkloadEndpointStatuses returns a workloadEndpointStatuses
+func newWorkloadEndpointStatuses(c *Client) *workloadEndpointStatuses {
+	return &workloadEndpointStatuses{c}
+}
+
+// List takes a Metadata, and returns the list of workload endpoint statuses
+// that match that Metadata (wildcarding missing fields).
+func (w *workloadEndpointStatuses) List(metadata api.WorkloadEndpointStatusMetadata) (*api.WorkloadEndpointStatusList, error) {
+	if l, err := w.c.list(backend.WorkloadEndpointStatus{}, metadata, w, nil); err != nil {
+		return nil, err
+	} else {
+		wl := api.NewWorkloadEndpointStatusList()
+		wl.Items = make([]api.WorkloadEndpointStatus, 0, len(l))
+		for _, w := range l {
+			wl.Items = append(wl.Items, *w.(*api.WorkloadEndpointStatus))
+		}
+		return wl, nil
+	}
+}
+
+// Get returns the status of a particular workload endpoint.
+func (w *workloadEndpointStatuses) Get(metadata api.WorkloadEndpointStatusMetadata) (*api.WorkloadEndpointStatus, error) {
+	if a, err := w.c.get(backend.WorkloadEndpointStatus{}, metadata, w, nil); err != nil {
+		return nil, err
+	} else {
+		// The backend only returns the value, so fill in the key from
+		// the (fully specified) metadata.
+		aw := a.(*api.WorkloadEndpointStatus)
+		aw.Metadata = metadata
+		return aw, nil
+	}
+}
+
+// Convert a WorkloadEndpointStatusMetadata to a
+// WorkloadEndpointStatusListInterface
+func (w *workloadEndpointStatuses) convertMetadataToListInterface(m interface{}) (backend.ListInterface, error) {
+	wm := m.(api.WorkloadEndpointStatusMetadata)
+	l := backend.WorkloadEndpointStatusListOptions{
+		Hostname:       wm.Hostname,
+		OrchestratorID: wm.OrchestratorID,
+		WorkloadID:     wm.WorkloadID,
+		EndpointID:     wm.Name,
+	}
+	return l, nil
+}
+
+// Convert a WorkloadEndpointStatusMetadata to a
+// WorkloadEndpointStatusKeyInterface
+func (w *workloadEndpointStatuses) convertMetadataToKeyInterface(m interface{}) (backend.KeyInterface, error) {
+	wm := m.(api.WorkloadEndpointStatusMetadata)
+	k := backend.WorkloadEndpointStatusKey{
+		Hostname:       wm.Hostname,
+		OrchestratorID: wm.OrchestratorID,
+		WorkloadID:     wm.WorkloadID,
+		EndpointID:     wm.Name,
+	}
+	return k, nil
+}
+
+// Convert an API WorkloadEndpointStatus structure to a Backend
+// WorkloadEndpointStatus structure.  Only needed to satisfy conversionHelper
+// since workload endpoint statuses are read-only.
+func (w *workloadEndpointStatuses) convertAPIToBackend(a interface{}) (interface{}, error) {
+	aw := a.(api.WorkloadEndpointStatus)
+	k, err := w.convertMetadataToKeyInterface(aw.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	bw := backend.WorkloadEndpointStatus{
+		WorkloadEndpointStatusKey: k.(backend.WorkloadEndpointStatusKey),
+		EndpointStatus:            backend.EndpointStatus{Status: aw.Spec.Status},
+	}
+
+	return bw, nil
+}
+
+// Convert a Backend WorkloadEndpointStatus structure to an API
+// WorkloadEndpointStatus structure
+func (w *workloadEndpointStatuses) convertBackendToAPI(b interface{}) (interface{}, error) {
+	bw := *b.(*backend.WorkloadEndpointStatus)
+	aw := api.NewWorkloadEndpointStatus()
+
+	aw.Metadata.Name = bw.EndpointID
+	aw.Metadata.Hostname = bw.Hostname
+	aw.Metadata.OrchestratorID = bw.OrchestratorID
+	aw.Metadata.WorkloadID = bw.WorkloadID
+	aw.Spec.Status = bw.Status
+
+	return aw, nil
+}
+
+func (w *workloadEndpointStatuses) copyKeyValues(kvs []backend.KeyValue, b interface{}) {
+	bw := b.(*backend.WorkloadEndpointStatus)
+	k := kvs[0].Key.(backend.WorkloadEndpointStatusKey)
+	bw.WorkloadEndpointStatusKey = k
+}
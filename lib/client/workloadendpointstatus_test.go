@@ -0,0 +1,100 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"github.com/projectcalico/calico-go/lib/api"
+	. "github.com/projectcalico/calico-go/lib/client"
+	"github.com/projectcalico/calico-go/lib/common"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func workloadEndpointStatus(hostname, workload, name, status string) api.WorkloadEndpointStatus {
+	s := api.NewWorkloadEndpointStatus()
+	s.Metadata.Hostname = hostname
+	s.Metadata.OrchestratorID = "k8s"
+	s.Metadata.WorkloadID = workload
+	s.Metadata.Name = name
+	s.Spec.Status = status
+	return *s
+}
+
+var _ = Describe("WorkloadEndpointStatuses", func() {
+	var statuses WorkloadEndpointStatusInterface
+
+	BeforeEach(func() {
+		keys := &fakeKeysAPI{values: map[string]string{
+			"/calico/felix/v1/host/myhost/workload/k8s/p1/endpoint/e0":    `{"status":"up"}`,
+			"/calico/felix/v1/host/myhost/workload/k8s/p1/endpoint/e1":    `{"status":"error"}`,
+			"/calico/felix/v1/host/myhost/workload/k8s/p2/endpoint/e0":    `{"status":"down"}`,
+			"/calico/felix/v1/host/otherhost/workload/k8s/p3/endpoint/e0": `{"status":"up"}`,
+			"/calico/felix/v1/host/myhost/endpoint/eth0":                  `{"status":"up"}`,
+			"/calico/felix/v1/host/myhost/status":                         `{"sync_status":"in-sync"}`,
+		}}
+		statuses = NewWithKeysAPI(&api.ClientConfig{}, keys).WorkloadEndpointStatuses()
+	})
+
+	It("should get the status of a workload endpoint", func() {
+		s, err := statuses.Get(api.WorkloadEndpointStatusMetadata{
+			Hostname:       "myhost",
+			OrchestratorID: "k8s",
+			WorkloadID:     "p1",
+			Name:           "e1",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*s).To(Equal(workloadEndpointStatus("myhost", "p1", "e1", "error")))
+	})
+	It("should return an error for an endpoint with no status", func() {
+		_, err := statuses.Get(api.WorkloadEndpointStatusMetadata{
+			Hostname:       "myhost",
+			OrchestratorID: "k8s",
+			WorkloadID:     "p1",
+			Name:           "e2",
+		})
+		Expect(err).To(BeAssignableToTypeOf(common.ErrorResourceDoesNotExist{}))
+	})
+	It("should list only workload endpoint statuses", func() {
+		l, err := statuses.List(api.WorkloadEndpointStatusMetadata{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(l.Items).To(ConsistOf(
+			workloadEndpointStatus("myhost", "p1", "e0", "up"),
+			workloadEndpointStatus("myhost", "p1", "e1", "error"),
+			workloadEndpointStatus("myhost", "p2", "e0", "down"),
+			workloadEndpointStatus("otherhost", "p3", "e0", "up"),
+		))
+	})
+	It("should list the statuses of a host's endpoints", func() {
+		l, err := statuses.List(api.WorkloadEndpointStatusMetadata{Hostname: "myhost"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(l.Items).To(ConsistOf(
+			workloadEndpointStatus("myhost", "p1", "e0", "up"),
+			workloadEndpointStatus("myhost", "p1", "e1", "error"),
+			workloadEndpointStatus("myhost", "p2", "e0", "down"),
+		))
+	})
+	It("should filter by endpoint ID without a workload ID", func() {
+		l, err := statuses.List(api.WorkloadEndpointStatusMetadata{
+			Hostname: "myhost",
+			Name:     "e0",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(l.Items).To(ConsistOf(
+			workloadEndpointStatus("myhost", "p1", "e0", "up"),
+			workloadEndpointStatus("myhost", "p2", "e0", "down"),
+		))
+	})
+})
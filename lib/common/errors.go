@@ -90,3 +90,14 @@ type ErrorInsufficientIdentifiers struct {
 func (e ErrorInsufficientIdentifiers) Error() string {
 	return "insufficient identifiers"
 }
+
+// Error indicating that an operation is not supported on a type of resource,
+// for example, attempting to create a read-only resource.
+type ErrorOperationNotSupported struct {
+	Operation string
+	Kind      string
+}
+
+func (e ErrorOperationNotSupported) Error() string {
+	return fmt.Sprintf("operation %s is not supported on %s resources", e.Operation, e.Kind)
+}